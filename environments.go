@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// environmentAPI is part of the API connected to managing environments
+type environmentAPI interface {
+	GetEnvironments() ([]rainforest.Environment, error)
+	GetEnvironment(int) (*rainforest.Environment, error)
+	CreateEnvironment(rainforest.EnvironmentParams) (*rainforest.Environment, error)
+	UpdateEnvironment(int, rainforest.EnvironmentUpdateParams) (*rainforest.Environment, error)
+	DeleteEnvironment(int) error
+}
+
+// createEnvironment creates a new environment, to be used with the environment create cli command.
+func createEnvironment(c cliContext, api environmentAPI) error {
+	name := strings.TrimSpace(c.Args().First())
+	if name == "" {
+		return cli.NewExitError("Environment name cannot be blank", 1)
+	}
+
+	params := rainforest.EnvironmentParams{
+		Name:        name,
+		URL:         c.String("url"),
+		IsTemporary: c.Bool("temporary"),
+		Webhook:     c.String("webhook"),
+	}
+	if params.URL == "" {
+		return cli.NewExitError("url flag required", 1)
+	}
+	if err := validateEnvironmentURL(params.URL); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if params.Webhook != "" {
+		if err := validateEnvironmentURL(params.Webhook); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		params.WebhookEnabled = !c.Bool("disable-webhook")
+	}
+
+	environment, err := api.CreateEnvironment(params)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Created environment %q with ID %v.\n", environment.Name, environment.ID)
+	return nil
+}
+
+// updateEnvironment changes the environment given as an argument, to be used with the
+// environment update cli command. Only the fields given as flags are changed.
+func updateEnvironment(c cliContext, api environmentAPI) error {
+	envID, err := getEnvironmentID(c.Args().First(), api)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	params := rainforest.EnvironmentUpdateParams{}
+	if name := strings.TrimSpace(c.String("name")); name != "" {
+		params.Name = &name
+	}
+	if envURL := c.String("url"); envURL != "" {
+		if err = validateEnvironmentURL(envURL); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		params.URL = &envURL
+	}
+	if webhook := c.String("webhook"); webhook != "" {
+		if err = validateEnvironmentURL(webhook); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		params.Webhook = &webhook
+	}
+
+	enable := c.Bool("enable-webhook")
+	disable := c.Bool("disable-webhook")
+	if enable && disable {
+		return cli.NewExitError("enable-webhook and disable-webhook can't be used together", 1)
+	}
+	if enable || disable {
+		params.WebhookEnabled = &enable
+	}
+
+	if params == (rainforest.EnvironmentUpdateParams{}) {
+		return cli.NewExitError("Nothing to update, use --name, --url, --webhook, --enable-webhook or --disable-webhook", 1)
+	}
+
+	environment, err := api.UpdateEnvironment(envID, params)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Updated environment %q.\n", environment.Name)
+	return nil
+}
+
+// deleteEnvironment deletes the environment given as an argument, to be used with the
+// environment delete cli command.
+func deleteEnvironment(c cliContext, api environmentAPI) error {
+	arg := c.Args().First()
+	envID, err := getEnvironmentID(arg, api)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	err = api.DeleteEnvironment(envID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Deleted environment %q.\n", arg)
+	return nil
+}
+
+// showEnvironment prints the details of the environment given as an argument, to be used
+// with the environment show cli command.
+func showEnvironment(c cliContext, api environmentAPI) error {
+	envID, err := getEnvironmentID(c.Args().First(), api)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	environment, err := api.GetEnvironment(envID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	createdAt := ""
+	if !environment.CreatedAt.IsZero() {
+		createdAt = environment.CreatedAt.Format(time.RFC3339)
+	}
+	printResourceTable([]string{"Field", "Value"}, [][]string{
+		{"ID", strconv.Itoa(environment.ID)},
+		{"Name", environment.Name},
+		{"URL", environment.URL},
+		{"Temporary", strconv.FormatBool(environment.IsTemporary)},
+		{"Webhook", environment.Webhook},
+		{"Webhook Enabled", strconv.FormatBool(environment.WebhookEnabled)},
+		{"Created At", createdAt},
+	})
+	return nil
+}
+
+// pruneEnvironments deletes the temporary environments created by the CLI which are older
+// than the older-than flag, to be used with the environments prune cli command. With the
+// temporary flag all temporary environments are deleted.
+func pruneEnvironments(c cliContext, api environmentAPI) error {
+	olderThan, err := parseAge(c.String("older-than"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	environments, err := api.GetEnvironments()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	dryRun := c.Bool("dry-run")
+	allTemporary := c.Bool("temporary")
+	pruned := 0
+	for _, environment := range environments {
+		if !environment.IsCLITemporary() && !(allTemporary && environment.IsTemporary) {
+			continue
+		}
+		// Without a creation time we can't tell whether the environment is still in use
+		if environment.CreatedAt.IsZero() || environment.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("Would delete environment %q (ID %v).\n", environment.Name, environment.ID)
+		} else {
+			err = api.DeleteEnvironment(environment.ID)
+			if err != nil {
+				return cli.NewExitError(fmt.Sprintf("Unable to delete environment %v: %v", environment.ID, err), 1)
+			}
+			fmt.Printf("Deleted environment %q (ID %v).\n", environment.Name, environment.ID)
+		}
+		pruned++
+	}
+
+	if pruned == 0 {
+		log.Printf("No temporary environments older than %v found.", olderThan)
+	}
+	return nil
+}
+
+// getEnvironmentID returns the ID of the environment given by its ID or name
+func getEnvironmentID(arg string, api environmentAPI) (int, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return 0, errors.New("Environment ID or name not specified")
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		return id, nil
+	}
+
+	environments, err := api.GetEnvironments()
+	if err != nil {
+		return 0, err
+	}
+
+	envID := 0
+	for _, environment := range environments {
+		if environment.Name != arg {
+			continue
+		}
+		if envID != 0 {
+			return 0, fmt.Errorf("More than one environment is named %q, use the environment ID instead", arg)
+		}
+		envID = environment.ID
+	}
+	if envID == 0 {
+		return 0, fmt.Errorf("Cannot find environment %q", arg)
+	}
+
+	return envID, nil
+}
+
+// validateEnvironmentURL checks that a URL given for an environment is an absolute http(s) URL
+func validateEnvironmentURL(envURL string) error {
+	u, err := url.Parse(envURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid URL %v, URLs must start with http:// or https://", envURL)
+	}
+	return nil
+}
+
+// parseAge parses a duration such as 36h or 7d
+func parseAge(age string) (time.Duration, error) {
+	if days := strings.TrimSuffix(age, "d"); days != age {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(age); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("Invalid age %q, use a duration such as 36h or 7d", age)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeEnvironmentAPI struct {
+	environments []rainforest.Environment
+	created      *rainforest.EnvironmentParams
+	updated      *rainforest.EnvironmentUpdateParams
+	updatedID    int
+	deleted      []int
+}
+
+func (f *fakeEnvironmentAPI) GetEnvironments() ([]rainforest.Environment, error) {
+	return f.environments, nil
+}
+
+func (f *fakeEnvironmentAPI) GetEnvironment(envID int) (*rainforest.Environment, error) {
+	for _, env := range f.environments {
+		if env.ID == envID {
+			return &env, nil
+		}
+	}
+	return nil, cli.NewExitError("not found", 1)
+}
+
+func (f *fakeEnvironmentAPI) CreateEnvironment(params rainforest.EnvironmentParams) (*rainforest.Environment, error) {
+	f.created = &params
+	return &rainforest.Environment{ID: 99, Name: params.Name}, nil
+}
+
+func (f *fakeEnvironmentAPI) UpdateEnvironment(envID int, params rainforest.EnvironmentUpdateParams) (*rainforest.Environment, error) {
+	f.updatedID = envID
+	f.updated = &params
+	return &rainforest.Environment{ID: envID, Name: "updated"}, nil
+}
+
+func (f *fakeEnvironmentAPI) DeleteEnvironment(envID int) error {
+	f.deleted = append(f.deleted, envID)
+	return nil
+}
+
+func TestCreateEnvironment(t *testing.T) {
+	api := &fakeEnvironmentAPI{}
+	c := newFakeContext(map[string]interface{}{
+		"url":     "https://staging.example.com",
+		"webhook": "https://hooks.example.com",
+	}, cli.Args{"Staging"})
+
+	if err := createEnvironment(c, api); err != nil {
+		t.Fatal(err)
+	}
+	want := rainforest.EnvironmentParams{
+		Name:           "Staging",
+		URL:            "https://staging.example.com",
+		Webhook:        "https://hooks.example.com",
+		WebhookEnabled: true,
+	}
+	if *api.created != want {
+		t.Errorf("Unexpected params. Want %+v, got %+v", want, *api.created)
+	}
+
+	for _, c := range []cliContext{
+		newFakeContext(map[string]interface{}{"url": "https://staging.example.com"}, cli.Args{}),
+		newFakeContext(map[string]interface{}{}, cli.Args{"Staging"}),
+		newFakeContext(map[string]interface{}{"url": "staging.example.com"}, cli.Args{"Staging"}),
+	} {
+		if err := createEnvironment(c, &fakeEnvironmentAPI{}); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
+
+func TestUpdateEnvironment(t *testing.T) {
+	api := &fakeEnvironmentAPI{environments: []rainforest.Environment{{ID: 3, Name: "Staging"}}}
+	c := newFakeContext(map[string]interface{}{
+		"url":             "https://new.example.com",
+		"disable-webhook": true,
+	}, cli.Args{"Staging"})
+
+	if err := updateEnvironment(c, api); err != nil {
+		t.Fatal(err)
+	}
+	if api.updatedID != 3 {
+		t.Errorf("Expected environment 3 to be updated, got %v", api.updatedID)
+	}
+	if api.updated.Name != nil || api.updated.Webhook != nil {
+		t.Errorf("Unexpected fields set: %+v", api.updated)
+	}
+	if *api.updated.URL != "https://new.example.com" || *api.updated.WebhookEnabled {
+		t.Errorf("Unexpected params: %+v", api.updated)
+	}
+
+	c = newFakeContext(map[string]interface{}{}, cli.Args{"3"})
+	err := updateEnvironment(c, api)
+	if err == nil || !strings.Contains(err.Error(), "Nothing to update") {
+		t.Errorf("Expected a nothing to update error, got %v", err)
+	}
+
+	c = newFakeContext(map[string]interface{}{"name": "x"}, cli.Args{"Production"})
+	err = updateEnvironment(c, api)
+	if err == nil || !strings.Contains(err.Error(), "Cannot find environment") {
+		t.Errorf("Expected a missing environment error, got %v", err)
+	}
+}
+
+func TestDeleteEnvironment(t *testing.T) {
+	api := &fakeEnvironmentAPI{environments: []rainforest.Environment{
+		{ID: 3, Name: "Staging"},
+		{ID: 4, Name: "Dup"},
+		{ID: 5, Name: "Dup"},
+	}}
+
+	if err := deleteEnvironment(newFakeContext(map[string]interface{}{}, cli.Args{"Staging"}), api); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteEnvironment(newFakeContext(map[string]interface{}{}, cli.Args{"42"}), api); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.deleted, []int{3, 42}) {
+		t.Errorf("Unexpected deleted environments: %v", api.deleted)
+	}
+
+	err := deleteEnvironment(newFakeContext(map[string]interface{}{}, cli.Args{"Dup"}), api)
+	if err == nil || !strings.Contains(err.Error(), "More than one environment") {
+		t.Errorf("Expected an ambiguous name error, got %v", err)
+	}
+}
+
+func TestShowEnvironment(t *testing.T) {
+	api := &fakeEnvironmentAPI{environments: []rainforest.Environment{
+		{ID: 3, Name: "Staging", URL: "https://staging.example.com", Webhook: "https://hooks.example.com", WebhookEnabled: true},
+	}}
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	if err := showEnvironment(newFakeContext(map[string]interface{}{}, cli.Args{"3"}), api); err != nil {
+		t.Fatal(err)
+	}
+	table := tablesOut.(*bytes.Buffer).String()
+	for _, want := range []string{"Staging", "https://staging.example.com", "https://hooks.example.com", "Webhook Enabled | true"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("Expected output to contain %q, got:\n%v", want, table)
+		}
+	}
+}
+
+func TestPruneEnvironments(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	api := &fakeEnvironmentAPI{environments: []rainforest.Environment{
+		{ID: 1, Name: "temporary-env-for-custom-url-via-CLI", IsTemporary: true, CreatedAt: old},
+		{ID: 2, Name: "nightly-temporary-env", IsTemporary: true, CreatedAt: time.Now()},
+		{ID: 3, Name: "nightly-temporary-env", IsTemporary: true, CreatedAt: old},
+		{ID: 4, Name: "Preview", IsTemporary: true, CreatedAt: old},
+		{ID: 5, Name: "nightly-temporary-env", IsTemporary: false, CreatedAt: old},
+		{ID: 6, Name: "nightly-temporary-env", IsTemporary: true},
+	}}
+
+	c := newFakeContext(map[string]interface{}{"older-than": "1d", "dry-run": true}, cli.Args{})
+	if err := pruneEnvironments(c, api); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.deleted) != 0 {
+		t.Errorf("Expected a dry run not to delete environments, deleted %v", api.deleted)
+	}
+
+	c = newFakeContext(map[string]interface{}{"older-than": "24h"}, cli.Args{})
+	if err := pruneEnvironments(c, api); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.deleted, []int{1, 3}) {
+		t.Errorf("Unexpected deleted environments: %v", api.deleted)
+	}
+
+	api.deleted = nil
+	c = newFakeContext(map[string]interface{}{"older-than": "24h", "temporary": true}, cli.Args{})
+	if err := pruneEnvironments(c, api); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.deleted, []int{1, 3, 4}) {
+		t.Errorf("Unexpected deleted environments with --temporary: %v", api.deleted)
+	}
+
+	c = newFakeContext(map[string]interface{}{"older-than": "a week"}, cli.Args{})
+	if err := pruneEnvironments(c, api); err == nil {
+		t.Error("Expected an invalid age error")
+	}
+}
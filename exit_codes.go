@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// Exit codes of the run and rerun commands, so pipelines can tell failed tests apart from
+// problems worth retrying. An interrupted CLI exits with 128 + the signal, e.g. 130 for
+// SIGINT and 143 for SIGTERM.
+const (
+	// exitCodeTestsFailed is used when the run finished with failed tests
+	exitCodeTestsFailed = 1
+	// exitCodeValidationError is used when the flags or arguments are invalid, or the API
+	// rejected the request
+	exitCodeValidationError = 2
+	// exitCodeAPIError is used when the API couldn't be reached or had an error
+	exitCodeAPIError = 3
+	// exitCodeRunCancelled is used when the run was cancelled before it finished
+	exitCodeRunCancelled = 4
+	// exitCodeNoResult is used when the run finished without a result
+	exitCodeNoResult = 5
+	// exitCodeTimeout is used when the run isn't done before --timeout
+	exitCodeTimeout = 124
+)
+
+// errorExitCode returns the exit code for an error which stopped the CLI before the run was
+// done: API errors caused by the server or the network are told apart from invalid requests.
+func errorExitCode(err error) int {
+	var apiErr *rainforest.APIError
+	if errors.As(err, &apiErr) {
+		return statusExitCode(apiErr.StatusCode)
+	}
+
+	var s3Err *rainforest.S3Error
+	if errors.As(err, &s3Err) {
+		return statusExitCode(s3Err.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitCodeAPIError
+	}
+
+	return exitCodeValidationError
+}
+
+// statusExitCode returns the exit code for an HTTP error status. Server errors and
+// throttling are API errors, other statuses mean the request was rejected.
+func statusExitCode(status int) int {
+	if status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests {
+		return exitCodeAPIError
+	}
+	return exitCodeValidationError
+}
+
+// newErrorExitError wraps the error in an exit error with the exit code for it
+func newErrorExitError(err error) *cli.ExitError {
+	return cli.NewExitError(err.Error(), errorExitCode(err))
+}
+
+// runExitCode returns the exit code for a run in a final state
+func runExitCode(status *rainforest.RunStatus) int {
+	switch {
+	case status.Result == "passed":
+		return 0
+	case status.State == "aborted":
+		return exitCodeRunCancelled
+	case status.Result == "no_result":
+		return exitCodeNoResult
+	default:
+		return exitCodeTestsFailed
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{&rainforest.APIError{StatusCode: 422, Message: ": invalid params"}, exitCodeValidationError},
+		{&rainforest.APIError{StatusCode: 404}, exitCodeValidationError},
+		{&rainforest.APIError{StatusCode: 503}, exitCodeAPIError},
+		{&rainforest.APIError{StatusCode: 429}, exitCodeAPIError},
+		{fmt.Errorf("creating run: %w", &rainforest.APIError{StatusCode: 500}), exitCodeAPIError},
+		{fmt.Errorf("uploading app: %w", &rainforest.S3Error{StatusCode: 503}), exitCodeAPIError},
+		{&rainforest.S3Error{StatusCode: 403, FileName: "app.apk"}, exitCodeValidationError},
+		{&url.Error{Op: "Get", URL: "https://app.rainforestqa.com", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}, exitCodeAPIError},
+		{errors.New("custom URL scheme must be http or https"), exitCodeValidationError},
+	}
+
+	for _, testCase := range testCases {
+		if got := errorExitCode(testCase.err); got != testCase.want {
+			t.Errorf("errorExitCode(%v) = %v, want %v", testCase.err, got, testCase.want)
+		}
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	testCases := []struct {
+		state  string
+		result string
+		want   int
+	}{
+		{"complete", "passed", 0},
+		{"complete", "failed", exitCodeTestsFailed},
+		{"in_progress", "failed", exitCodeTestsFailed},
+		{"aborted", "failed", exitCodeRunCancelled},
+		{"complete", "no_result", exitCodeNoResult},
+	}
+
+	for _, testCase := range testCases {
+		status := &rainforest.RunStatus{State: testCase.state, Result: testCase.result}
+		if got := runExitCode(status); got != testCase.want {
+			t.Errorf("runExitCode(%v, %v) = %v, want %v", testCase.state, testCase.result, got, testCase.want)
+		}
+	}
+}
+
+func TestStartRun_ExitCodes(t *testing.T) {
+	testCases := []struct {
+		mappings     map[string]interface{}
+		createRunErr error
+		want         int
+	}{
+		{
+			mappings: map[string]interface{}{"max-reruns": uint(1), "fail-fast": true},
+			want:     exitCodeValidationError,
+		},
+		{
+			mappings: map[string]interface{}{"timeout": "soon"},
+			want:     exitCodeValidationError,
+		},
+		{
+			mappings:     map[string]interface{}{"bg": true},
+			createRunErr: &rainforest.APIError{StatusCode: 502},
+			want:         exitCodeAPIError,
+		},
+		{
+			mappings:     map[string]interface{}{"bg": true},
+			createRunErr: &rainforest.APIError{StatusCode: 400},
+			want:         exitCodeValidationError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		r := runner{client: &fakeRunnerClient{createRunErr: testCase.createRunErr}}
+		err := r.startRun(newFakeContext(testCase.mappings, cli.Args{"all"}))
+		exitErr, ok := err.(*cli.ExitError)
+		if !ok || exitErr.ExitCode() != testCase.want {
+			t.Errorf("startRun with %v returned %v, want exit code %v", testCase.mappings, err, testCase.want)
+		}
+	}
+}
+
+func TestStartRun_PreRunUploadExitCodes(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	createValidFakeCSV(t)
+	defer deleteFakeCSV(t)
+	appPath := filepath.Join(t.TempDir(), "app.apk")
+	if err := ioutil.WriteFile(appPath, []byte("not really an app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(retries int) {
+		mobileUploadRetries = retries
+	}(mobileUploadRetries)
+	mobileUploadRetries = 0
+
+	// The API and S3 accept everything but adding tabular variable rows and the upload of
+	// the app file, which fail with a server error
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/generators", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			fmt.Fprint(w, `{"id": 2, "name": "testVar", "columns": [{"id": 3, "name": "test"}, {"id": 4, "name": "columns"}]}`)
+			return
+		}
+		fmt.Fprint(w, `[{"id": 1, "name": "testVar", "columns": [{"id": 5, "name": "test"}, {"id": 6, "name": "columns"}]}]`)
+	})
+	mux.HandleFunc("/generators/1/rows", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	for _, path := range []string{"/generators/1/rows/batch", "/generators/2/rows/batch", "/s3"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	}
+	mux.HandleFunc("/generators/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/uploads", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"url": "%v/s3", "url_fields": {"key": "app.apk"}, "rainforest_url": "rf://app.apk"}`, server.URL)
+	})
+
+	defer func(client *rainforest.Client) {
+		api = client
+	}(api)
+	api = rainforest.NewClient("token", false)
+	api.BaseURL, _ = url.Parse(server.URL + "/")
+
+	testCases := []map[string]interface{}{
+		{
+			"import-variable-csv-file":    fakeCSVPath,
+			"import-variable-name":        "testVar",
+			"import-variable-update-mode": tabularAppend,
+		},
+		{
+			"import-variable-csv-file": fakeCSVPath,
+			"import-variable-name":     "testVar",
+			"overwrite-variable":       true,
+		},
+		{
+			"mobile-app":     []string{appPath},
+			"site":           "1",
+			"environment-id": "2",
+		},
+	}
+
+	for _, mappings := range testCases {
+		mappings["bg"] = true
+		r := runner{client: &fakeRunnerClient{}}
+		err := r.startRun(newFakeContext(mappings, cli.Args{"all"}))
+		exitErr, ok := err.(*cli.ExitError)
+		if !ok || exitErr.ExitCode() != exitCodeAPIError {
+			t.Errorf("startRun with %v returned %v, want exit code %v", mappings, err, exitCodeAPIError)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+// junitTestSuites is a JUnit XML report. Reports with a single <testsuite> root element are
+// read into a single suite and written back the same way.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Attrs   []xml.Attr       `xml:",any,attr"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+
+	singleSuite bool
+}
+
+// junitTestSuite is a <testsuite> element of a JUnit XML report
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr,omitempty"`
+	Tests     string          `xml:"tests,attr,omitempty"`
+	Failures  string          `xml:"failures,attr,omitempty"`
+	Errors    string          `xml:"errors,attr,omitempty"`
+	Skipped   string          `xml:"skipped,attr,omitempty"`
+	Attrs     []xml.Attr      `xml:",any,attr"`
+	Other     []junitElement  `xml:",any"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a <testcase> element of a JUnit XML report
+type junitTestCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr,omitempty"`
+	Time      string       `xml:"time,attr,omitempty"`
+	Attrs     []xml.Attr   `xml:",any,attr"`
+	Failure   *junitResult `xml:"failure,omitempty"`
+	Error     *junitResult `xml:"error,omitempty"`
+	Skipped   *junitResult `xml:"skipped,omitempty"`
+	// Earlier attempts of a test which passed when it was rerun
+	FlakyFailures []junitRerunResult `xml:"flakyFailure"`
+	FlakyErrors   []junitRerunResult `xml:"flakyError"`
+	// Earlier attempts of a test which still failed when it was rerun
+	RerunFailures []junitRerunResult `xml:"rerunFailure"`
+	RerunErrors   []junitRerunResult `xml:"rerunError"`
+	Other         []junitElement     `xml:",any"`
+}
+
+// junitResult is the <failure>, <error> or <skipped> element of a test case
+type junitResult struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// junitRerunResult is a failed attempt of a rerun test case, following the convention of
+// the Maven Surefire plugin
+type junitRerunResult struct {
+	Message    string `xml:"message,attr,omitempty"`
+	Type       string `xml:"type,attr,omitempty"`
+	StackTrace string `xml:"stackTrace,omitempty"`
+}
+
+// junitElement keeps elements the CLI doesn't need to understand, e.g. <system-out>
+type junitElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// parseJunit parses a JUnit XML report with either a <testsuites> or a <testsuite> root
+func parseJunit(data []byte) (*junitTestSuites, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root, err := junitRoot(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.Name.Local == "testsuite" {
+		var suite junitTestSuite
+		if err := dec.DecodeElement(&suite, &root); err != nil {
+			return nil, err
+		}
+		return &junitTestSuites{Suites: []junitTestSuite{suite}, singleSuite: true}, nil
+	}
+
+	var report junitTestSuites
+	if err := dec.DecodeElement(&report, &root); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// junitRoot reads the root element of a JUnit XML report, which is either <testsuites> or
+// <testsuite>
+func junitRoot(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return xml.StartElement{}, errors.New("no root element")
+		}
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if start.Name.Local != "testsuites" && start.Name.Local != "testsuite" {
+				return start, fmt.Errorf("expected element type <testsuites> or <testsuite> but have <%v>", start.Name.Local)
+			}
+			return start, nil
+		}
+	}
+}
+
+// Marshal returns the report as an XML document
+func (r *junitTestSuites) Marshal() ([]byte, error) {
+	var v interface{} = r
+	if r.singleSuite && len(r.Suites) == 1 {
+		v = &r.Suites[0]
+	}
+
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// validateJunit checks the JUnit report of a run is well formed and, if the run is done, that
+// its test counts match the status of the run. The report is read as a stream, so it's never
+// held in memory.
+func validateJunit(r io.Reader, status *rainforest.RunStatus) error {
+	dec := xml.NewDecoder(r)
+	root, err := junitRoot(dec)
+	if err != nil {
+		return err
+	}
+
+	// Test suites are the root or children of <testsuites>, like in parseJunit. Only their
+	// test cases are counted.
+	suiteDepth := 0
+	if root.Name.Local == "testsuites" {
+		suiteDepth = 1
+	}
+	var suiteName, suiteTests string
+	var suiteCases, tests, passed int
+	var inSuite, inTestCase, testCaseResult bool
+	if root.Name.Local == "testsuite" {
+		suiteName, suiteTests, inSuite = junitAttr(root, "name"), junitAttr(root, "tests"), true
+	}
+
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch name := el.Name.Local; {
+			case depth == suiteDepth && name == "testsuite":
+				suiteName, suiteTests, suiteCases, inSuite = junitAttr(el, "name"), junitAttr(el, "tests"), 0, true
+			case depth == suiteDepth+1 && inSuite && name == "testcase":
+				if junitAttr(el, "name") == "" {
+					return errors.New("test case without a name")
+				}
+				suiteCases++
+				inTestCase, testCaseResult = true, false
+			case depth == suiteDepth+2 && inTestCase && (name == "failure" || name == "error" || name == "skipped"):
+				testCaseResult = true
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			switch {
+			case depth == suiteDepth+1 && inTestCase:
+				if !testCaseResult {
+					passed++
+				}
+				inTestCase = false
+			case depth == suiteDepth && inSuite:
+				if suiteTests != "" && suiteTests != strconv.Itoa(suiteCases) {
+					return fmt.Errorf("suite %q has %v tests but %v test cases", suiteName, suiteTests, suiteCases)
+				}
+				tests += suiteCases
+				inSuite = false
+			}
+		}
+	}
+
+	if status == nil || !status.StateDetails.IsFinalState || status.CurrentProgress.Total == 0 {
+		return nil
+	}
+	if progress := status.CurrentProgress; tests != progress.Total || passed != progress.Passed {
+		return fmt.Errorf("%v tests with %v passed don't match the %v tests with %v passed of the run",
+			tests, passed, progress.Total, progress.Passed)
+	}
+	return nil
+}
+
+// junitAttr returns the value of the named attribute of the element
+func junitAttr(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// key identifies the test case across the reports of reruns
+func (tc *junitTestCase) key() string {
+	return tc.ClassName + "\x00" + tc.Name
+}
+
+// withHistory returns the rerun of the test case, recording the failed attempts of the test
+// case as flaky failures if the rerun passed or as rerun failures if it didn't.
+func (tc junitTestCase) withHistory(rerun junitTestCase) junitTestCase {
+	failures := append(append([]junitRerunResult{}, tc.FlakyFailures...), tc.RerunFailures...)
+	errors := append(append([]junitRerunResult{}, tc.FlakyErrors...), tc.RerunErrors...)
+	if tc.Failure != nil {
+		failures = append(failures, junitRerunResult{tc.Failure.Message, tc.Failure.Type, tc.Failure.Text})
+	}
+	if tc.Error != nil {
+		errors = append(errors, junitRerunResult{tc.Error.Message, tc.Error.Type, tc.Error.Text})
+	}
+
+	if rerun.Failure != nil || rerun.Error != nil {
+		rerun.RerunFailures = append(failures, rerun.RerunFailures...)
+		rerun.RerunErrors = append(errors, rerun.RerunErrors...)
+	} else {
+		rerun.FlakyFailures = append(failures, rerun.FlakyFailures...)
+		rerun.FlakyErrors = append(errors, rerun.FlakyErrors...)
+	}
+	return rerun
+}
+
+// updateCounts sets the test, failure, error and skipped counts of the suites from their
+// test cases
+func (r *junitTestSuites) updateCounts() {
+	var tests, failures, errors, skipped int
+	for i := range r.Suites {
+		suite := &r.Suites[i]
+		var suiteFailures, suiteErrors, suiteSkipped int
+		for _, tc := range suite.TestCases {
+			switch {
+			case tc.Failure != nil:
+				suiteFailures++
+			case tc.Error != nil:
+				suiteErrors++
+			case tc.Skipped != nil:
+				suiteSkipped++
+			}
+		}
+		suite.Tests = strconv.Itoa(len(suite.TestCases))
+		suite.Failures = strconv.Itoa(suiteFailures)
+		suite.Errors = strconv.Itoa(suiteErrors)
+		if suite.Skipped != "" || suiteSkipped > 0 {
+			suite.Skipped = strconv.Itoa(suiteSkipped)
+		}
+
+		tests += len(suite.TestCases)
+		failures += suiteFailures
+		errors += suiteErrors
+		skipped += suiteSkipped
+	}
+
+	counts := map[string]int{"tests": tests, "failures": failures, "errors": errors, "skipped": skipped}
+	for i, attr := range r.Attrs {
+		if count, ok := counts[attr.Name.Local]; ok && attr.Name.Space == "" {
+			r.Attrs[i].Value = strconv.Itoa(count)
+		}
+	}
+}
+
+// mergeJunitReports merges the reports of a run and its reruns, in order, into the first
+// report. The outcome of each test case in the last report it's in wins. With history the
+// earlier failed attempts of the test cases are kept, see withHistory.
+func mergeJunitReports(reports []*junitTestSuites, history bool) *junitTestSuites {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	merged := reports[0]
+	for _, rerun := range reports[1:] {
+		latest := make(map[string]junitTestCase)
+		for _, suite := range rerun.Suites {
+			for _, tc := range suite.TestCases {
+				latest[tc.key()] = tc
+			}
+		}
+
+		for i := range merged.Suites {
+			for j, tc := range merged.Suites[i].TestCases {
+				if rerunTC, ok := latest[tc.key()]; ok {
+					if history {
+						rerunTC = tc.withHistory(rerunTC)
+					}
+					merged.Suites[i].TestCases[j] = rerunTC
+					delete(latest, tc.key())
+				}
+			}
+		}
+
+		// Tests which weren't in the earlier reports are added to the first suite
+		for _, suite := range rerun.Suites {
+			for _, tc := range suite.TestCases {
+				if _, ok := latest[tc.key()]; !ok {
+					continue
+				}
+				if len(merged.Suites) == 0 {
+					merged.Suites = append(merged.Suites, junitTestSuite{Name: suite.Name})
+				}
+				merged.Suites[0].TestCases = append(merged.Suites[0].TestCases, tc)
+				delete(latest, tc.key())
+			}
+		}
+	}
+
+	merged.updateCounts()
+	return merged
+}
+
+// mergeJunitFiles merges the JUnit XML reports of a run and its reruns, see mergeJunitReports
+func mergeJunitFiles(documents [][]byte, history bool) ([]byte, error) {
+	reports := make([]*junitTestSuites, len(documents))
+	for i, document := range documents {
+		report, err := parseJunit(bytes.TrimSpace(document))
+		if err != nil {
+			return nil, err
+		}
+		reports[i] = report
+	}
+
+	return mergeJunitReports(reports, history).Marshal()
+}
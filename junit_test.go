@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+func TestMergeJunitFiles(t *testing.T) {
+	run := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="Run 1" tests="2" failures="1">
+  <testsuite name="Chrome" tests="2" failures="1" timestamp="2020-01-01T00:00:00">
+    <properties><property name="browser" value="chrome"/></properties>
+    <testcase name="Login" classname="Auth" time="12"><failure message="Step 2 failed">details</failure></testcase>
+    <testcase name="Logout" classname="Auth" time="3"><system-out>ok</system-out></testcase>
+  </testsuite>
+</testsuites>`
+	rerun := `<testsuites name="Run 2" tests="1" failures="0">
+  <testsuite name="Chrome" tests="1" failures="0">
+    <testcase name="Login" classname="Auth" time="10"></testcase>
+  </testsuite>
+</testsuites>`
+
+	merged, err := mergeJunitFiles([][]byte{[]byte(run), []byte(rerun)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := parseJunit(merged)
+	if err != nil {
+		t.Fatalf("Merged report isn't valid: %v\n%s", err, merged)
+	}
+	if report.singleSuite || len(report.Suites) != 1 {
+		t.Fatalf("Expected a <testsuites> report with one suite, got:\n%s", merged)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != "2" || suite.Failures != "0" || suite.TestCases[0].Failure != nil || suite.TestCases[0].Time != "10" {
+		t.Errorf("Expected the rerun outcome to win, got:\n%s", merged)
+	}
+	for _, want := range []string{`<testsuites name="Run 1" tests="2" failures="0">`, `timestamp="2020-01-01T00:00:00"`,
+		`<property name="browser" value="chrome"/>`, `<system-out>ok</system-out>`} {
+		if !strings.Contains(string(merged), want) {
+			t.Errorf("Expected the merged report to contain %v, got:\n%s", want, merged)
+		}
+	}
+}
+
+func TestMergeJunitFiles_History(t *testing.T) {
+	run := `<testsuite name="Run 1">
+  <testcase name="Flaky"><failure message="Step 1 failed" type="failed">first</failure></testcase>
+  <testcase name="Broken"><error message="Timed out">first</error></testcase>
+  <testcase name="Stable"></testcase>
+</testsuite>`
+	rerun := `<testsuite name="Run 2">
+  <testcase name="Flaky"><failure message="Step 3 failed">second</failure></testcase>
+  <testcase name="Broken"><failure message="Step 1 failed">second</failure></testcase>
+</testsuite>`
+	lastRerun := `<testsuite name="Run 3">
+  <testcase name="Flaky"></testcase>
+  <testcase name="Broken"><failure message="Step 2 failed">third</failure></testcase>
+</testsuite>`
+
+	merged, err := mergeJunitFiles([][]byte{[]byte(run), []byte(rerun), []byte(lastRerun)}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := parseJunit(merged)
+	if err != nil {
+		t.Fatalf("Merged report isn't valid: %v\n%s", err, merged)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != "3" || suite.Failures != "1" || suite.Errors != "0" {
+		t.Errorf("Unexpected counts in the merged report:\n%s", merged)
+	}
+
+	flaky := suite.TestCases[0]
+	wantFlaky := []junitRerunResult{{"Step 1 failed", "failed", "first"}, {"Step 3 failed", "", "second"}}
+	if flaky.Failure != nil || !reflect.DeepEqual(flaky.FlakyFailures, wantFlaky) || len(flaky.RerunFailures) != 0 {
+		t.Errorf("Expected the failed attempts of the flaky test as flaky failures, got %+v", flaky)
+	}
+
+	broken := suite.TestCases[1]
+	wantRerun := []junitRerunResult{{"Step 1 failed", "", "second"}}
+	wantRerunErrors := []junitRerunResult{{"Timed out", "", "first"}}
+	if broken.Failure == nil || broken.Failure.Message != "Step 2 failed" ||
+		!reflect.DeepEqual(broken.RerunFailures, wantRerun) || !reflect.DeepEqual(broken.RerunErrors, wantRerunErrors) {
+		t.Errorf("Expected the earlier attempts of the failing test as rerun failures, got %+v", broken)
+	}
+
+	for _, want := range []string{`<flakyFailure message="Step 1 failed" type="failed">`, `<stackTrace>first</stackTrace>`,
+		`<rerunFailure message="Step 1 failed">`, `<rerunError message="Timed out">`} {
+		if !strings.Contains(string(merged), want) {
+			t.Errorf("Expected the merged report to contain %v, got:\n%s", want, merged)
+		}
+	}
+}
+
+func TestValidateJunit(t *testing.T) {
+	status := &rainforest.RunStatus{}
+	status.StateDetails.IsFinalState = true
+	status.CurrentProgress.Total = 3
+	status.CurrentProgress.Passed = 1
+
+	valid := []string{
+		`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3">
+  <properties><property name="run" value="1"/></properties>
+  <testsuite name="Chrome" tests="2">
+    <properties><testcase name="not a test case"/></properties>
+    <testcase name="Login"><system-out>ok</system-out></testcase>
+    <testcase name="Logout"><failure message="oops"><error/></failure></testcase>
+  </testsuite>
+  <testsuite name="Firefox"><testcase name="Login"><skipped/></testcase></testsuite>
+</testsuites>`,
+		`<testsuite name="Run 1" tests="3"><testcase name="A"/><testcase name="B"><error/></testcase><testcase name="C"><failure/></testcase></testsuite>`,
+	}
+	for _, report := range valid {
+		if err := validateJunit(strings.NewReader(report), status); err != nil {
+			t.Errorf("Unexpected error for %v: %v", report, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`<testrun><testcase name="A"/></testrun>`,
+		`<testsuite name="Run 1" tests="2"><testcase name="A"/></testsuite>`,
+		`<testsuite name="Run 1"><testcase/></testsuite>`,
+		`<testsuite name="Run 1"><testcase name="A"/></testsuite>`,
+		`<testsuites><testsuite name="Run 1"><testcase name="A"/>`,
+	}
+	for _, report := range invalid {
+		if err := validateJunit(strings.NewReader(report), status); err == nil {
+			t.Errorf("Expected an error for %v", report)
+		}
+	}
+}
@@ -0,0 +1,815 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// mobileAppInfo is the metadata of a mobile app read from its archive
+type mobileAppInfo struct {
+	BundleID      string
+	VersionName   string
+	VersionCode   string
+	MinOS         string
+	Architectures []string
+}
+
+// String returns a short description of the app
+func (info *mobileAppInfo) String() string {
+	archs := "any"
+	if len(info.Architectures) > 0 {
+		archs = strings.Join(info.Architectures, ", ")
+	}
+	return fmt.Sprintf("bundle ID %v, version %v (%v), minimum OS %v, architectures %v",
+		info.BundleID, info.VersionName, info.VersionCode, info.MinOS, archs)
+}
+
+// inspectMobileApp reads the metadata of .apk, .aab and .ipa files. It returns nil for
+// other kinds of files, which can't be inspected.
+func inspectMobileApp(filePath string) (*mobileAppInfo, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext != ".apk" && ext != ".aab" && ext != ".ipa" {
+		return nil, nil
+	}
+
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open %v: %v", filePath, err)
+	}
+	defer archive.Close()
+
+	var info *mobileAppInfo
+	switch ext {
+	case ".apk":
+		info, err = inspectAndroidApp(&archive.Reader, "AndroidManifest.xml", "lib/", parseBinaryXMLManifest)
+	case ".aab":
+		info, err = inspectAndroidApp(&archive.Reader, "base/manifest/AndroidManifest.xml", "base/lib/", parseProtoXMLManifest)
+	case ".ipa":
+		info, err = inspectIOSApp(&archive.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read app metadata from %v: %v", filePath, err)
+	}
+	return info, nil
+}
+
+// findZipFile returns the file with the given name in the archive or nil
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// readZipFile reads up to limit bytes of the file in the archive
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(io.LimitReader(rc, limit))
+}
+
+// maxManifestSize limits the size of manifests read from app archives
+const maxManifestSize = 16 << 20
+
+// inspectAndroidApp reads the manifest and the ABIs of native libraries in libDir of an
+// APK or an app bundle
+func inspectAndroidApp(archive *zip.Reader, manifestName, libDir string,
+	parse func([]byte) (map[string]map[string]string, error)) (*mobileAppInfo, error) {
+	f := findZipFile(archive, manifestName)
+	if f == nil {
+		return nil, fmt.Errorf("%v not found", manifestName)
+	}
+	data, err := readZipFile(f, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", manifestName, err)
+	}
+
+	manifest := elements["manifest"]
+	info := &mobileAppInfo{
+		BundleID:    manifest["package"],
+		VersionName: manifest["versionName"],
+		VersionCode: manifest["versionCode"],
+	}
+	if minSdk := elements["uses-sdk"]["minSdkVersion"]; minSdk != "" {
+		info.MinOS = "Android API " + minSdk
+	}
+
+	abis := make(map[string]bool)
+	for _, f := range archive.File {
+		if !strings.HasPrefix(f.Name, libDir) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(f.Name, libDir), "/")
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			abis[parts[0]] = true
+		}
+	}
+	for abi := range abis {
+		info.Architectures = append(info.Architectures, abi)
+	}
+	sort.Strings(info.Architectures)
+
+	return info, nil
+}
+
+// Android attribute resource IDs, used when attribute names are stripped from the manifest
+var androidAttributeIDs = map[uint32]string{
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+}
+
+// Chunk types of Android binary XML
+const (
+	axmlStringPool   = 0x0001
+	axmlResourceMap  = 0x0180
+	axmlStartElement = 0x0102
+)
+
+// parseBinaryXMLManifest reads the attributes of the manifest and uses-sdk elements from
+// an AndroidManifest.xml compiled to Android binary XML
+func parseBinaryXMLManifest(data []byte) (map[string]map[string]string, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != 0x0003 {
+		return nil, errors.New("not an Android binary XML file")
+	}
+
+	elements := make(map[string]map[string]string)
+	var pool []string
+	var resourceIDs []uint32
+	offset := int(binary.LittleEndian.Uint16(data[2:]))
+	for offset+8 <= len(data) {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		headerSize := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > len(data) {
+			return nil, errors.New("truncated chunk")
+		}
+		chunk := data[offset : offset+chunkSize]
+
+		switch chunkType {
+		case axmlStringPool:
+			var err error
+			if pool, err = parseAXMLStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case axmlResourceMap:
+			for i := headerSize; i+4 <= len(chunk); i += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case axmlStartElement:
+			name, attrs, err := parseAXMLElement(chunk, headerSize, pool, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+			if (name == "manifest" || name == "uses-sdk") && elements[name] == nil {
+				elements[name] = attrs
+			}
+		}
+		offset += chunkSize
+	}
+
+	if elements["manifest"] == nil {
+		return nil, errors.New("manifest element not found")
+	}
+	return elements, nil
+}
+
+// parseAXMLStringPool reads the strings of a string pool chunk
+func parseAXMLStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("truncated string pool")
+	}
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	isUTF8 := binary.LittleEndian.Uint32(chunk[16:])&(1<<8) != 0
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	if headerSize+count*4 > len(chunk) {
+		return nil, errors.New("truncated string pool")
+	}
+
+	pool := make([]string, count)
+	for i := range pool {
+		start := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+i*4:]))
+		if start >= len(chunk) {
+			return nil, errors.New("string out of bounds")
+		}
+		var err error
+		if isUTF8 {
+			pool[i], err = decodeAXMLUTF8(chunk[start:])
+		} else {
+			pool[i], err = decodeAXMLUTF16(chunk[start:])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+// decodeAXMLUTF8 decodes a string pool string in UTF-8. It's prefixed with its length in
+// UTF-16 and in UTF-8, each encoded in one or two bytes.
+func decodeAXMLUTF8(data []byte) (string, error) {
+	pos := 0
+	var length int
+	for i := 0; i < 2; i++ {
+		if pos >= len(data) {
+			return "", errors.New("string out of bounds")
+		}
+		length = int(data[pos])
+		pos++
+		if length&0x80 != 0 {
+			if pos >= len(data) {
+				return "", errors.New("string out of bounds")
+			}
+			length = (length&0x7f)<<8 | int(data[pos])
+			pos++
+		}
+	}
+	if pos+length > len(data) {
+		return "", errors.New("string out of bounds")
+	}
+	return string(data[pos : pos+length]), nil
+}
+
+// decodeAXMLUTF16 decodes a string pool string in UTF-16, prefixed with its length in one
+// or two 16 bit units
+func decodeAXMLUTF16(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", errors.New("string out of bounds")
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	pos := 2
+	if length&0x8000 != 0 {
+		if len(data) < 4 {
+			return "", errors.New("string out of bounds")
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(data[2:]))
+		pos = 4
+	}
+	if pos+length*2 > len(data) {
+		return "", errors.New("string out of bounds")
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[pos+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// parseAXMLElement reads the name and attributes of a start element chunk
+func parseAXMLElement(chunk []byte, headerSize int, pool []string, resourceIDs []uint32) (string, map[string]string, error) {
+	if headerSize+20 > len(chunk) {
+		return "", nil, errors.New("truncated element")
+	}
+	ext := chunk[headerSize:]
+	str := func(index uint32) string {
+		if int(index) < len(pool) {
+			return pool[index]
+		}
+		return ""
+	}
+
+	name := str(binary.LittleEndian.Uint32(ext[4:]))
+	attrStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attrSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attrCount := int(binary.LittleEndian.Uint16(ext[12:]))
+	if attrSize < 20 || attrStart+attrCount*attrSize > len(ext) {
+		return "", nil, errors.New("truncated attributes")
+	}
+
+	attrs := make(map[string]string)
+	for i := 0; i < attrCount; i++ {
+		attr := ext[attrStart+i*attrSize:]
+		nameIndex := binary.LittleEndian.Uint32(attr[4:])
+		attrName := str(nameIndex)
+		if int(nameIndex) < len(resourceIDs) {
+			if known, ok := androidAttributeIDs[resourceIDs[nameIndex]]; ok {
+				attrName = known
+			}
+		}
+
+		var value string
+		rawValue := binary.LittleEndian.Uint32(attr[8:])
+		dataType := attr[15]
+		data := binary.LittleEndian.Uint32(attr[16:])
+		switch {
+		case rawValue != 0xffffffff:
+			value = str(rawValue)
+		case dataType == 0x03:
+			value = str(data)
+		case dataType == 0x10:
+			value = strconv.Itoa(int(int32(data)))
+		case dataType == 0x11:
+			value = fmt.Sprintf("0x%x", data)
+		case dataType == 0x12:
+			value = strconv.FormatBool(data != 0)
+		case dataType == 0x01:
+			value = fmt.Sprintf("@0x%08x", data)
+		}
+		attrs[attrName] = value
+	}
+	return name, attrs, nil
+}
+
+// parseProtoXMLManifest reads the attributes of the manifest and uses-sdk elements from
+// an AndroidManifest.xml compiled to the protobuf format used in app bundles
+func parseProtoXMLManifest(data []byte) (map[string]map[string]string, error) {
+	elements := make(map[string]map[string]string)
+	if err := parseProtoXMLNode(data, elements, 0); err != nil {
+		return nil, err
+	}
+	if elements["manifest"] == nil {
+		return nil, errors.New("manifest element not found")
+	}
+	return elements, nil
+}
+
+// maxProtoXMLDepth limits nesting of elements in protobuf manifests
+const maxProtoXMLDepth = 64
+
+// parseProtoXMLNode reads an XmlNode message, collecting attributes of elements
+func parseProtoXMLNode(data []byte, elements map[string]map[string]string, depth int) error {
+	if depth > maxProtoXMLDepth {
+		return errors.New("elements nested too deep")
+	}
+	return readProtoFields(data, func(field int, value []byte, _ uint64) error {
+		if field != 1 {
+			return nil
+		}
+
+		// XmlElement
+		var name string
+		attrs := make(map[string]string)
+		var children [][]byte
+		err := readProtoFields(value, func(field int, value []byte, _ uint64) error {
+			switch field {
+			case 3:
+				name = string(value)
+			case 4:
+				attrName, attrValue, err := parseProtoXMLAttribute(value)
+				if err != nil {
+					return err
+				}
+				attrs[attrName] = attrValue
+			case 5:
+				children = append(children, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if (name == "manifest" || name == "uses-sdk") && elements[name] == nil {
+			elements[name] = attrs
+		}
+		for _, child := range children {
+			if err = parseProtoXMLNode(child, elements, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// parseProtoXMLAttribute reads the name and value of an XmlAttribute message. Values are
+// kept as strings, compiled integers are used if there's none.
+func parseProtoXMLAttribute(data []byte) (string, string, error) {
+	var name, value, compiled string
+	err := readProtoFields(data, func(field int, fieldValue []byte, _ uint64) error {
+		switch field {
+		case 2:
+			name = string(fieldValue)
+		case 3:
+			value = string(fieldValue)
+		case 6:
+			// Item.prim.int_decimal_value
+			return readProtoFields(fieldValue, func(field int, fieldValue []byte, _ uint64) error {
+				if field != 7 {
+					return nil
+				}
+				return readProtoFields(fieldValue, func(field int, _ []byte, number uint64) error {
+					if field == 6 {
+						compiled = strconv.Itoa(int(int32(number)))
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	if value == "" {
+		value = compiled
+	}
+	return name, value, err
+}
+
+// readProtoFields calls fn for each field of a protobuf message with the bytes of
+// length-delimited fields or the number of other fields
+func readProtoFields(data []byte, fn func(field int, value []byte, number uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid protobuf field")
+		}
+		data = data[n:]
+
+		field := int(key >> 3)
+		var value []byte
+		var number uint64
+		switch key & 7 {
+		case 0:
+			number, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errors.New("truncated protobuf field")
+			}
+			number = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errors.New("truncated protobuf field")
+			}
+			value = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return errors.New("truncated protobuf field")
+			}
+			number = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return errors.New("unsupported protobuf wire type")
+		}
+
+		if err := fn(field, value, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inspectIOSApp reads Info.plist and the executable's architectures of an IPA
+func inspectIOSApp(archive *zip.Reader) (*mobileAppInfo, error) {
+	var plistFile *zip.File
+	for _, f := range archive.File {
+		dir, name := path.Split(f.Name)
+		if name == "Info.plist" && strings.HasPrefix(dir, "Payload/") &&
+			strings.Count(dir, "/") == 2 && strings.HasSuffix(dir, ".app/") {
+			plistFile = f
+			break
+		}
+	}
+	if plistFile == nil {
+		return nil, errors.New("Payload/*.app/Info.plist not found")
+	}
+
+	data, err := readZipFile(plistFile, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	plist, err := parsePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Info.plist: %v", err)
+	}
+
+	str := func(key string) string {
+		s, _ := plist[key].(string)
+		return s
+	}
+	info := &mobileAppInfo{
+		BundleID:    str("CFBundleIdentifier"),
+		VersionName: str("CFBundleShortVersionString"),
+		VersionCode: str("CFBundleVersion"),
+	}
+	if minOS := str("MinimumOSVersion"); minOS != "" {
+		info.MinOS = "iOS " + minOS
+	}
+
+	if executable := str("CFBundleExecutable"); executable != "" {
+		dir, _ := path.Split(plistFile.Name)
+		if f := findZipFile(archive, dir+executable); f != nil {
+			header, err := readZipFile(f, 4096)
+			if err != nil {
+				return nil, err
+			}
+			info.Architectures = machOArchitectures(header)
+		}
+	}
+
+	return info, nil
+}
+
+// parsePlist reads the top level dictionary of an XML or binary property list
+func parsePlist(data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	var err error
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		value, err = parseBinaryPlist(data)
+	} else {
+		value, err = parseXMLPlist(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("top level object isn't a dictionary")
+	}
+	return dict, nil
+}
+
+// parseXMLPlist reads the top level object of an XML property list
+func parseXMLPlist(data []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return parseXMLPlistValue(dec, start)
+		}
+	}
+}
+
+// parseXMLPlistValue reads the value of the element which has just started
+func parseXMLPlistValue(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		var key string
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				if tok.Name.Local == "key" {
+					if err = dec.DecodeElement(&key, &tok); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := parseXMLPlistValue(dec, tok)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				value, err := parseXMLPlistValue(dec, tok)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		return start.Name.Local == "true", dec.Skip()
+	default:
+		var text string
+		err := dec.DecodeElement(&text, &start)
+		return text, err
+	}
+}
+
+// binaryPlist holds a binary property list being decoded
+type binaryPlist struct {
+	data          []byte
+	offsets       []uint64
+	objectRefSize int
+}
+
+// maxPlistDepth limits nesting of containers in binary property lists
+const maxPlistDepth = 64
+
+// parseBinaryPlist reads the top level object of a binary property list
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < 40 {
+		return nil, errors.New("truncated binary plist")
+	}
+	trailer := data[len(data)-32:]
+	offsetIntSize := int(trailer[6])
+	p := &binaryPlist{data: data, objectRefSize: int(trailer[7])}
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	offsetTable := binary.BigEndian.Uint64(trailer[24:])
+
+	// numObjects is checked before the size of the offset table is computed and the offset
+	// table before the space left after it, so neither can overflow
+	if offsetIntSize < 1 || offsetIntSize > 8 || p.objectRefSize < 1 || p.objectRefSize > 8 ||
+		numObjects > uint64(len(data)) || offsetTable > uint64(len(data)) ||
+		numObjects*uint64(offsetIntSize) > uint64(len(data))-offsetTable {
+		return nil, errors.New("invalid binary plist trailer")
+	}
+	p.offsets = make([]uint64, numObjects)
+	for i := range p.offsets {
+		start := int(offsetTable) + i*offsetIntSize
+		p.offsets[i] = readBigEndian(data[start : start+offsetIntSize])
+	}
+	return p.object(topObject, 0)
+}
+
+// readBigEndian reads an unsigned integer of up to 8 bytes
+func readBigEndian(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// object decodes the object with the given reference. Only the types found in Info.plist
+// are decoded, others are returned as nil.
+func (p *binaryPlist) object(ref uint64, depth int) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) || p.offsets[ref] >= uint64(len(p.data)) {
+		return nil, errors.New("object reference out of bounds")
+	}
+	if depth > maxPlistDepth {
+		return nil, errors.New("objects nested too deep")
+	}
+	pos := int(p.offsets[ref])
+	marker := p.data[pos]
+	pos++
+
+	// Length of data, strings and containers, larger lengths follow as an integer object
+	length := int(marker & 0x0f)
+	switch marker >> 4 {
+	case 0x4, 0x5, 0x6, 0xa, 0xd:
+	default:
+		length = 0
+	}
+	if length == 0x0f {
+		if pos >= len(p.data) || p.data[pos]>>4 != 0x1 {
+			return nil, errors.New("invalid object length")
+		}
+		size := 1 << (p.data[pos] & 0x0f)
+		if pos+1+size > len(p.data) {
+			return nil, errors.New("object out of bounds")
+		}
+		n := readBigEndian(p.data[pos+1 : pos+1+size])
+		if n > uint64(len(p.data)) {
+			return nil, errors.New("object out of bounds")
+		}
+		length = int(n)
+		pos += 1 + size
+	}
+
+	switch marker >> 4 {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		size := 1 << (marker & 0x0f)
+		if pos+size > len(p.data) {
+			return nil, errors.New("object out of bounds")
+		}
+		return int64(readBigEndian(p.data[pos : pos+size])), nil
+	case 0x5:
+		if pos+length > len(p.data) {
+			return nil, errors.New("object out of bounds")
+		}
+		return string(p.data[pos : pos+length]), nil
+	case 0x6:
+		if pos+length*2 > len(p.data) {
+			return nil, errors.New("object out of bounds")
+		}
+		units := make([]uint16, length)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(p.data[pos+i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xa:
+		refs, err := p.refs(pos, length)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, len(refs))
+		for i, ref := range refs {
+			if array[i], err = p.object(ref, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case 0xd:
+		refs, err := p.refs(pos, length*2)
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{}, length)
+		for i := 0; i < length; i++ {
+			key, err := p.object(refs[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, errors.New("dictionary key isn't a string")
+			}
+			if dict[keyStr], err = p.object(refs[length+i], depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, nil
+}
+
+// refs reads count object references starting at pos
+func (p *binaryPlist) refs(pos, count int) ([]uint64, error) {
+	if pos+count*p.objectRefSize > len(p.data) {
+		return nil, errors.New("object out of bounds")
+	}
+	refs := make([]uint64, count)
+	for i := range refs {
+		start := pos + i*p.objectRefSize
+		refs[i] = readBigEndian(p.data[start : start+p.objectRefSize])
+	}
+	return refs, nil
+}
+
+// machOArchitectures returns the architectures of a Mach-O executable or universal binary
+// from the start of the file
+func machOArchitectures(header []byte) []string {
+	if len(header) < 8 {
+		return nil
+	}
+
+	var cpus []macho.Cpu
+	switch binary.BigEndian.Uint32(header) {
+	case macho.MagicFat:
+		count := int(binary.BigEndian.Uint32(header[4:]))
+		for i := 0; i < count && 8+(i+1)*20 <= len(header); i++ {
+			cpus = append(cpus, macho.Cpu(binary.BigEndian.Uint32(header[8+i*20:])))
+		}
+	default:
+		switch binary.LittleEndian.Uint32(header) {
+		case macho.Magic32, macho.Magic64:
+			cpus = append(cpus, macho.Cpu(binary.LittleEndian.Uint32(header[4:])))
+		}
+	}
+
+	var archs []string
+	for _, cpu := range cpus {
+		switch cpu {
+		case macho.Cpu386:
+			archs = append(archs, "i386")
+		case macho.CpuAmd64:
+			archs = append(archs, "x86_64")
+		case macho.CpuArm:
+			archs = append(archs, "armv7")
+		case macho.CpuArm64:
+			archs = append(archs, "arm64")
+		default:
+			archs = append(archs, fmt.Sprintf("cpu %d", cpu))
+		}
+	}
+	return archs
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// axmlAttr is an attribute of an element in a test binary XML manifest
+type axmlAttr struct {
+	name  string
+	resID uint32
+	str   string
+	num   int32
+}
+
+// axmlElement is an element in a test binary XML manifest
+type axmlElement struct {
+	name  string
+	attrs []axmlAttr
+}
+
+// buildBinaryXML encodes elements as Android binary XML, with a UTF-16 string pool and a
+// resource map for attributes with resource IDs
+func buildBinaryXML(elements []axmlElement) []byte {
+	var pool []string
+	var resIDs []uint32
+	index := make(map[string]uint32)
+	add := func(s string) uint32 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = uint32(len(pool))
+		pool = append(pool, s)
+		return index[s]
+	}
+	for _, el := range elements {
+		for _, attr := range el.attrs {
+			if attr.resID != 0 {
+				add(attr.name)
+				resIDs = append(resIDs, attr.resID)
+			}
+		}
+	}
+	for _, el := range elements {
+		add(el.name)
+		for _, attr := range el.attrs {
+			add(attr.name)
+			if attr.str != "" {
+				add(attr.str)
+			}
+		}
+	}
+
+	le := binary.LittleEndian
+	var strs bytes.Buffer
+	offsets := make([]byte, 4*len(pool))
+	for i, s := range pool {
+		le.PutUint32(offsets[i*4:], uint32(strs.Len()))
+		units := utf16.Encode([]rune(s))
+		binary.Write(&strs, le, uint16(len(units)))
+		binary.Write(&strs, le, units)
+		binary.Write(&strs, le, uint16(0))
+	}
+	for strs.Len()%4 != 0 {
+		strs.WriteByte(0)
+	}
+	poolHeader := make([]byte, 28)
+	le.PutUint16(poolHeader, 0x0001)
+	le.PutUint16(poolHeader[2:], 28)
+	le.PutUint32(poolHeader[4:], uint32(28+len(offsets)+strs.Len()))
+	le.PutUint32(poolHeader[8:], uint32(len(pool)))
+	le.PutUint32(poolHeader[20:], uint32(28+len(offsets)))
+
+	var body bytes.Buffer
+	body.Write(poolHeader)
+	body.Write(offsets)
+	body.Write(strs.Bytes())
+
+	resMap := make([]byte, 8+4*len(resIDs))
+	le.PutUint16(resMap, 0x0180)
+	le.PutUint16(resMap[2:], 8)
+	le.PutUint32(resMap[4:], uint32(len(resMap)))
+	for i, id := range resIDs {
+		le.PutUint32(resMap[8+i*4:], id)
+	}
+	body.Write(resMap)
+
+	for _, el := range elements {
+		chunk := make([]byte, 36+20*len(el.attrs))
+		le.PutUint16(chunk, 0x0102)
+		le.PutUint16(chunk[2:], 16)
+		le.PutUint32(chunk[4:], uint32(len(chunk)))
+		le.PutUint32(chunk[12:], 0xffffffff)
+		le.PutUint32(chunk[16:], 0xffffffff)
+		le.PutUint32(chunk[20:], index[el.name])
+		le.PutUint16(chunk[24:], 20)
+		le.PutUint16(chunk[26:], 20)
+		le.PutUint16(chunk[28:], uint16(len(el.attrs)))
+		for i, attr := range el.attrs {
+			a := chunk[36+20*i:]
+			le.PutUint32(a, 0xffffffff)
+			le.PutUint32(a[4:], index[attr.name])
+			le.PutUint16(a[12:], 8)
+			if attr.str != "" {
+				le.PutUint32(a[8:], index[attr.str])
+				a[15] = 0x03
+				le.PutUint32(a[16:], index[attr.str])
+			} else {
+				le.PutUint32(a[8:], 0xffffffff)
+				a[15] = 0x10
+				le.PutUint32(a[16:], uint32(attr.num))
+			}
+		}
+		body.Write(chunk)
+	}
+
+	header := make([]byte, 8)
+	le.PutUint16(header, 0x0003)
+	le.PutUint16(header[2:], 8)
+	le.PutUint32(header[4:], uint32(8+body.Len()))
+	return append(header, body.Bytes()...)
+}
+
+// protoField encodes a length-delimited protobuf field
+func protoField(field int, value []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// protoVarint encodes a varint protobuf field
+func protoVarint(field int, value uint64) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3))
+	return binary.AppendUvarint(buf, value)
+}
+
+// protoElement encodes an XmlNode with an element with the given attributes and children
+func protoElement(name string, attrs [][]byte, children ...[]byte) []byte {
+	element := protoField(3, []byte(name))
+	for _, attr := range attrs {
+		element = append(element, protoField(4, attr)...)
+	}
+	for _, child := range children {
+		element = append(element, protoField(5, child)...)
+	}
+	return protoField(1, element)
+}
+
+// protoAttr encodes an XmlAttribute with a string value
+func protoAttr(name, value string) []byte {
+	return append(protoField(2, []byte(name)), protoField(3, []byte(value))...)
+}
+
+// buildBinaryPlist encodes a dictionary of strings as a binary property list
+func buildBinaryPlist(dict map[string]string) []byte {
+	var keys, values []string
+	for k, v := range dict {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	objects := append(append([]string{}, keys...), values...)
+
+	var buf bytes.Buffer
+	buf.WriteString("bplist00")
+	offsets := []int{buf.Len()}
+	buf.WriteByte(0xd0 | byte(len(keys)))
+	for i := range objects {
+		buf.WriteByte(byte(i + 1))
+	}
+	for _, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		if len(obj) < 15 {
+			buf.WriteByte(0x50 | byte(len(obj)))
+		} else {
+			buf.WriteByte(0x5f)
+			buf.WriteByte(0x10)
+			buf.WriteByte(byte(len(obj)))
+		}
+		buf.WriteString(obj)
+	}
+	offsetTable := buf.Len()
+	for _, offset := range offsets {
+		binary.Write(&buf, binary.BigEndian, uint16(offset))
+	}
+	trailer := make([]byte, 32)
+	trailer[6] = 2
+	trailer[7] = 1
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(offsets)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTable))
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+// writeTestZip writes the files into a zip archive in dir
+func writeTestZip(t *testing.T, dir, name string, files map[string][]byte) string {
+	filePath := filepath.Join(dir, name)
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for fileName, content := range files {
+		fw, err := w.Create(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestInspectMobileApp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mobile-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := buildBinaryXML([]axmlElement{
+		{name: "manifest", attrs: []axmlAttr{
+			{name: "versionCode", resID: 0x0101021b, num: 42},
+			{name: "versionName", resID: 0x0101021c, str: "1.4.2"},
+			{name: "package", str: "com.example.app"},
+		}},
+		{name: "uses-sdk", attrs: []axmlAttr{
+			// Stripped attribute name, resolved through the resource map
+			{name: "", resID: 0x0101020c, num: 21},
+		}},
+	})
+	apk := writeTestZip(t, dir, "app.apk", map[string][]byte{
+		"AndroidManifest.xml":          manifest,
+		"lib/arm64-v8a/libnative.so":   {},
+		"lib/armeabi-v7a/libnative.so": {},
+		"lib/arm64-v8a/libother.so":    {},
+		"classes.dex":                  {},
+	})
+
+	aab := writeTestZip(t, dir, "app.aab", map[string][]byte{
+		"base/manifest/AndroidManifest.xml": protoElement("manifest", [][]byte{
+			protoAttr("package", "com.example.bundle"),
+			protoAttr("versionName", "2.0"),
+			// Compiled integer without a string value
+			append(protoField(2, []byte("versionCode")), protoField(6, protoField(7, protoVarint(6, 7)))...),
+		}, protoElement("uses-sdk", [][]byte{protoAttr("minSdkVersion", "24")})),
+		"base/lib/x86_64/libnative.so": {},
+	})
+
+	fatHeader := make([]byte, 48)
+	binary.BigEndian.PutUint32(fatHeader, 0xcafebabe)
+	binary.BigEndian.PutUint32(fatHeader[4:], 2)
+	binary.BigEndian.PutUint32(fatHeader[8:], 12)
+	binary.BigEndian.PutUint32(fatHeader[28:], 0x0100000c)
+	ipa := writeTestZip(t, dir, "app.ipa", map[string][]byte{
+		"Payload/Example.app/Info.plist": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>Example</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.ios</string>
+	<key>CFBundleShortVersionString</key>
+	<string>3.1</string>
+	<key>CFBundleVersion</key>
+	<string>310</string>
+	<key>MinimumOSVersion</key>
+	<string>13.0</string>
+	<key>UIRequiresFullScreen</key>
+	<true/>
+	<key>UISupportedInterfaceOrientations</key>
+	<array>
+		<string>UIInterfaceOrientationPortrait</string>
+	</array>
+</dict>
+</plist>`),
+		"Payload/Example.app/Example":                           fatHeader,
+		"Payload/Example.app/Frameworks/A.framework/Info.plist": []byte("not a plist"),
+	})
+
+	testCases := []struct {
+		path     string
+		expected *mobileAppInfo
+	}{
+		{
+			path: apk,
+			expected: &mobileAppInfo{
+				BundleID:      "com.example.app",
+				VersionName:   "1.4.2",
+				VersionCode:   "42",
+				MinOS:         "Android API 21",
+				Architectures: []string{"arm64-v8a", "armeabi-v7a"},
+			},
+		},
+		{
+			path: aab,
+			expected: &mobileAppInfo{
+				BundleID:      "com.example.bundle",
+				VersionName:   "2.0",
+				VersionCode:   "7",
+				MinOS:         "Android API 24",
+				Architectures: []string{"x86_64"},
+			},
+		},
+		{
+			path: ipa,
+			expected: &mobileAppInfo{
+				BundleID:      "com.example.ios",
+				VersionName:   "3.1",
+				VersionCode:   "310",
+				MinOS:         "iOS 13.0",
+				Architectures: []string{"armv7", "arm64"},
+			},
+		},
+		{
+			path:     testMobileAppPath,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		info, err := inspectMobileApp(tc.path)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", tc.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(info, tc.expected) {
+			t.Errorf("Incorrect metadata of %v. Got %+v, expected: %+v", tc.path, info, tc.expected)
+		}
+	}
+
+	broken := writeTestZip(t, dir, "broken.apk", map[string][]byte{
+		"AndroidManifest.xml": []byte("<manifest/>"),
+	})
+	if _, err = inspectMobileApp(broken); err == nil || !strings.Contains(err.Error(), "not an Android binary XML file") {
+		t.Errorf("Expected an error for a plain text manifest, got %v", err)
+	}
+
+	// Bundle ID check
+	if _, err = checkMobileApp(apk, "com.example.app"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err = checkMobileApp(apk, "com.example.other"); err == nil || !strings.Contains(err.Error(), "expected com.example.other") {
+		t.Errorf("Expected an error for a mismatched bundle ID, got %v", err)
+	}
+	if _, err = checkMobileApp(testMobileAppPath, "com.example.app"); err == nil {
+		t.Error("Expected an error when the bundle ID can't be checked")
+	}
+	if _, err = checkMobileApp(broken, ""); err != nil {
+		t.Errorf("Unexpected error for an app which isn't checked: %v", err)
+	}
+}
+
+func TestParsePlist_Binary(t *testing.T) {
+	longValue := "com.example.with.a.long.bundle.identifier"
+	plist, err := parsePlist(buildBinaryPlist(map[string]string{
+		"CFBundleIdentifier": longValue,
+		"MinimumOSVersion":   "14.0",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"CFBundleIdentifier": longValue,
+		"MinimumOSVersion":   "14.0",
+	}
+	if !reflect.DeepEqual(plist, expected) {
+		t.Errorf("Incorrect plist. Got %v, expected: %v", plist, expected)
+	}
+
+	if _, err = parsePlist([]byte("bplist00 truncated")); err == nil {
+		t.Error("Expected an error for a truncated binary plist")
+	}
+
+	// An offset table position which overflows when the size of the table is added to it
+	malicious := buildBinaryPlist(map[string]string{"CFBundleIdentifier": longValue})
+	binary.BigEndian.PutUint64(malicious[len(malicious)-8:], math.MaxUint64-1)
+	if _, err = parsePlist(malicious); err == nil {
+		t.Error("Expected an error for a binary plist with an invalid trailer")
+	}
+}
+
+func TestDecodeAXMLUTF8(t *testing.T) {
+	s, err := decodeAXMLUTF8([]byte{5, 5, 'h', 'e', 'l', 'l', 'o', 0})
+	if err != nil || s != "hello" {
+		t.Errorf("Incorrect string. Got %q (%v), expected hello", s, err)
+	}
+	if _, err = decodeAXMLUTF8([]byte{5, 5, 'h'}); err == nil {
+		t.Error("Expected an error for a truncated string")
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rainforestapp/rainforest-cli/rainforest"
 	"github.com/urfave/cli"
@@ -14,30 +22,200 @@ import (
 // mobileUploadAPI is part of the API connected to mobile uploads
 type mobileUploadAPI interface {
 	GetPresignedPOST(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error)
-	UploadToS3(postData *rainforest.RFPresignedPostData, filePath string) error
-	UpdateURL(siteID int, environmentID int, appSlot int, newURL string) error
+	UploadToS3WithProgress(postData *rainforest.RFPresignedPostData, filePath string, progress rainforest.UploadProgressFunc) (string, error)
+	UpdateURLs(siteID int, environmentID int, slotURLs map[int]string) error
+}
+
+// mobileApp is an app file to be uploaded to an app slot
+type mobileApp struct {
+	slot int
+	path string
 }
 
 // uploadMobileApp takes a path to a mobile app file and uploads it to S3 then sets
-// the site-id specified's URL to the magic url
+// the site-id specified's URL to the magic url.
 func uploadMobileApp(api mobileUploadAPI, filePath string, siteID int, environmentID int, appSlot int) error {
+	_, err := uploadMobileApps(api, []mobileApp{{slot: appSlot, path: filePath}}, siteID, environmentID)
+	return err
+}
+
+// uploadMobileApps uploads the apps concurrently and then sets the URLs of all their slots
+// with a single update. The URLs are only updated if all uploads succeeded. It returns the
+// URLs set for each slot.
+func uploadMobileApps(api mobileUploadAPI, apps []mobileApp, siteID int, environmentID int) (map[int]string, error) {
+	type result struct {
+		app mobileApp
+		url string
+		err error
+	}
+
+	appsChan := make(chan mobileApp, len(apps))
+	for _, app := range apps {
+		appsChan <- app
+	}
+	close(appsChan)
+
+	resultsChan := make(chan result, len(apps))
+	for i := 0; i < min(mobileUploadConcurrency, len(apps)); i++ {
+		go func() {
+			for app := range appsChan {
+				url, err := uploadMobileAppFile(api, app, siteID, environmentID)
+				resultsChan <- result{app: app, url: url, err: err}
+			}
+		}()
+	}
+
+	slotURLs := make(map[int]string)
+	var failures []error
+	for range apps {
+		res := <-resultsChan
+		if res.err != nil {
+			failures = append(failures, res.err)
+			continue
+		}
+		slotURLs[res.app.slot] = res.url
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Error() < failures[j].Error()
+		})
+		return nil, fmt.Errorf("%w, the app URLs have not been updated", errors.Join(failures...))
+	}
+
+	if err := api.UpdateURLs(siteID, environmentID, slotURLs); err != nil {
+		return nil, err
+	}
+	return slotURLs, nil
+}
 
-	presignedPostData, err := api.GetPresignedPOST(filepath.Ext(filePath), siteID, environmentID, appSlot)
+// uploadMobileAppFile uploads a single app and returns its Rainforest URL. Failed uploads
+// are retried and the upload is verified against the checksum of the file.
+func uploadMobileAppFile(api mobileUploadAPI, app mobileApp, siteID int, environmentID int) (string, error) {
+	checksums, err := mobileAppChecksums(app.path)
 	if err != nil {
-		return err
+		return "", err
+	}
+	fileName := filepath.Base(app.path)
+	log.Printf("Uploading %v to app slot %v (%v bytes, SHA-256 %v)", fileName, app.slot, checksums.size, checksums.sha256)
+
+	for attempt := 1; ; attempt++ {
+		presignedPostData, err := uploadMobileAppAttempt(api, app, siteID, environmentID, checksums)
+		if err == nil {
+			return presignedPostData.RainforestURL, nil
+		}
+		if attempt > mobileUploadRetries {
+			return "", fmt.Errorf("Failed to upload %v after %v attempts: %w", app.path, attempt, err)
+		}
+		log.Printf("%v: upload attempt %v failed: %v. Retrying in %v...", fileName, attempt, err, mobileUploadRetryDelay)
+		time.Sleep(mobileUploadRetryDelay)
 	}
+}
 
-	err = api.UploadToS3(presignedPostData, filePath)
+// uploadMobileAppAttempt uploads the app once and verifies the checksum of the uploaded file
+func uploadMobileAppAttempt(api mobileUploadAPI, app mobileApp, siteID int, environmentID int,
+	checksums mobileAppChecksum) (*rainforest.RFPresignedPostData, error) {
+	presignedPostData, err := api.GetPresignedPOST(filepath.Ext(app.path), siteID, environmentID, app.slot)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = api.UpdateURL(siteID, environmentID, appSlot, presignedPostData.RainforestURL)
+	fileName := filepath.Base(app.path)
+	etag, err := api.UploadToS3WithProgress(presignedPostData, app.path, uploadProgressLogger(fileName))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	// S3 reports the MD5 checksum as ETag, unless the file is encrypted with KMS
+	etag = strings.Trim(etag, `"`)
+	if !isMD5Checksum(etag) {
+		log.Printf("%v: upload finished, S3 didn't report a checksum to verify it against.", fileName)
+	} else if etag != checksums.md5 {
+		return nil, fmt.Errorf("checksum of the uploaded file %v doesn't match the local file %v", etag, checksums.md5)
+	} else {
+		log.Printf("%v: upload finished and verified.", fileName)
+	}
+
+	return presignedPostData, nil
+}
+
+// mobileAppChecksum holds the size and checksums of a mobile app file
+type mobileAppChecksum struct {
+	size   int64
+	md5    string
+	sha256 string
+}
+
+// mobileAppChecksums computes the size, MD5 and SHA-256 checksums of the file
+func mobileAppChecksums(filePath string) (mobileAppChecksum, error) {
+	var checksums mobileAppChecksum
+	f, err := os.Open(filePath)
+	if err != nil {
+		return checksums, err
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	checksums.size, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
+	if err != nil {
+		return checksums, err
+	}
+	checksums.md5 = hex.EncodeToString(md5Hash.Sum(nil))
+	checksums.sha256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	return checksums, nil
+}
+
+// isMD5Checksum returns true if s looks like a hex encoded MD5 checksum
+func isMD5Checksum(s string) bool {
+	if len(s) != hex.EncodedLen(md5.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// uploadProgressLogger returns a function logging upload progress of the file every 10 percent
+func uploadProgressLogger(fileName string) rainforest.UploadProgressFunc {
+	lastLogged := int64(-1)
+	return func(sent, total int64) {
+		percent := int64(100)
+		if total > 0 {
+			percent = sent * 100 / total
+		}
+		if step := percent / 10 * 10; step > lastLogged {
+			lastLogged = step
+			log.Printf("%v: uploaded %v%% (%v of %v bytes)", fileName, step, sent, total)
+		}
+	}
+}
+
+// checkMobileApp prints the metadata of the app and, if bundleID isn't empty, makes sure
+// the app has the expected bundle ID. Apps which can't be inspected are only rejected
+// when the bundle ID has to be checked. It returns the metadata, or nil if there's none.
+// The API doesn't expose the bundle ID configured for the site, so it's always given by the
+// user.
+func checkMobileApp(filePath string, bundleID string) (*mobileAppInfo, error) {
+	info, err := inspectMobileApp(filePath)
+	if err != nil {
+		if bundleID != "" {
+			return nil, err
+		}
+		log.Printf("Warning: %v", err)
+		return nil, nil
+	}
+	if info == nil {
+		if bundleID != "" {
+			return nil, fmt.Errorf("Unable to check the bundle ID of %v, only .apk, .aab and .ipa files can be inspected", filePath)
+		}
+		return nil, nil
+	}
+
+	log.Printf("Mobile app %v: %v", filepath.Base(filePath), info)
+	if bundleID != "" && info.BundleID != bundleID {
+		return nil, fmt.Errorf("Bundle ID of %v is %v, expected %v. Make sure you are uploading the right app.",
+			filePath, info.BundleID, bundleID)
+	}
+	return info, nil
 }
 
 func isAllowedExtension(extension string) bool {
@@ -50,18 +228,101 @@ func isAllowedExtension(extension string) bool {
 
 const allowedExtensionsPretty = ".apk, .aab, .ipa, .zip, .gz, .tar.gz"
 
-// mobileAppUpload is a wrapper around uploadMobileApp to function with mobile-upload cli command
-func mobileAppUpload(c cliContext, api mobileUploadAPI) error {
-	// Get the filepath from the arg
-	filePath := c.Args().First()
-	if filePath == "" {
-		return cli.NewExitError("Mobile app file path not specified", 1)
+// parseMobileApps returns the apps to upload from the arguments, which are either a single
+// path uploaded to the app slot given by --app-slot, or SLOT=PATH pairs
+func parseMobileApps(args cli.Args, appSlotString string) ([]mobileApp, error) {
+	if len(args) == 0 || args.First() == "" {
+		return nil, errors.New("Mobile app file path not specified")
+	}
+
+	var apps []mobileApp
+	if len(args) == 1 && !isSlotPair(args.First()) {
+		appSlot := 1 // Default to 1, optional param
+		if appSlotString != "" {
+			var err error
+			appSlot, err = strconv.Atoi(appSlotString)
+			if err != nil || appSlot < 1 || appSlot > 100 {
+				return nil, errors.New("app-slot must be an integer (1 to 100)")
+			}
+		}
+		apps = append(apps, mobileApp{slot: appSlot, path: args.First()})
+	} else {
+		if appSlotString != "" {
+			return nil, errors.New("app-slot can't be used when uploading SLOT=PATH pairs")
+		}
+		slots := make(map[int]bool)
+		for _, arg := range args {
+			if !isSlotPair(arg) {
+				return nil, fmt.Errorf("Invalid app %q, use SLOT=PATH pairs to upload multiple apps", arg)
+			}
+			parts := strings.SplitN(arg, "=", 2)
+			slot, _ := strconv.Atoi(parts[0])
+			if slot < 1 || slot > 100 {
+				return nil, fmt.Errorf("Invalid app slot in %q, it must be an integer (1 to 100)", arg)
+			}
+			if slots[slot] {
+				return nil, fmt.Errorf("App slot %v is given more than once", slot)
+			}
+			slots[slot] = true
+			apps = append(apps, mobileApp{slot: slot, path: parts[1]})
+		}
+	}
+
+	for _, app := range apps {
+		fileExt := strings.ToLower(filepath.Ext(app.path))
+		if !isAllowedExtension(fileExt) {
+			return nil, fmt.Errorf("Invalid file extension. - %v. Allowed Extensions: %v", fileExt, allowedExtensionsPretty)
+		}
+	}
+	return apps, nil
+}
+
+// isSlotPair returns true if arg is a SLOT=PATH pair
+func isSlotPair(arg string) bool {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return false
+	}
+	_, err := strconv.Atoi(parts[0])
+	return err == nil
+}
+
+// parseBundleIDs returns the expected bundle ID of each app slot. A bundle ID without a
+// slot can be given when uploading a single app, otherwise they're SLOT=BUNDLE_ID pairs for
+// the uploaded slots.
+func parseBundleIDs(values []string, apps []mobileApp) (map[int]string, error) {
+	bundleIDs := make(map[int]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			if len(apps) != 1 {
+				return nil, fmt.Errorf("Invalid bundle ID %q, use SLOT=BUNDLE_ID pairs when uploading multiple apps", value)
+			}
+			bundleIDs[apps[0].slot] = value
+			continue
+		}
+
+		slot, err := strconv.Atoi(parts[0])
+		if err != nil || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid bundle ID %q, expected SLOT=BUNDLE_ID", value)
+		}
+		uploaded := false
+		for _, app := range apps {
+			uploaded = uploaded || app.slot == slot
+		}
+		if !uploaded {
+			return nil, fmt.Errorf("Invalid bundle ID %q, no app is uploaded to app slot %v", value, slot)
+		}
+		bundleIDs[slot] = parts[1]
 	}
+	return bundleIDs, nil
+}
 
-	// verify extension
-	fileExt := strings.ToLower(filepath.Ext(filePath))
-	if !isAllowedExtension(fileExt) {
-		return cli.NewExitError(fmt.Sprintf("Invalid file extension. - %v. Allowed Extensions: %v", fileExt, allowedExtensionsPretty), 1)
+// mobileAppUpload is a wrapper around uploadMobileApps to function with mobile-upload cli command
+func mobileAppUpload(c cliContext, api mobileUploadAPI) error {
+	apps, err := parseMobileApps(c.Args(), c.String("app-slot"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
 	}
 
 	siteIDString := c.String("site-id")
@@ -82,26 +343,107 @@ func mobileAppUpload(c cliContext, api mobileUploadAPI) error {
 		return cli.NewExitError("environment-id must be an integer", 1)
 	}
 
-	appSlot := 1 // Default to 1, optional param
-	appSlotString := c.String("app-slot")
-	if appSlotString != "" {
-		appSlot, err = strconv.Atoi(appSlotString)
-		if err != nil || appSlot < 1 || appSlot > 100 {
-			return cli.NewExitError("app-slot must be an integer (1 to 100)", 1)
+	bundleIDs, err := parseBundleIDs(c.StringSlice("bundle-id"), apps)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	for _, app := range apps {
+		// Open app and return early with an error if we fail
+		f, err := os.Open(app.path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		f.Close()
+
+		_, err = checkMobileApp(app.path, bundleIDs[app.slot])
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
 		}
 	}
 
-	// Open app and return early with an error if we fail
-	f, err := os.Open(filePath)
+	_, err = uploadMobileApps(api, apps, siteID, environmentID)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
-	defer f.Close()
 
-	err = uploadMobileApp(api, filePath, siteID, environmentID, appSlot)
+	return nil
+}
+
+// mobileRunAPI is part of the API used to upload mobile apps before starting a run
+type mobileRunAPI interface {
+	mobileUploadAPI
+	GetSiteEnvironment(siteID int, environmentID int) (rainforest.SiteEnvironment, error)
+}
+
+// preRunMobileUpload uploads the apps given with --mobile-app to the site and environment of
+// the run, to be ran before starting a new run. It makes sure the site environment still
+// points at the uploaded apps and, unless a release is given, sets the run's release to
+// the uploaded builds.
+func preRunMobileUpload(c cliContext, api mobileRunAPI, params *rainforest.RunParams) error {
+	values := c.StringSlice("mobile-app")
+	if len(values) == 0 {
+		return nil
+	}
+	if params.SiteID == 0 || params.EnvironmentID == 0 || c.String("custom-url") != "" {
+		return errors.New("--mobile-app requires --site-id and --environment-id, and can't be used with --custom-url")
+	}
+
+	apps, err := parseMobileApps(cli.Args(values), "")
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return err
+	}
+	bundleIDs, err := parseBundleIDs(c.StringSlice("mobile-app-bundle-id"), apps)
+	if err != nil {
+		return err
+	}
+
+	var builds []string
+	for _, app := range apps {
+		info, err := checkMobileApp(app.path, bundleIDs[app.slot])
+		if err != nil {
+			return err
+		}
+		build, err := mobileAppBuild(app, info)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, build)
+	}
+
+	slotURLs, err := uploadMobileApps(api, apps, params.SiteID, params.EnvironmentID)
+	if err != nil {
+		return err
 	}
 
+	// Another upload to the same slots could have replaced the apps in the meantime
+	siteEnvironment, err := api.GetSiteEnvironment(params.SiteID, params.EnvironmentID)
+	if err != nil {
+		return err
+	}
+	urls := strings.Split(siteEnvironment.URL, "|")
+	for slot, url := range slotURLs {
+		if slot > len(urls) || urls[slot-1] != url {
+			return fmt.Errorf("App slot %v of the site environment no longer points at the uploaded app, "+
+				"it may have been replaced by another upload", slot)
+		}
+	}
+
+	if params.Release == "" {
+		params.Release = strings.Join(builds, ", ")
+	}
 	return nil
 }
+
+// mobileAppBuild describes the uploaded build of the app, by its version if it's known
+// or else by its checksum
+func mobileAppBuild(app mobileApp, info *mobileAppInfo) (string, error) {
+	if info != nil && info.VersionName != "" {
+		return fmt.Sprintf("%v %v (%v)", info.BundleID, info.VersionName, info.VersionCode), nil
+	}
+	checksums, err := mobileAppChecksums(app.path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v sha256:%v", filepath.Base(app.path), checksums.sha256[:12]), nil
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rainforestapp/rainforest-cli/rainforest"
 	"github.com/urfave/cli"
@@ -13,9 +21,9 @@ const (
 )
 
 type fakeMobileUploadAPI struct {
-	getPresignedPOST      func(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error)
-	uploadToS3            func(postData *rainforest.RFPresignedPostData, filePath string) error
-	setSiteEnvironmentURL func(siteID int, environmentID int, appSlot int, newURL string) error
+	getPresignedPOST func(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error)
+	uploadToS3       func(postData *rainforest.RFPresignedPostData, filePath string) (string, error)
+	updateURLs       func(siteID int, environmentID int, slotURLs map[int]string) error
 }
 
 func (f fakeMobileUploadAPI) GetPresignedPOST(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error) {
@@ -25,16 +33,17 @@ func (f fakeMobileUploadAPI) GetPresignedPOST(fileExt string, siteID int, enviro
 	return nil, nil
 }
 
-func (f fakeMobileUploadAPI) UploadToS3(postData *rainforest.RFPresignedPostData, filePath string) error {
+func (f fakeMobileUploadAPI) UploadToS3WithProgress(postData *rainforest.RFPresignedPostData, filePath string,
+	progress rainforest.UploadProgressFunc) (string, error) {
 	if f.uploadToS3 != nil {
 		return f.uploadToS3(postData, filePath)
 	}
-	return nil
+	return "", nil
 }
 
-func (f fakeMobileUploadAPI) UpdateURL(siteID int, environmentID int, appSlot int, newURL string) error {
-	if f.setSiteEnvironmentURL != nil {
-		return f.setSiteEnvironmentURL(siteID, environmentID, appSlot, newURL)
+func (f fakeMobileUploadAPI) UpdateURLs(siteID int, environmentID int, slotURLs map[int]string) error {
+	if f.updateURLs != nil {
+		return f.updateURLs(siteID, environmentID, slotURLs)
 	}
 	return nil
 }
@@ -50,12 +59,12 @@ func TestUploadMobileApp(t *testing.T) {
 			callCount["getPresignedPOST"] = callCount["getPresignedPOST"] + 1
 			return &rainforest.RFPresignedPostData{}, nil
 		},
-		uploadToS3: func(postData *rainforest.RFPresignedPostData, filePath string) error {
+		uploadToS3: func(postData *rainforest.RFPresignedPostData, filePath string) (string, error) {
 			callCount["uploadToS3"] = callCount["uploadToS3"] + 1
-			return nil
+			return "", nil
 		},
-		setSiteEnvironmentURL: func(siteID int, environmentID int, appSlot int, newURL string) error {
-			callCount["setSiteEnvironmentURL"] = callCount["setSiteEnvironmentURL"] + 1
+		updateURLs: func(siteID int, environmentID int, slotURLs map[int]string) error {
+			callCount["updateURLs"] = callCount["updateURLs"] + 1
 			return nil
 		},
 	}
@@ -70,10 +79,296 @@ func TestUploadMobileApp(t *testing.T) {
 	if expected := 1; callCount["getPresignedPOST"] != expected {
 		t.Errorf("api.getPresignedPOST called invalid number of times: %v, expected %v", callCount["getPresignedPOST"], expected)
 	}
-	if expected := 1; callCount["setSiteEnvironmentURL"] != expected {
-		t.Errorf("api.setSiteEnvironmentURL called invalid number of times: %v, expected %v", callCount["setSiteEnvironmentURL"], expected)
+	if expected := 1; callCount["updateURLs"] != expected {
+		t.Errorf("api.updateURLs called invalid number of times: %v, expected %v", callCount["updateURLs"], expected)
 	}
 }
+func TestUploadMobileApp_Retry(t *testing.T) {
+	defer func(delay time.Duration) {
+		mobileUploadRetryDelay = delay
+	}(mobileUploadRetryDelay)
+	mobileUploadRetryDelay = 0
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	checksums, err := mobileAppChecksums(testMobileAppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploads int
+	var updatedURL string
+	etags := []string{}
+	f := fakeMobileUploadAPI{
+		getPresignedPOST: func(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error) {
+			return &rainforest.RFPresignedPostData{RainforestURL: "rainforest://app.zip"}, nil
+		},
+		uploadToS3: func(postData *rainforest.RFPresignedPostData, filePath string) (string, error) {
+			uploads++
+			etag := etags[0]
+			etags = etags[1:]
+			if etag == "error" {
+				return "", errors.New("connection reset by peer")
+			}
+			return etag, nil
+		},
+		updateURLs: func(siteID int, environmentID int, slotURLs map[int]string) error {
+			updatedURL = slotURLs[1]
+			return nil
+		},
+	}
+
+	// Retried after a failed upload and a checksum mismatch
+	etags = []string{"error", `"00000000000000000000000000000000"`, `"` + checksums.md5 + `"`}
+	if err = uploadMobileApp(f, testMobileAppPath, 1, 2, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if uploads != 3 {
+		t.Errorf("Expected 3 upload attempts, got %v", uploads)
+	}
+	if updatedURL != "rainforest://app.zip" {
+		t.Errorf("Expected URL to be updated, got %q", updatedURL)
+	}
+	for _, want := range []string{"SHA-256 " + checksums.sha256, "connection reset by peer", "doesn't match", "verified"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got %v", want, out.String())
+		}
+	}
+
+	// Gives up after the retries
+	uploads = 0
+	updatedURL = ""
+	etags = []string{"error", "error", "error", "error"}
+	err = uploadMobileApp(f, testMobileAppPath, 1, 2, 1)
+	if err == nil || !strings.Contains(err.Error(), "after 4 attempts") {
+		t.Errorf("Expected an error after all attempts failed, got %v", err)
+	}
+	if uploads != 4 {
+		t.Errorf("Expected 4 upload attempts, got %v", uploads)
+	}
+	if updatedURL != "" {
+		t.Errorf("URL shouldn't be updated after a failed upload, got %q", updatedURL)
+	}
+}
+
+func TestParseMobileApps(t *testing.T) {
+	testCases := []struct {
+		args     cli.Args
+		appSlot  string
+		expected []mobileApp
+		err      string
+	}{
+		{args: cli.Args{"app.ipa"}, expected: []mobileApp{{slot: 1, path: "app.ipa"}}},
+		{args: cli.Args{"app.ipa"}, appSlot: "3", expected: []mobileApp{{slot: 3, path: "app.ipa"}}},
+		{args: cli.Args{"builds/v=1/app.ipa"}, expected: []mobileApp{{slot: 1, path: "builds/v=1/app.ipa"}}},
+		{
+			args:     cli.Args{"1=rider.apk", "2=driver.apk"},
+			expected: []mobileApp{{slot: 1, path: "rider.apk"}, {slot: 2, path: "driver.apk"}},
+		},
+		{args: cli.Args{}, err: "file path not specified"},
+		{args: cli.Args{"app.ipa"}, appSlot: "0", err: "app-slot must be an integer (1 to 100)"},
+		{args: cli.Args{"1=rider.apk", "2=driver.apk"}, appSlot: "1", err: "app-slot can't be used"},
+		{args: cli.Args{"1=rider.apk", "driver.apk"}, err: "use SLOT=PATH pairs"},
+		{args: cli.Args{"1=rider.apk", "101=driver.apk"}, err: "Invalid app slot"},
+		{args: cli.Args{"1=rider.apk", "1=driver.apk"}, err: "App slot 1 is given more than once"},
+		{args: cli.Args{"1=rider.apk", "2=driver.exe"}, err: "Invalid file extension"},
+	}
+
+	for _, tc := range testCases {
+		apps, err := parseMobileApps(tc.args, tc.appSlot)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error %q for %v, got %v", tc.err, tc.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", tc.args, err)
+		} else if !reflect.DeepEqual(apps, tc.expected) {
+			t.Errorf("Incorrect apps for %v. Got %+v, expected: %+v", tc.args, apps, tc.expected)
+		}
+	}
+
+	apps := []mobileApp{{slot: 1, path: "rider.apk"}, {slot: 2, path: "driver.apk"}}
+	bundleIDs, err := parseBundleIDs([]string{"1=com.example.rider", "2=com.example.driver"}, apps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[int]string{1: "com.example.rider", 2: "com.example.driver"}; !reflect.DeepEqual(bundleIDs, expected) {
+		t.Errorf("Incorrect bundle IDs. Got %v, expected: %v", bundleIDs, expected)
+	}
+	if _, err = parseBundleIDs([]string{"com.example.rider"}, apps); err == nil {
+		t.Error("Expected an error for a bundle ID without a slot")
+	}
+	if _, err = parseBundleIDs([]string{"3=com.example.admin"}, apps); err == nil {
+		t.Error("Expected an error for a bundle ID of a slot which isn't uploaded")
+	}
+	if _, err = parseBundleIDs([]string{"first=com.example.rider"}, apps); err == nil {
+		t.Error("Expected an error for an invalid slot")
+	}
+}
+
+func TestUploadMobileApps(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	var mu sync.Mutex
+	var updates []map[int]string
+	failSlot := 0
+	f := fakeMobileUploadAPI{
+		getPresignedPOST: func(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error) {
+			if appSlot == failSlot {
+				return nil, errors.New("service unavailable")
+			}
+			return &rainforest.RFPresignedPostData{RainforestURL: "rainforest://slot" + strconv.Itoa(appSlot)}, nil
+		},
+		updateURLs: func(siteID int, environmentID int, slotURLs map[int]string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			updates = append(updates, slotURLs)
+			return nil
+		},
+	}
+
+	apps := []mobileApp{
+		{slot: 1, path: testMobileAppPath},
+		{slot: 2, path: testMobileAppPath},
+		{slot: 5, path: testMobileAppPath},
+	}
+	slotURLs, err := uploadMobileApps(f, apps, 1, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []map[int]string{{1: "rainforest://slot1", 2: "rainforest://slot2", 5: "rainforest://slot5"}}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("Incorrect URL updates. Got %v, expected: %v", updates, expected)
+	}
+	if !reflect.DeepEqual(slotURLs, expected[0]) {
+		t.Errorf("Incorrect slot URLs. Got %v, expected: %v", slotURLs, expected[0])
+	}
+
+	// A failed upload leaves all URLs untouched
+	defer func(retries int) {
+		mobileUploadRetries = retries
+	}(mobileUploadRetries)
+	mobileUploadRetries = 0
+	updates = nil
+	failSlot = 2
+	_, err = uploadMobileApps(f, apps, 1, 2)
+	if err == nil || !strings.Contains(err.Error(), "service unavailable") || !strings.Contains(err.Error(), "have not been updated") {
+		t.Errorf("Expected an error for the failed upload, got %v", err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("URLs shouldn't be updated after a failed upload, got %v", updates)
+	}
+}
+
+// fakeMobileRunAPI keeps the site environment URL updated by the uploads
+type fakeMobileRunAPI struct {
+	fakeMobileUploadAPI
+	url string
+}
+
+func (f *fakeMobileRunAPI) GetSiteEnvironment(siteID int, environmentID int) (rainforest.SiteEnvironment, error) {
+	return rainforest.SiteEnvironment{ID: 1, SiteID: siteID, EnvironmentID: environmentID, URL: f.url}, nil
+}
+
+func TestPreRunMobileUpload(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	f := &fakeMobileRunAPI{}
+	f.getPresignedPOST = func(fileExt string, siteID int, environmentID int, appSlot int) (*rainforest.RFPresignedPostData, error) {
+		return &rainforest.RFPresignedPostData{RainforestURL: "rainforest://slot" + strconv.Itoa(appSlot)}, nil
+	}
+	f.updateURLs = func(siteID int, environmentID int, slotURLs map[int]string) error {
+		urls := strings.Split(f.url, "|")
+		for slot, url := range slotURLs {
+			for len(urls) < slot {
+				urls = append(urls, "")
+			}
+			urls[slot-1] = url
+		}
+		f.url = strings.Join(urls, "|")
+		return nil
+	}
+
+	checksums, err := mobileAppChecksums(testMobileAppPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing to upload
+	params := rainforest.RunParams{SiteID: 12, EnvironmentID: 34}
+	if err = preRunMobileUpload(newFakeContext(map[string]interface{}{}, cli.Args{}), f, &params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Apps are uploaded and the run's release is set to the build
+	f.url = "https://example.com/old.zip|https://example.com/other.zip"
+	context := newFakeContext(map[string]interface{}{
+		"mobile-app": []string{"2=" + testMobileAppPath},
+	}, cli.Args{})
+	if err = preRunMobileUpload(context, f, &params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "https://example.com/old.zip|rainforest://slot2"; f.url != want {
+		t.Errorf("Incorrect site environment URL. Got %v, expected: %v", f.url, want)
+	}
+	if want := "testing.zip sha256:" + checksums.sha256[:12]; params.Release != want {
+		t.Errorf("Incorrect release. Got %v, expected: %v", params.Release, want)
+	}
+
+	// A release given by the user is kept
+	params.Release = "v1.2"
+	if err = preRunMobileUpload(context, f, &params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.Release != "v1.2" {
+		t.Errorf("Expected release to be kept, got %v", params.Release)
+	}
+
+	// The app was replaced by another upload
+	updateURLs := f.updateURLs
+	f.updateURLs = func(siteID int, environmentID int, slotURLs map[int]string) error {
+		updateURLs(siteID, environmentID, slotURLs)
+		f.url = "https://example.com/old.zip|rainforest://someone-else"
+		return nil
+	}
+	err = preRunMobileUpload(context, f, &params)
+	if err == nil || !strings.Contains(err.Error(), "no longer points at the uploaded app") {
+		t.Errorf("Expected an error for a replaced app, got %v", err)
+	}
+
+	// Site and environment are required
+	params = rainforest.RunParams{SiteID: 12}
+	err = preRunMobileUpload(context, f, &params)
+	if err == nil || !strings.Contains(err.Error(), "requires --site-id and --environment-id") {
+		t.Errorf("Expected an error for a missing environment, got %v", err)
+	}
+}
+
+func TestUploadProgressLogger(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	progress := uploadProgressLogger("app.ipa")
+	for sent := int64(0); sent <= 1000; sent += 25 {
+		progress(sent, 1000)
+	}
+	if got := strings.Count(out.String(), "uploaded"); got != 11 {
+		t.Errorf("Expected progress to be logged 11 times, got %v: %v", got, out.String())
+	}
+	if !strings.Contains(out.String(), "app.ipa: uploaded 50% (500 of 1000 bytes)") {
+		t.Errorf("Expected progress at 50%%, got %v", out.String())
+	}
+}
+
 func TestMobileAppUpload(t *testing.T) {
 	siteID := "123"
 	environmentID := "456"
@@ -85,12 +380,12 @@ func TestMobileAppUpload(t *testing.T) {
 			callCount["getPresignedPOST"] = callCount["getPresignedPOST"] + 1
 			return &rainforest.RFPresignedPostData{}, nil
 		},
-		uploadToS3: func(postData *rainforest.RFPresignedPostData, filePath string) error {
+		uploadToS3: func(postData *rainforest.RFPresignedPostData, filePath string) (string, error) {
 			callCount["uploadToS3"] = callCount["uploadToS3"] + 1
-			return nil
+			return "", nil
 		},
-		setSiteEnvironmentURL: func(siteID int, environmentID int, appSlot int, newURL string) error {
-			callCount["setSiteEnvironmentURL"] = callCount["setSiteEnvironmentURL"] + 1
+		updateURLs: func(siteID int, environmentID int, slotURLs map[int]string) error {
+			callCount["updateURLs"] = callCount["updateURLs"] + 1
 			return nil
 		},
 	}
@@ -110,8 +405,8 @@ func TestMobileAppUpload(t *testing.T) {
 	if expected := 1; callCount["getPresignedPOST"] != expected {
 		t.Errorf("api.getPresignedPOST called invalid number of times: %v, expected %v", callCount["getPresignedPOST"], expected)
 	}
-	if expected := 1; callCount["setSiteEnvironmentURL"] != expected {
-		t.Errorf("api.setSiteEnvironmentURL called invalid number of times: %v, expected %v", callCount["setSiteEnvironmentURL"], expected)
+	if expected := 1; callCount["updateURLs"] != expected {
+		t.Errorf("api.updateURLs called invalid number of times: %v, expected %v", callCount["updateURLs"], expected)
 	}
 
 	// Bad extension
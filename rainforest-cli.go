@@ -40,6 +40,10 @@ var (
 
 	// Run status polling interval
 	runStatusPollInterval = time.Second * 5
+	// Longest run status polling interval while the run doesn't progress
+	runStatusMaxPollInterval = time.Second * 30
+	// Run status polling interval when waiting for webhooks with --webhook-listen
+	webhookFallbackPollInterval = time.Minute
 
 	// Batch size (number of rows) for tabular var upload
 	tabularBatchSize = 50
@@ -49,6 +53,13 @@ var (
 	rfmlDownloadConcurrency = 4
 	// Concurrent connections when uploading RFML files
 	rfmlUploadConcurrency = 4
+
+	// Concurrent uploads of mobile apps
+	mobileUploadConcurrency = 4
+	// Number of times a failed mobile app upload is retried
+	mobileUploadRetries = 3
+	// Delay before retrying a failed mobile app upload
+	mobileUploadRetryDelay = time.Second * 5
 )
 
 // cliContext is an interface providing context of running application
@@ -238,6 +249,40 @@ func main() {
 					Name:  "webhook",
 					Usage: "Specify the webhook URL for the run to use when testing against an ephemeral environment.",
 				},
+				cli.BoolFlag{
+					Name: "keep-temporary-environment",
+					Usage: "Don't delete the temporary environment created for --custom-url once the run is done " +
+						"or the CLI is interrupted.",
+				},
+				cli.StringFlag{
+					Name: "webhook-listen",
+					Usage: "Listen on `ADDRESS` (e.g. :8080) for the webhooks of the environment instead of " +
+						"polling the run status, which is checked once a minute in case no webhook arrives. " +
+						"The webhook of the environment must reach this address, Direct Connect can't expose it.",
+				},
+				cli.StringFlag{
+					Name:  "poll-interval",
+					Usage: "Check the run status every `INTERVAL` (5s by default) while the run progresses.",
+				},
+				cli.StringFlag{
+					Name: "max-poll-interval",
+					Usage: "Check the run status less often while the run doesn't progress, " +
+						"up to every `INTERVAL` (30s by default).",
+				},
+				cli.StringFlag{
+					Name: "timeout",
+					Usage: "Stop waiting for the run after `DURATION` (e.g. 2h), writing the partial results " +
+						"to --junit-file and exiting with code 124.",
+				},
+				cli.BoolFlag{
+					Name:  "cancel-on-timeout",
+					Usage: "Cancel the run when --timeout is reached.",
+				},
+				cli.BoolFlag{
+					Name: "cancel-on-interrupt",
+					Usage: "Cancel the run when the CLI gets SIGINT (Ctrl+C) or SIGTERM while waiting for it. " +
+						"The partial results are written to --junit-file either way.",
+				},
 				cli.BoolFlag{
 					Name: "git-trigger",
 					Usage: "Only trigger a run when the last commit (for a git repo in the current working directory) " +
@@ -256,13 +301,25 @@ func main() {
 					Name:  "junit-file",
 					Usage: "Create a JUnit XML report `FILE` with the specified name. Must be run in foreground mode.",
 				},
+				cli.BoolFlag{
+					Name:  "junit-merge-reruns",
+					Usage: "Merge the JUnit reports of the reruns into the JUnit report FILE, recording failed attempts as flakyFailure and rerunFailure elements.",
+				},
 				cli.StringFlag{
 					Name:  "import-variable-name",
 					Usage: "`NAME` of the tabular variable to be created or updated.",
 				},
 				cli.StringFlag{
 					Name:  "import-variable-csv-file",
-					Usage: "`PATH` to the CSV file to be uploaded.",
+					Usage: "`PATH` to the CSV, JSON, JSONL or XLSX file to be uploaded, or - for stdin.",
+				},
+				cli.StringFlag{
+					Name:  "import-variable-format",
+					Usage: "`FORMAT` of the variable file: csv, json, jsonl or xlsx. Detected from the file extension by default.",
+				},
+				cli.StringFlag{
+					Name:  "import-variable-mapping",
+					Usage: "`PATH` to a YAML file which renames, drops, reorders or requires columns of the variable file.",
 				},
 				cli.BoolFlag{
 					Name:  "overwrite-variable",
@@ -272,6 +329,39 @@ func main() {
 					Name:  "single-use",
 					Usage: "This option marks uploaded variable as single-use.",
 				},
+				cli.StringFlag{
+					Name: "import-variable-update-mode",
+					Usage: "Update the existing tabular variable in place instead of recreating it. " +
+						"`MODE` is one of: append, replace, upsert or sync.",
+				},
+				cli.StringFlag{
+					Name:  "import-variable-key",
+					Usage: "`COLUMN` used to match rows in upsert and sync modes, defaults to the first column.",
+				},
+				cli.StringSliceFlag{
+					Name: "require-variable-rows",
+					Usage: "Don't start the run unless the tabular variable has enough rows left, given as `NAME=N`. " +
+						"Can be used multiple times.",
+				},
+				cli.BoolFlag{
+					Name:  "top-up-variables",
+					Usage: "Add back the used up rows from the variables manifest to required tabular variables with too few rows left.",
+				},
+				cli.StringFlag{
+					Name:  "variables-manifest",
+					Value: defaultVariablesManifest,
+					Usage: "`PATH` to the variables manifest used by --top-up-variables.",
+				},
+				cli.StringSliceFlag{
+					Name: "mobile-app",
+					Usage: "Upload the mobile app at `PATH` to the site and environment of the run before starting it. " +
+						"Use SLOT=PATH for other app slots than 1, can be used multiple times.",
+				},
+				cli.StringSliceFlag{
+					Name: "mobile-app-bundle-id",
+					Usage: "Refuse to upload unless the bundle ID of the mobile app is `BUNDLE_ID`. Use SLOT=BUNDLE_ID with multiple apps. " +
+						"The bundle ID configured for the site isn't available from the API, so it has to be given.",
+				},
 				cli.StringFlag{
 					Name:  "wait, reattach",
 					Usage: "Monitor existing run with `RUN_ID` instead of starting a new one.",
@@ -325,6 +415,10 @@ func main() {
 					Name:  "junit-file",
 					Usage: "Create a JUnit XML report `FILE` with the specified name. Must be run in foreground mode.",
 				},
+				cli.BoolFlag{
+					Name:  "junit-merge-reruns",
+					Usage: "Merge the JUnit reports of the reruns into the JUnit report FILE, recording failed attempts as flakyFailure and rerunFailure elements.",
+				},
 				cli.UintFlag{
 					Name:  "max-reruns",
 					Usage: "Rerun `MAX-RERUNS` times before reporting failure.",
@@ -333,6 +427,34 @@ func main() {
 					Name:  "rerun-attempt",
 					Usage: "Which rerun attempt this is.",
 				},
+				cli.StringFlag{
+					Name: "webhook-listen",
+					Usage: "Listen on `ADDRESS` (e.g. :8080) for the webhooks of the environment instead of " +
+						"polling the run status.",
+				},
+				cli.StringFlag{
+					Name:  "poll-interval",
+					Usage: "Check the run status every `INTERVAL` (5s by default) while the run progresses.",
+				},
+				cli.StringFlag{
+					Name: "max-poll-interval",
+					Usage: "Check the run status less often while the run doesn't progress, " +
+						"up to every `INTERVAL` (30s by default).",
+				},
+				cli.StringFlag{
+					Name: "timeout",
+					Usage: "Stop waiting for the run after `DURATION` (e.g. 2h), writing the partial results " +
+						"to --junit-file and exiting with code 124.",
+				},
+				cli.BoolFlag{
+					Name:  "cancel-on-timeout",
+					Usage: "Cancel the run when --timeout is reached.",
+				},
+				cli.BoolFlag{
+					Name: "cancel-on-interrupt",
+					Usage: "Cancel the run when the CLI gets SIGINT (Ctrl+C) or SIGTERM while waiting for it. " +
+						"The partial results are written to --junit-file either way.",
+				},
 				cli.StringFlag{
 					Name:  "save-run-id",
 					Usage: "Save the created run's ID to `FILE`.",
@@ -500,6 +622,10 @@ func main() {
 					Name:  "flatten-steps",
 					Usage: "Download your tests with steps extracted from embedded tests.",
 				},
+				cli.BoolFlag{
+					Name:  "with-files",
+					Usage: "Download files embedded in your tests next to them and reference them by their relative paths.",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				return downloadTests(c, api)
@@ -507,11 +633,21 @@ func main() {
 		},
 		{
 			Name:         "csv-upload",
-			Usage:        "Create or update tabular var from CSV.",
+			Aliases:      []string{"data-upload"},
+			Usage:        "Create or update tabular var from CSV, JSON, JSONL or XLSX.",
 			OnUsageError: onCommandUsageErrorHandler("csv-upload"),
-			Description:  "Upload a CSV file to create or update tabular variables.",
-			ArgsUsage:    "[path to CSV file]",
+			Description: "Upload a CSV, JSON, JSONL or XLSX file to create or update tabular variables. " +
+				"Use - as the path to read from stdin.",
+			ArgsUsage: "[path to data file]",
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format, import-variable-format",
+					Usage: "`FORMAT` of the data file: csv, json, jsonl or xlsx. Detected from the file extension by default.",
+				},
+				cli.StringFlag{
+					Name:  "mapping, import-variable-mapping",
+					Usage: "`PATH` to a YAML file which renames, drops, reorders or requires columns of the data file.",
+				},
 				cli.StringFlag{
 					// Alternative name left for legacy reason.
 					Name:  "name, import-variable-name",
@@ -525,6 +661,15 @@ func main() {
 					Name:  "single-use",
 					Usage: "This option marks uploaded variable as single-use",
 				},
+				cli.StringFlag{
+					Name: "update-mode, import-variable-update-mode",
+					Usage: "Update the existing tabular variable in place instead of recreating it. " +
+						"`MODE` is one of: append, replace, upsert or sync.",
+				},
+				cli.StringFlag{
+					Name:  "key, import-variable-key",
+					Usage: "`COLUMN` used to match rows in upsert and sync modes, defaults to the first column.",
+				},
 				// Left here for legacy reason, but imho we should move that to args
 				cli.StringFlag{
 					Name:  "csv-file, import-variable-csv-file",
@@ -535,12 +680,100 @@ func main() {
 				return csvUpload(c, api)
 			},
 		},
+		{
+			Name:         "csv-download",
+			Usage:        "Download tabular var as CSV.",
+			OnUsageError: onCommandUsageErrorHandler("csv-download"),
+			Description:  "Write columns and rows of a tabular variable as CSV to stdout or a file.",
+			ArgsUsage:    "[name of the tabular variable]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "`PATH` of the file to write the CSV to, defaults to stdout.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return csvDownload(c, api)
+			},
+		},
+		{
+			Name:         "csv-diff",
+			Usage:        "Show what a CSV upload would change in a tabular var.",
+			OnUsageError: onCommandUsageErrorHandler("csv-diff"),
+			Description: "Compare a tabular variable with a CSV file and show added, removed and changed rows. " +
+				"Rows are matched by the key column, which is the first column of the CSV file by default.",
+			ArgsUsage: "[name of the tabular variable] [path to CSV file]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "`FORMAT` of the data file: csv, json, jsonl or xlsx. Detected from the file extension by default.",
+				},
+				cli.StringFlag{
+					Name:  "mapping",
+					Usage: "`PATH` to a YAML file which renames, drops, reorders or requires columns of the data file.",
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "`COLUMN` used to match rows between the tabular variable and the CSV file.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return csvDiff(c, api)
+			},
+		},
+		{
+			Name:         "variables",
+			Usage:        "Manage tabular variables declared in a manifest",
+			ArgsUsage:    "[command]",
+			OnUsageError: onCommandUsageErrorHandler("variables"),
+			Subcommands: []cli.Command{
+				{
+					Name:  "apply",
+					Usage: "Create, update or delete tabular variables to match the manifest",
+					Description: "Reads the manifest listing tabular variables with their source files, shows the " +
+						"changes needed to make the account match it and applies them.",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "manifest",
+							Value: defaultVariablesManifest,
+							Usage: "`PATH` to the variables manifest.",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Only show the planned changes without applying them.",
+						},
+						cli.BoolFlag{
+							Name:  "prune",
+							Usage: "Delete tabular variables which aren't listed in the manifest.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return variablesApply(c, api)
+					},
+				},
+				{
+					Name:        "status",
+					Usage:       "Show the remaining rows of single-use tabular variables",
+					Description: "Lists single-use tabular variables with the number of rows which haven't been used by runs yet.",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "min-rows",
+							Usage: "Fail if any single-use tabular variable has fewer than `N` rows left.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return variablesStatus(c, api)
+					},
+				},
+			},
+		},
 		{
 			Name:         "mobile-upload",
 			Usage:        "Upload your mobile app to Rainforest.",
 			OnUsageError: onCommandUsageErrorHandler("mobile-upload"),
-			Description:  "Upload a mobile app file to Rainforest.",
-			ArgsUsage:    "[path to mobile app file]",
+			Description: "Upload a mobile app file to Rainforest. To upload several apps at once, pass SLOT=PATH pairs. " +
+				"They are uploaded concurrently and the site environment URL is updated once all uploads succeeded.",
+			ArgsUsage: "[path to mobile app file] or [SLOT=PATH...]",
 			Flags: []cli.Flag{
 				cli.IntFlag{
 					Name:  "site-id",
@@ -554,6 +787,12 @@ func main() {
 					Name:  "app-slot",
 					Usage: "An optional flag for specifying the app slot (1-100) of your app, if your site-environment contains multiple apps. Default is 1.",
 				},
+				cli.StringSliceFlag{
+					Name: "bundle-id",
+					Usage: "Refuse to upload unless the bundle ID or package name of the app is `BUNDLE_ID`. " +
+						"Use SLOT=BUNDLE_ID when uploading multiple apps, can be used multiple times. " +
+						"The bundle ID configured for the site isn't available from the API, so it has to be given.",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				return mobileAppUpload(c, api)
@@ -563,17 +802,26 @@ func main() {
 			Name:         "report",
 			Usage:        "Create a report from your run results",
 			OnUsageError: onCommandUsageErrorHandler("report"),
-			Description: "Creates a report from your specified run." +
-				"You can specify output file using options, otherwise report will be generated to STDOUT",
+			Description: "Creates a report from your specified run. " +
+				"JUnit reports are written to the --junit-file, the other formats are written to the --output file, otherwise to STDOUT",
 			ArgsUsage: "[run ID]",
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Value: "junit",
+					Usage: "`FORMAT` of the report: junit, html, markdown, tap or ctrf.",
+				},
 				cli.StringFlag{
 					Name:  "junit-file",
 					Usage: "`PATH` of file to which write a JUnit report for the specified run.",
 				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "`PATH` of file to which write an html, markdown, tap or ctrf report for the specified run.",
+				},
 			},
 			Action: func(c *cli.Context) error {
-				return writeJunit(c, api, 0)
+				return writeReport(c, api)
 			},
 		},
 		{
@@ -591,6 +839,76 @@ func main() {
 			Action: func(c *cli.Context) error {
 				return printEnvironments(api)
 			},
+			Subcommands: []cli.Command{
+				{
+					Name:  "prune",
+					Usage: "Delete old temporary environments created by the CLI",
+					Description: "Deletes the temporary environments created by runs with --custom-url " +
+						"which are older than --older-than. With --temporary all temporary environments are deleted.",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "older-than",
+							Value: "24h",
+							Usage: "Only delete environments created more than `AGE` ago, e.g. 36h or 7d.",
+						},
+						cli.BoolFlag{
+							Name:  "temporary",
+							Usage: "Delete all temporary environments, not only the ones created by the CLI.",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "List the environments which would be deleted without deleting them.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return pruneEnvironments(c, api)
+					},
+				},
+			},
+		},
+		{
+			Name:         "site-environments",
+			Usage:        "Lists the URL of each site in each environment",
+			OnUsageError: onCommandUsageErrorHandler("site-environments"),
+			Description: "Lists the URL of each site in each environment, with a row for each app slot " +
+				"of mobile sites.",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "site-id",
+					Usage: "Only list the URLs of the site with `SITE-ID`.",
+				},
+				cli.IntFlag{
+					Name:  "environment-id",
+					Usage: "Only list the URLs in the environment with `ENVIRONMENT-ID`.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return printSiteEnvironments(c, api)
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:      "set-url",
+					Usage:     "Change the URL of a site in an environment",
+					ArgsUsage: "[URL]",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "site-id",
+							Usage: "The `SITE-ID` of the site.",
+						},
+						cli.IntFlag{
+							Name:  "environment-id",
+							Usage: "The `ENVIRONMENT-ID` of the environment.",
+						},
+						cli.IntFlag{
+							Name:  "app-slot",
+							Usage: "Only change the URL of the app `SLOT` (1-100), keeping the URLs of other slots.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return setSiteEnvironmentURL(c, api)
+					},
+				},
+			},
 		},
 		{
 			Name:         "folders",
@@ -633,6 +951,63 @@ func main() {
 				return printFeatures(api)
 			},
 		},
+		{
+			Name:         "runs",
+			Usage:        "Lists runs",
+			OnUsageError: onCommandUsageErrorHandler("runs"),
+			Description: "Lists the runs matching the filters, most recent first. " +
+				"The branch and environment can be given by name or ID.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "state",
+					Usage: "Filter runs by `STATE`, e.g. in_progress, complete or aborted.",
+				},
+				cli.StringFlag{
+					Name:  "result",
+					Usage: "Filter runs by `RESULT`: passed, failed or no_result.",
+				},
+				cli.StringFlag{
+					Name:  "branch",
+					Usage: "Filter runs by `BRANCH` name.",
+				},
+				cli.StringFlag{
+					Name:  "release",
+					Usage: "Filter runs by `RELEASE`.",
+				},
+				cli.StringFlag{
+					Name:  "environment",
+					Usage: "Filter runs by `ENVIRONMENT` ID or name.",
+				},
+				cli.IntFlag{
+					Name:  "run-group",
+					Usage: "Filter runs by `RUN-GROUP-ID`.",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Only list runs created after `DATE`, e.g. 2006-01-02, 2006-01-02T15:04:05Z or 7d for 7 days ago.",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "Only list runs created before `DATE`, e.g. 2006-01-02, 2006-01-02T15:04:05Z or 36h for 36 hours ago.",
+				},
+				cli.StringFlag{
+					Name:  "description",
+					Usage: "Only list runs with a description containing `TEXT`.",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "Only list the `N` most recent runs.",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "table",
+					Usage: "Output `FORMAT`: table or json.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return printRuns(c, api)
+			},
+		},
 		{
 			Name:         "run-groups",
 			Usage:        "Lists available run groups",
@@ -678,6 +1053,86 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:         "environment",
+			Usage:        "Manage environments",
+			ArgsUsage:    "[command] [environment ID or name]",
+			OnUsageError: onCommandUsageErrorHandler("environment"),
+			Subcommands: []cli.Command{
+				{
+					Name:      "create",
+					Usage:     "Create a new environment",
+					ArgsUsage: "[name]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "url",
+							Usage: "The `URL` of the environment.",
+						},
+						cli.StringFlag{
+							Name:  "webhook",
+							Usage: "The `URL` of a webhook called before runs in the environment.",
+						},
+						cli.BoolFlag{
+							Name:  "disable-webhook",
+							Usage: "Create the webhook disabled.",
+						},
+						cli.BoolFlag{
+							Name:  "temporary",
+							Usage: "Create a temporary environment.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return createEnvironment(c, api)
+					},
+				},
+				{
+					Name:      "update",
+					Usage:     "Update an existing environment",
+					ArgsUsage: "[environment ID or name]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "The new `NAME` of the environment.",
+						},
+						cli.StringFlag{
+							Name:  "url",
+							Usage: "The new `URL` of the environment.",
+						},
+						cli.StringFlag{
+							Name:  "webhook",
+							Usage: "The new webhook `URL` of the environment.",
+						},
+						cli.BoolFlag{
+							Name:  "enable-webhook",
+							Usage: "Enable the webhook of the environment.",
+						},
+						cli.BoolFlag{
+							Name:  "disable-webhook",
+							Usage: "Disable the webhook of the environment.",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return updateEnvironment(c, api)
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "Delete an existing environment",
+					ArgsUsage: "[environment ID or name]",
+					Action: func(c *cli.Context) error {
+						return deleteEnvironment(c, api)
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Show the details of an environment",
+					ArgsUsage: "[environment ID or name]",
+					Action: func(c *cli.Context) error {
+						return showEnvironment(c, api)
+					},
+				},
+			},
+		},
 		{
 			Name:         "direct-connect",
 			Usage:        "Start a Rainforest Direct Connect session",
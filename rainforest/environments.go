@@ -1,6 +1,17 @@
 package rainforest
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of temporary environments created by CreateTemporaryEnvironment
+const (
+	defaultTemporaryEnvironmentName = "temporary-env-for-custom-url-via-CLI"
+	temporaryEnvironmentSuffix      = "-temporary-env"
+)
 
 // EnvironmentParams are the parameters used to create a new Environment
 type EnvironmentParams struct {
@@ -11,34 +22,72 @@ type EnvironmentParams struct {
 	WebhookEnabled bool   `json:"webhook_enabled,omitempty"`
 }
 
+// EnvironmentUpdateParams are the parameters used to update an Environment. Only the
+// fields which are set are changed.
+type EnvironmentUpdateParams struct {
+	Name           *string `json:"name,omitempty"`
+	URL            *string `json:"url,omitempty"`
+	Webhook        *string `json:"webhook,omitempty"`
+	WebhookEnabled *bool   `json:"webhook_enabled,omitempty"`
+}
+
 // Environment represents an environment in Rainforest
 type Environment struct {
-	ID             int    `json:"id"`
-	Name           string `json:"name"`
-	IsTemporary    bool   `json:"is_temporary"`
-	Webhook        string `json:"webhook"`
-	WebhookEnabled bool   `json:"webhook_enabled"`
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	URL            string    `json:"url"`
+	IsTemporary    bool      `json:"is_temporary"`
+	Webhook        string    `json:"webhook"`
+	WebhookEnabled bool      `json:"webhook_enabled"`
+	CreatedAt      time.Time `json:"created_at,omitempty"`
+}
+
+// IsCLITemporary returns true if the environment is a temporary environment created by
+// CreateTemporaryEnvironment.
+func (e *Environment) IsCLITemporary() bool {
+	return e.IsTemporary &&
+		(e.Name == defaultTemporaryEnvironmentName || strings.HasSuffix(e.Name, temporaryEnvironmentSuffix))
 }
 
 // CreateTemporaryEnvironment creates a new temporary environment and returns the
 // Environment.
 func (c *Client) CreateTemporaryEnvironment(runDescription string, urlString string, webhook string) (*Environment, error) {
-	name := "temporary-env-for-custom-url-via-CLI"
+	name := defaultTemporaryEnvironmentName
 	if runDescription != "" {
 		if len(runDescription) > 241 {
 			runDescription = runDescription[:241]
 		}
-		name = fmt.Sprintf("%v-temporary-env", runDescription)
+		name = fmt.Sprintf("%v%v", runDescription, temporaryEnvironmentSuffix)
 	}
 
-	body := EnvironmentParams{
+	return c.CreateEnvironment(EnvironmentParams{
 		Name:           name,
 		URL:            urlString,
 		IsTemporary:    true,
 		Webhook:        webhook,
 		WebhookEnabled: webhook != "",
+	})
+}
+
+// CreateEnvironment creates a new environment and returns it.
+func (c *Client) CreateEnvironment(params EnvironmentParams) (*Environment, error) {
+	req, err := c.NewRequest("POST", "environments", &params)
+	if err != nil {
+		return nil, err
 	}
-	req, err := c.NewRequest("POST", "environments", &body)
+
+	var env Environment
+	_, err = c.Do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// GetEnvironment fetches the environment with the given ID.
+func (c *Client) GetEnvironment(envID int) (*Environment, error) {
+	req, err := c.NewRequest("GET", "environments/"+strconv.Itoa(envID), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -51,3 +100,31 @@ func (c *Client) CreateTemporaryEnvironment(runDescription string, urlString str
 
 	return &env, nil
 }
+
+// UpdateEnvironment changes the fields of the environment which are set in params and
+// returns the updated environment.
+func (c *Client) UpdateEnvironment(envID int, params EnvironmentUpdateParams) (*Environment, error) {
+	req, err := c.NewRequest("PUT", "environments/"+strconv.Itoa(envID), &params)
+	if err != nil {
+		return nil, err
+	}
+
+	var env Environment
+	_, err = c.Do(req, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	return &env, nil
+}
+
+// DeleteEnvironment deletes the environment with the given ID.
+func (c *Client) DeleteEnvironment(envID int) error {
+	req, err := c.NewRequest("DELETE", "environments/"+strconv.Itoa(envID), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
@@ -110,3 +110,89 @@ func TestCreateTemporaryEnvironment(t *testing.T) {
 		}
 	}
 }
+
+func TestEnvironmentManagement(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/environments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Unexpected request method: %v", r.Method)
+		}
+		var p EnvironmentParams
+		json.NewDecoder(r.Body).Decode(&p)
+		expected := EnvironmentParams{Name: "Preview", URL: "https://preview.example.com", Webhook: "https://hooks.example.com"}
+		if p != expected {
+			t.Errorf("Unexpected request body. Want %v, Got %v", expected, p)
+		}
+		fmt.Fprint(w, `{"id":12,"name":"Preview","webhook":"https://hooks.example.com"}`)
+	})
+
+	mux.HandleFunc("/environments/12", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, `{"id":12,"name":"Preview","url":"https://preview.example.com","is_temporary":true,"created_at":"2020-05-01T10:00:00Z"}`)
+		case "PUT":
+			body, _ := ioutil.ReadAll(r.Body)
+			if want := `{"name":"Renamed","webhook_enabled":false}`; string(body) != want+"\n" && string(body) != want {
+				t.Errorf("Unexpected request body. Want %v, Got %s", want, body)
+			}
+			fmt.Fprint(w, `{"id":12,"name":"Renamed"}`)
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request method: %v", r.Method)
+		}
+	})
+
+	env, err := client.CreateEnvironment(EnvironmentParams{
+		Name:    "Preview",
+		URL:     "https://preview.example.com",
+		Webhook: "https://hooks.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != 12 {
+		t.Errorf("Incorrect environment ID. Want 12, Got %v", env.ID)
+	}
+
+	env, err = client.GetEnvironment(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.IsTemporary || env.URL != "https://preview.example.com" || env.CreatedAt.Year() != 2020 {
+		t.Errorf("Incorrect environment: %+v", env)
+	}
+
+	name := "Renamed"
+	disabled := false
+	env, err = client.UpdateEnvironment(12, EnvironmentUpdateParams{Name: &name, WebhookEnabled: &disabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Name != "Renamed" {
+		t.Errorf("Incorrect environment name. Want Renamed, Got %v", env.Name)
+	}
+
+	if err = client.DeleteEnvironment(12); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnvironmentIsCLITemporary(t *testing.T) {
+	testCases := []struct {
+		env  Environment
+		want bool
+	}{
+		{Environment{Name: "temporary-env-for-custom-url-via-CLI", IsTemporary: true}, true},
+		{Environment{Name: "nightly-temporary-env", IsTemporary: true}, true},
+		{Environment{Name: "nightly-temporary-env", IsTemporary: false}, false},
+		{Environment{Name: "Preview", IsTemporary: true}, false},
+	}
+	for _, tc := range testCases {
+		if got := tc.env.IsCLITemporary(); got != tc.want {
+			t.Errorf("IsCLITemporary of %+v = %v, want %v", tc.env, got, tc.want)
+		}
+	}
+}
@@ -5,13 +5,23 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+)
+
+var (
+	// Maximum size of a file embedded in an RFML test
+	maxEmbeddedFileSize int64 = 50 * 1024 * 1024
+	// Concurrent connections when uploading embedded files
+	embeddedFileUploadConcurrency = 4
 )
 
 // uploadedFile represents a file that has been uploaded to Rainforest
@@ -23,6 +33,7 @@ type uploadedFile struct {
 	Size      int64  `json:"size"`
 	Name      string `json:"name"`
 	Key       string `json:"file_key"`
+	URL       string `json:"url,omitempty"`
 }
 
 // getUploadedFiles returns information for all all files uploaded to the
@@ -138,8 +149,184 @@ func (c *Client) uploadEmbeddedFile(fileName string, fileContents []byte, awsInf
 			return err
 		}
 
-		return fmt.Errorf("There was an error uploading your file - %v: %v", fileName, string(body))
+		return &S3Error{StatusCode: status, FileName: fileName, Body: string(body)}
 	}
 
 	return nil
 }
+
+// DownloadEmbeddedFiles downloads the uploaded files referenced by the test's file step
+// variables to dir, which should be the directory of the test's RFML file. The step
+// variables are then rewritten to reference the downloaded files by their relative
+// paths, eg: {{ file.screenshot(FILE_ID, FILE_SIGNATURE) }} would be translated to
+// {{ file.screenshot(./my_screenshot.gif) }}.
+func (c *Client) DownloadEmbeddedFiles(test *RFTest, dir string) error {
+	if !test.HasRemoteFiles() {
+		return nil
+	}
+
+	uploadedFiles, err := c.getUploadedFiles(test.TestID)
+	if err != nil {
+		return err
+	}
+
+	// Files referenced more than once are only downloaded once
+	downloadedPaths := map[int]string{}
+
+	replaceRemoteFiles := func(text string) (string, error) {
+		out := text
+		for _, remote := range findRemoteFiles(text) {
+			f, ok := findUploadedFile(uploadedFiles, remote)
+			if !ok {
+				log.Printf("Warning for test %v: unable to find uploaded file for %v, leaving it as is", test.TestID, remote.text)
+				continue
+			}
+
+			relPath, ok := downloadedPaths[f.ID]
+			if !ok {
+				relPath, err = c.downloadUploadedFile(f, remote, dir)
+				if err != nil {
+					return "", err
+				}
+				downloadedPaths[f.ID] = relPath
+			}
+
+			replacement := fmt.Sprintf("{{ file.%v(%v) }}", remote.stepVar, relPath)
+			out = strings.Replace(out, remote.text, replacement, 1)
+		}
+
+		return out, nil
+	}
+
+	for idx, step := range test.Steps {
+		s, ok := step.(RFTestStep)
+		if !ok {
+			continue
+		}
+
+		s.Action, err = replaceRemoteFiles(s.Action)
+		if err != nil {
+			return err
+		}
+
+		s.Response, err = replaceRemoteFiles(s.Response)
+		if err != nil {
+			return err
+		}
+		test.Steps[idx] = s
+	}
+
+	return nil
+}
+
+// findUploadedFile finds the uploaded file referenced by a step variable.
+// Screenshots are referenced by their ID, downloads by their key.
+func findUploadedFile(uploadedFiles []uploadedFile, remote remoteFile) (uploadedFile, bool) {
+	for _, f := range uploadedFiles {
+		if !strings.HasPrefix(f.Signature, remote.sig) {
+			continue
+		}
+		if remote.stepVar == "screenshot" && strconv.Itoa(f.ID) == remote.id {
+			return f, true
+		}
+		if remote.stepVar == "download" && f.Key == remote.id {
+			return f, true
+		}
+	}
+
+	return uploadedFile{}, false
+}
+
+// downloadUploadedFile saves an uploaded file to dir and returns its path relative
+// to dir. If a different file with the same name already exists there, the file
+// ID is prepended to the name.
+func (c *Client) downloadUploadedFile(f uploadedFile, remote remoteFile, dir string) (string, error) {
+	if f.URL == "" {
+		return "", fmt.Errorf("Unable to download %v: no download URL available for file %v", remote.text, f.ID)
+	}
+
+	fileName := filepath.Base(f.Name)
+	if remote.name != "" {
+		fileName = filepath.Base(remote.name)
+	}
+	if fileName == "" || fileName == "." || fileName == string(filepath.Separator) {
+		fileName = fmt.Sprintf("%v_%v", remote.stepVar, f.ID)
+		if exts, _ := mime.ExtensionsByType(f.MimeType); len(exts) > 0 {
+			fileName += exts[0]
+		}
+	}
+
+	filePath := filepath.Join(dir, fileName)
+	if digest, err := fileDigest(filePath); err == nil {
+		if digest == f.Digest {
+			// Already downloaded
+			return "./" + fileName, nil
+		}
+		fileName = fmt.Sprintf("%v_%v", f.ID, fileName)
+		filePath = filepath.Join(dir, fileName)
+		if digest, err = fileDigest(filePath); err == nil && digest == f.Digest {
+			// Already downloaded under the prefixed name
+			return "./" + fileName, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	res, err := c.client.Get(f.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return "", fmt.Errorf("There was an error downloading your file - %v: %v", fileName, string(body))
+	}
+
+	// The file is downloaded to a temporary file which only replaces filePath once it's
+	// complete and matches the digest, so a failed download never leaves a truncated file
+	out, err := os.CreateTemp(dir, fileName+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), res.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("There was an error downloading your file - %v: %v", fileName, err)
+	}
+
+	if digest := hex.EncodeToString(hash.Sum(nil)); f.Digest != "" && digest != f.Digest {
+		return "", fmt.Errorf("There was an error downloading your file - %v: digest %v doesn't match %v", fileName, digest, f.Digest)
+	}
+	if err = os.Chmod(out.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err = os.Rename(out.Name(), filePath); err != nil {
+		return "", err
+	}
+
+	log.Printf("Downloaded embedded file to %v", filePath)
+	return "./" + fileName, nil
+}
+
+// fileDigest returns the hex encoded MD5 digest of the file at filePath.
+func fileDigest(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -1,13 +1,16 @@
 package rainforest
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"mime"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -195,3 +198,135 @@ func TestCreateTestFile(t *testing.T) {
 		t.Errorf("Unexpected response from createTestFile.\nActual: %#v\nExpected: %#v", *out, awsInfo)
 	}
 }
+
+func TestDownloadEmbeddedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-files")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	screenshotContents := []byte("screenshot contents")
+	downloadContents := []byte("download contents")
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/screenshot":
+			w.Write(screenshotContents)
+		case "/download":
+			w.Write(downloadContents)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer fileServer.Close()
+
+	digest := func(contents []byte) string {
+		checksum := md5.Sum(contents)
+		return hex.EncodeToString(checksum[:])
+	}
+
+	setup()
+	defer cleanup()
+
+	const testID = 1337
+	files := []uploadedFile{
+		{ID: 123, Signature: "AbCdEfgh", Name: "/some/path/screen.png", URL: fileServer.URL + "/screenshot",
+			Digest: digest(screenshotContents)},
+		{ID: 456, Signature: "ZyXwVuts", Key: "c1_t1337_abc", Name: "data.csv", URL: fileServer.URL + "/download",
+			Digest: digest(downloadContents)},
+	}
+	mux.HandleFunc("/tests/"+strconv.Itoa(testID)+"/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(files)
+	})
+
+	// A different file with the same name is already there
+	err = ioutil.WriteFile(filepath.Join(dir, "my data.csv"), []byte("something else"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	test := RFTest{
+		TestID: testID,
+		Steps: []interface{}{
+			RFTestStep{
+				Action:   "Look at {{ file.screenshot(123, AbCdEf) }} and {{ file.screenshot(123, AbCdEf) }}",
+				Response: "Did you get {{ file.download(c1_t1337_abc, ZyXwVu, my data.csv) }}?",
+			},
+			RFTestStep{
+				Action:   "Unknown file {{ file.screenshot(999, qwerty) }}",
+				Response: "Local file {{ file.download(./local.txt) }}?",
+			},
+		},
+	}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stdout)
+
+	err = client.DownloadEmbeddedFiles(&test, dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectedSteps := []interface{}{
+		RFTestStep{
+			Action:   "Look at {{ file.screenshot(./screen.png) }} and {{ file.screenshot(./screen.png) }}",
+			Response: "Did you get {{ file.download(./456_my data.csv) }}?",
+		},
+		RFTestStep{
+			Action:   "Unknown file {{ file.screenshot(999, qwerty) }}",
+			Response: "Local file {{ file.download(./local.txt) }}?",
+		},
+	}
+	if !reflect.DeepEqual(test.Steps, expectedSteps) {
+		t.Errorf("Unexpected steps.\nActual: %#v\nExpected: %#v", test.Steps, expectedSteps)
+	}
+
+	for name, contents := range map[string][]byte{
+		"screen.png":      screenshotContents,
+		"456_my data.csv": downloadContents,
+		"my data.csv":     []byte("something else"),
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected %v to be downloaded: %v", name, err)
+		} else if !bytes.Equal(data, contents) {
+			t.Errorf("Unexpected contents of %v: %v", name, string(data))
+		}
+	}
+}
+
+func TestDownloadUploadedFile_Corrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainforest-files")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("truncated"))
+	}))
+	defer fileServer.Close()
+
+	setup()
+	defer cleanup()
+
+	checksum := md5.Sum([]byte("download contents"))
+	f := uploadedFile{ID: 456, Name: "data.csv", URL: fileServer.URL, Digest: hex.EncodeToString(checksum[:])}
+	_, err = client.downloadUploadedFile(f, remoteFile{}, dir)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("Expected a digest mismatch error, got %v", err)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected nothing to be left behind, got %v", entries)
+	}
+
+	// A complete download under the prefixed name isn't downloaded again
+	ioutil.WriteFile(filepath.Join(dir, "data.csv"), []byte("something else"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "456_data.csv"), []byte("download contents"), 0644)
+	path, err := client.downloadUploadedFile(f, remoteFile{}, dir)
+	if err != nil || path != "./456_data.csv" {
+		t.Errorf("Expected the existing download to be used, got %v, %v", path, err)
+	}
+}
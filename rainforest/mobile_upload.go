@@ -39,26 +39,60 @@ func (c *Client) GetPresignedPOST(fileExt string, siteID int, environmentID int,
 	return &data, err
 }
 
+// UploadProgressFunc is called while uploading a file with the number of bytes sent so far
+// and the size of the file
+type UploadProgressFunc func(sent, total int64)
+
+// progressReader reports the progress of reading the file being uploaded
+type progressReader struct {
+	reader   io.Reader
+	sent     int64
+	total    int64
+	progress UploadProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.progress(r.sent, r.total)
+	}
+	return n, err
+}
+
 // UploadToS3 creates a http.Request containing the required body for
 // uploading a file to AWS given the values stored in the receiving awsFileInfo struct.
 func (c *Client) UploadToS3(postData *RFPresignedPostData, filePath string) error {
+	_, err := c.UploadToS3WithProgress(postData, filePath, nil)
+	return err
+}
+
+// UploadToS3WithProgress uploads the file like UploadToS3, calling progress as the file is
+// sent if it isn't nil. It returns the ETag of the uploaded file reported by S3, which is the
+// MD5 checksum of the file for uploads in a single part.
+func (c *Client) UploadToS3WithProgress(postData *RFPresignedPostData, filePath string, progress UploadProgressFunc) (string, error) {
 	var req *http.Request
 	fileName := filepath.Base(filePath)
 
 	f, err := os.Open(filePath)
-	defer f.Close()
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer f.Close()
 
 	fi, err := f.Stat()
 	if err != nil {
-		return err
+		return "", err
 	}
 	fileSize := int64(fi.Size())
 
 	contentLength := postData.emptyMultipartSize("file", fileName) + fileSize
 
+	var fileReader io.Reader = f
+	if progress != nil {
+		fileReader = &progressReader{reader: f, total: fileSize, progress: progress}
+	}
+
 	readBody, writeBody := io.Pipe()
 	defer readBody.Close()
 
@@ -77,19 +111,26 @@ func (c *Client) UploadToS3(postData *RFPresignedPostData, filePath string) erro
 			errChan <- err
 			return
 		}
-		if _, err := io.CopyN(part, f, fileSize); err != nil {
+		if _, err := io.CopyN(part, fileReader, fileSize); err != nil {
 			errChan <- err
 			return
 		}
 		errChan <- writer.Close()
 	}()
 
+	// waitWriter stops the writes if the body wasn't read until the end and waits for them
+	// to finish, so they don't outlive the upload
+	waitWriter := func() error {
+		readBody.Close()
+		return <-errChan
+	}
+
 	// Create the Request
 	url := postData.URL
 	req, err = http.NewRequest("POST", url, readBody)
 	if err != nil {
-		<-errChan
-		return err
+		waitWriter()
+		return "", err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.ContentLength = contentLength
@@ -98,23 +139,28 @@ func (c *Client) UploadToS3(postData *RFPresignedPostData, filePath string) erro
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		<-errChan
-		return err
+		waitWriter()
+		return "", err
 	}
+	defer resp.Body.Close()
 
 	status := resp.StatusCode
 	if status >= 300 {
 		body, err := ioutil.ReadAll(resp.Body)
 
-		<-errChan
+		waitWriter()
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		return fmt.Errorf("There was an error uploading your file - %v: %v", fileName, string(body))
+		return "", &S3Error{StatusCode: status, FileName: fileName, Body: string(body)}
 	}
 
-	return nil
+	if err = waitWriter(); err != nil {
+		return "", fmt.Errorf("There was an error uploading your file - %v: %w", fileName, err)
+	}
+
+	return resp.Header.Get("ETag"), nil
 }
 
 func writeFields(requiredFields map[string]string, writer *multipart.Writer) {
@@ -132,21 +178,31 @@ func (postData *RFPresignedPostData) emptyMultipartSize(fieldname, filename stri
 	return int64(body.Len())
 }
 
-// UpdateURL fetches sites available to use during the RF runs.
+// UpdateURL sets the URL of the app slot of the site environment to newURL.
 func (c *Client) UpdateURL(siteID int, environmentID int, appSlot int, newURL string) error {
-	siteEnvironment, err := c.getSiteEnvironment(siteID, environmentID)
+	return c.UpdateURLs(siteID, environmentID, map[int]string{appSlot: newURL})
+}
+
+// UpdateURLs sets the URLs of several app slots of the site environment with a single
+// update, so the slots which aren't given keep their URLs. The URLs are read and written
+// back without a lock, so concurrent updates of the same site environment can overwrite
+// each other's slots.
+func (c *Client) UpdateURLs(siteID int, environmentID int, slotURLs map[int]string) error {
+	siteEnvironment, err := c.GetSiteEnvironment(siteID, environmentID)
 	if err != nil {
 		return err
 	}
 
-	index := appSlot - 1 // appSlot is 1-100, make it 0-index based
 	splitURL := strings.Split(siteEnvironment.URL, "|")[:]
-	if len(splitURL) < index+1 {
-		newSplitURL := make([]string, index+1)
-		copy(newSplitURL, splitURL)
-		splitURL = newSplitURL
+	for appSlot, newURL := range slotURLs {
+		index := appSlot - 1 // appSlot is 1-100, make it 0-index based
+		if len(splitURL) < index+1 {
+			newSplitURL := make([]string, index+1)
+			copy(newSplitURL, splitURL)
+			splitURL = newSplitURL
+		}
+		splitURL[index] = newURL
 	}
-	splitURL[index] = newURL
 	updatedNewURL := strings.Join(splitURL, "|")
 
 	err = c.setSiteEnvironmentURL(siteEnvironment.ID, updatedNewURL)
@@ -170,23 +226,35 @@ type SiteEnvironment struct {
 	URL           string `json:"url"`
 }
 
-func (c *Client) getSiteEnvironment(siteID int, environmentID int) (SiteEnvironment, error) {
-	var siteEnvironment SiteEnvironment
-
+// GetSiteEnvironments fetches the site environments, which hold the URL of each site in
+// each environment.
+func (c *Client) GetSiteEnvironments() ([]SiteEnvironment, error) {
 	// Prepare request
 	req, err := c.NewRequest("GET", "site_environments", nil)
 	if err != nil {
-		return siteEnvironment, err
+		return nil, err
 	}
 
 	// Send request and process response
 	var resp SiteEnvironmentsData
 	_, err = c.Do(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.SiteEnvironments, nil
+}
+
+// GetSiteEnvironment fetches the site environment of the site and environment
+func (c *Client) GetSiteEnvironment(siteID int, environmentID int) (SiteEnvironment, error) {
+	var siteEnvironment SiteEnvironment
+
+	siteEnvironments, err := c.GetSiteEnvironments()
 	if err != nil {
 		return siteEnvironment, err
 	}
 
-	for _, siteEnvironment := range resp.SiteEnvironments {
+	for _, siteEnvironment := range siteEnvironments {
 		if siteEnvironment.SiteID == siteID && siteEnvironment.EnvironmentID == environmentID {
 			return siteEnvironment, nil
 		}
@@ -195,6 +263,17 @@ func (c *Client) getSiteEnvironment(siteID int, environmentID int) (SiteEnvironm
 	return siteEnvironment, fmt.Errorf("SiteEnvironment not found")
 }
 
+// SetSiteEnvironmentURL replaces the whole URL of the site environment, including all of
+// its app slots.
+func (c *Client) SetSiteEnvironmentURL(siteID int, environmentID int, newURL string) error {
+	siteEnvironment, err := c.GetSiteEnvironment(siteID, environmentID)
+	if err != nil {
+		return err
+	}
+
+	return c.setSiteEnvironmentURL(siteEnvironment.ID, newURL)
+}
+
 // SiteEnvironmentUpdate type is the body of site_environments PUT update for updating the URL
 type SiteEnvironmentUpdate struct {
 	URL string `json:"url"`
@@ -3,10 +3,12 @@ package rainforest
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -171,9 +173,76 @@ func TestUploadToS3(t *testing.T) {
 	if !strings.Contains(test, "500") || !strings.Contains(test, "There was an error uploading your file") {
 		t.Error("Not raising error when AWS server returns bad things.")
 	}
+	if s3Err, ok := err.(*S3Error); !ok || s3Err.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected an S3 error with the status code, got %#v", err)
+	}
 	fakeAWSServer.Close()
 }
 
+func TestUploadToS3WithProgress(t *testing.T) {
+	awsMUX := http.NewServeMux()
+	fakeAWSServer := httptest.NewServer(awsMUX)
+	defer fakeAWSServer.Close()
+
+	const etag = `"c8c7ec1c2c6d1dd0bbe63ac7e6f4fa1c"`
+	awsMUX.HandleFunc("/stuff", func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	postData := RFPresignedPostData{
+		URL:            fakeAWSServer.URL + "/stuff",
+		RequiredFields: map[string]string{"key": "awsKey"},
+	}
+
+	var sent, total int64
+	calls := 0
+	gotETag, err := client.UploadToS3WithProgress(&postData, "test/testfile.txt", func(s, t int64) {
+		sent, total = s, t
+		calls++
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if gotETag != etag {
+		t.Errorf("Incorrect ETag. Have %v, want %v", gotETag, etag)
+	}
+	if calls == 0 || sent != 10 || total != 10 {
+		t.Errorf("Incorrect progress reported. Have %v of %v in %v calls, want 10 of 10", sent, total, calls)
+	}
+}
+
+func TestUploadToS3WithProgress_Incomplete(t *testing.T) {
+	awsMUX := http.NewServeMux()
+	fakeAWSServer := httptest.NewServer(awsMUX)
+	defer fakeAWSServer.Close()
+
+	// S3 responds before the whole file was sent
+	awsMUX.HandleFunc("/stuff", func(w http.ResponseWriter, req *http.Request) {
+		io.CopyN(ioutil.Discard, req.Body, 1024)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	file, err := ioutil.TempFile("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if err = file.Truncate(8 << 20); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	postData := RFPresignedPostData{
+		URL:            fakeAWSServer.URL + "/stuff",
+		RequiredFields: map[string]string{"key": "awsKey"},
+	}
+	if _, err = client.UploadToS3WithProgress(&postData, file.Name(), nil); err == nil {
+		t.Error("Expected an error when the file wasn't sent completely")
+	}
+}
+
 func TestUpdateURL(t *testing.T) {
 	setup()
 	defer cleanup()
@@ -294,3 +363,84 @@ func TestUpdateURL(t *testing.T) {
 		t.Errorf("%v", err)
 	}
 }
+
+func TestUpdateURLs(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/site_environments", func(w http.ResponseWriter, r *http.Request) {
+		respBody := SiteEnvironmentsData{
+			SiteEnvironments: []SiteEnvironment{
+				{ID: 1, SiteID: 123, EnvironmentID: 456, URL: "https://oldurl.com/app1.zip|https://oldurl.com/app2.zip"},
+			},
+		}
+		jsonData, _ := json.Marshal(respBody)
+		w.Write(jsonData)
+	})
+
+	puts := 0
+	mux.HandleFunc("/site_environments/1", func(w http.ResponseWriter, r *http.Request) {
+		puts++
+		var data SiteEnvironmentUpdate
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("%v", err)
+		}
+		want := "https://newurl.com/rider.zip|https://oldurl.com/app2.zip|https://newurl.com/driver.zip"
+		if data.URL != want {
+			t.Errorf("Incorrect URL. Have %v, want %v", data.URL, want)
+		}
+		fmt.Fprint(w, "OK")
+	})
+
+	err := client.UpdateURLs(123, 456, map[int]string{
+		1: "https://newurl.com/rider.zip",
+		3: "https://newurl.com/driver.zip",
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if puts != 1 {
+		t.Errorf("Expected the URL to be updated once, updated %v times", puts)
+	}
+}
+
+func TestSetSiteEnvironmentURL(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc("/site_environments", func(w http.ResponseWriter, r *http.Request) {
+		respBody := SiteEnvironmentsData{
+			SiteEnvironments: []SiteEnvironment{
+				{ID: 7, SiteID: 123, EnvironmentID: 456, URL: "https://oldurl.com|https://oldurl.com/app2.zip"},
+			},
+		}
+		jsonData, _ := json.Marshal(respBody)
+		w.Write(jsonData)
+	})
+
+	mux.HandleFunc("/site_environments/7", func(w http.ResponseWriter, r *http.Request) {
+		var data SiteEnvironmentUpdate
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("%v", err)
+		}
+		if want := "https://newurl.com"; data.URL != want {
+			t.Errorf("Incorrect URL. Have %v, want %v", data.URL, want)
+		}
+		fmt.Fprint(w, "OK")
+	})
+
+	siteEnvironments, err := client.GetSiteEnvironments()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(siteEnvironments) != 1 || siteEnvironments[0].ID != 7 {
+		t.Errorf("Incorrect site environments returned: %+v", siteEnvironments)
+	}
+
+	if err = client.SetSiteEnvironmentURL(123, 456, "https://newurl.com"); err != nil {
+		t.Errorf("%v", err)
+	}
+	if err = client.SetSiteEnvironmentURL(1, 2, "https://newurl.com"); err == nil {
+		t.Error("Expected an error for a missing site environment")
+	}
+}
@@ -152,6 +152,27 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 	return req, nil
 }
 
+// APIError is returned when the API responds with an error status code
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("RF API Error (%v)%v", e.StatusCode, e.Message)
+}
+
+// S3Error is returned when S3 rejects the upload of a file
+type S3Error struct {
+	StatusCode int
+	FileName   string
+	Body       string
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("There was an error uploading your file - %v: S3 Error (%v) %v", e.FileName, e.StatusCode, e.Body)
+}
+
 // checkResponse checks if we received vaild response with code 200,
 // returns error otherwise
 func checkResponse(res *http.Response, debugFlag bool) error {
@@ -167,18 +188,16 @@ func checkResponse(res *http.Response, debugFlag bool) error {
 		return nil
 	}
 
-	errPrefix := fmt.Sprintf("RF API Error (%v)", res.StatusCode)
-
 	// Otherwise we return error from the API or general one if we can't decode it
 	body, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		return errors.New(errPrefix + " - Unable to read response: " + err.Error())
+		return &APIError{StatusCode: res.StatusCode, Message: " - Unable to read response: " + err.Error()}
 	}
 
 	if contentType := res.Header.Get("Content-Type"); contentType != "application/json" {
 		// Just print out the response body as a string
-		return errors.New(errPrefix + ":\n" + string(body))
+		return &APIError{StatusCode: res.StatusCode, Message: ":\n" + string(body)}
 	}
 
 	var out struct {
@@ -190,10 +209,10 @@ func checkResponse(res *http.Response, debugFlag bool) error {
 			fmt.Println("Cannot parse response:\n" + string(body))
 		}
 
-		return errors.New(errPrefix + " - Unable to parse response JSON: " + err.Error())
+		return &APIError{StatusCode: res.StatusCode, Message: " - Unable to parse response JSON: " + err.Error()}
 	}
 
-	return errors.New(errPrefix + ": " + out.Err)
+	return &APIError{StatusCode: res.StatusCode, Message: ": " + out.Err}
 }
 
 // Do sends out the request to the API and unpacks JSON response to the out variable.
@@ -3,6 +3,7 @@ package rainforest
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -22,6 +23,15 @@ type Folder struct {
 // resources are added to the collection. The caller should handle collecting
 // the collection.
 func (c *Client) getPaginatedResource(endpoint string, coll interface{}, collect func(interface{}), params ...string) error {
+	return c.getPaginatedResourceWhile(endpoint, coll, func(coll interface{}) bool {
+		collect(coll)
+		return true
+	}, params...)
+}
+
+// getPaginatedResourceWhile is like getPaginatedResource, but stops fetching pages once
+// collect returns false.
+func (c *Client) getPaginatedResourceWhile(endpoint string, coll interface{}, collect func(interface{}) bool, params ...string) error {
 	params = append(params, "page_size=100")
 	query := strings.Join(params, "&")
 	req, err := c.NewRequest("GET", endpoint+"?"+query, nil)
@@ -31,8 +41,8 @@ func (c *Client) getPaginatedResource(endpoint string, coll interface{}, collect
 
 	var res *http.Response
 	res, err = c.Do(req, &coll)
-	collect(coll)
-	if err != nil {
+	more := collect(coll)
+	if err != nil || !more {
 		return err
 	}
 
@@ -56,8 +66,8 @@ func (c *Client) getPaginatedResource(endpoint string, coll interface{}, collect
 		}
 
 		res, err = c.Do(req, &coll)
-		collect(coll)
-		if err != nil {
+		more = collect(coll)
+		if err != nil || !more {
 			return err
 		}
 	}
@@ -167,22 +177,34 @@ func (c *Client) GetRunGroupDetails(runGroupID int) (*RunGroupDetails, error) {
 }
 
 // GetRunJunit gets a run JUnit from the API.
+//
+// Deprecated: GetRunJunit holds the whole report in memory, use DownloadRunJunit instead.
 func (c *Client) GetRunJunit(runID int) (*string, error) {
-	req, err := c.NewRequest("GET", "runs/"+strconv.Itoa(runID)+"/junit.xml", nil)
+	buf := new(bytes.Buffer)
+	err := c.DownloadRunJunit(runID, buf)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := c.Do(req, nil)
+	newStr := buf.String()
+	return &newStr, nil
+}
+
+// DownloadRunJunit streams a run JUnit from the API to w.
+func (c *Client) DownloadRunJunit(runID int, w io.Writer) error {
+	req, err := c.NewRequest("GET", "runs/"+strconv.Itoa(runID)+"/junit.xml", nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(res.Body)
-	newStr := buf.String()
+	res, err := c.Do(req, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
 
-	return &newStr, nil
+	_, err = io.Copy(w, res.Body)
+	return err
 }
 
 // Site type represents a single site returned by the API call for a list of sites
@@ -2,12 +2,12 @@ package rainforest
 
 import (
 	"bufio"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -371,121 +371,370 @@ func (r *RFMLWriter) WriteRFMLTest(test *RFTest) error {
 // ParseEmbeddedFiles replaces file step variable paths with values expected
 // by Rainforest. eg: {{ file.screenshot(my_screenshot.gif) }} would be translated
 // to the format {{ file.screenshot(FILE_ID, FILE_SIGNATURE) }}.
-func (c *Client) ParseEmbeddedFiles(test *RFTest) error {
-	if test.TestID == 0 {
-		return fmt.Errorf("Cannot parse embedded files without a test ID.")
+//
+// All embedded files are checked before anything is uploaded. Missing, unsupported
+// or oversized files are returned as EmbeddedFileErrors. Identical files referenced
+// from several of the given tests are only uploaded once.
+func (c *Client) ParseEmbeddedFiles(tests ...*RFTest) error {
+	var refs []*embeddedFileRef
+	var fileErrors EmbeddedFileErrors
+	for _, test := range tests {
+		if test.TestID == 0 {
+			return fmt.Errorf("Cannot parse embedded files without a test ID.")
+		}
+
+		testRefs, errs := findEmbeddedFileRefs(test)
+		refs = append(refs, testRefs...)
+		fileErrors = append(fileErrors, errs...)
 	}
 
-	uploadedFiles, err := c.getUploadedFiles(test.TestID)
-	if err != nil {
-		return err
+	if len(fileErrors) > 0 {
+		return fileErrors
+	}
+	if len(refs) == 0 {
+		return nil
 	}
 
+	digests := map[string]string{}
+	for _, ref := range refs {
+		if err := ref.computeDigest(digests); err != nil {
+			return err
+		}
+	}
+
+	// Gather the files that were uploaded to any of the tests before
 	digestToFileMap := map[string]uploadedFile{}
-	for _, f := range uploadedFiles {
-		digestToFileMap[f.Digest] = f
-	}
-
-	replaceEmbeddedFilePaths := func(text string, embeddedFiles []embeddedFile) (string, error) {
-		out := text
-		for _, embed := range embeddedFiles {
-			filePath := embed.path
-			if strings.HasPrefix(filePath, "~/") {
-				var usr *user.User
-				usr, err = user.Current()
-				if err != nil {
-					return "", err
-				}
-				filePath = filepath.Join(usr.HomeDir, filePath[2:])
-			} else if test.RFMLPath == "" {
-				return "", fmt.Errorf("Cannot parse relative file path %v for RFML test %v. RFMLPath field cannot be blank.", filePath, test.RFMLID)
-			} else {
-				rfmlDirectory := filepath.Dir(test.RFMLPath)
-				filePath = filepath.Join(rfmlDirectory, filePath)
-			}
+	fetchedTests := map[int]bool{}
+	for _, ref := range refs {
+		if fetchedTests[ref.test.TestID] {
+			continue
+		}
+		fetchedTests[ref.test.TestID] = true
 
-			filePath, err = filepath.Abs(filePath)
-			if err != nil {
-				return "", err
+		uploadedFiles, err := c.getUploadedFiles(ref.test.TestID)
+		if err != nil {
+			return err
+		}
+		for _, f := range uploadedFiles {
+			if _, ok := digestToFileMap[f.Digest]; !ok {
+				digestToFileMap[f.Digest] = f
 			}
+		}
+	}
 
-			var file *os.File
-			file, err = os.Open(filePath)
+	// Figure out which files still need to be uploaded, once per unique content
+	var toUpload []*embeddedFileRef
+	seenDigests := map[string]bool{}
+	for _, ref := range refs {
+		if seenDigests[ref.digest] {
+			continue
+		}
+		seenDigests[ref.digest] = true
 
-			if os.IsNotExist(err) {
-				log.Printf("Error for test: %v\n\tNo such file exists: %v\n", test.RFMLPath, filePath)
-				continue
-			} else if err != nil {
-				return "", err
-			}
+		existing, ok := digestToFileMap[ref.digest]
+		if ok && (existing.MimeType == "" || existing.MimeType == ref.mimeType) {
+			continue
+		}
+		toUpload = append(toUpload, ref)
+	}
 
-			var data []byte
-			data, err = ioutil.ReadAll(file)
-			defer file.Close()
-			if err != nil {
-				return "", err
-			}
+	if len(toUpload) > 0 {
+		uploaded, err := c.uploadEmbeddedFiles(toUpload)
+		if err != nil {
+			return err
+		}
+		for digest, f := range uploaded {
+			digestToFileMap[digest] = f
+		}
+	}
 
-			checksum := md5.Sum(data)
-			fileDigest := hex.EncodeToString(checksum[:])
-			uploadedFileInfo, ok := digestToFileMap[fileDigest]
-			// TODO: Check mime type as well
-			if !ok {
-				// File has not been uploaded before
-				// Upload to RF
-				var awsInfo *awsFileInfo
-				awsInfo, err = c.createTestFile(test.TestID, file, data)
-				if err != nil {
-					return "", err
-				}
-				// Upload to AWS
-				err = c.uploadEmbeddedFile(filepath.Base(filePath), data, awsInfo)
-				if err != nil {
-					return "", err
-				}
-				uploadedFileInfo = uploadedFile{
-					ID:        awsInfo.FileID,
-					Signature: awsInfo.FileSignature,
-					Key:       awsInfo.FileKey,
-					Digest:    fileDigest,
-				}
-				// Add to the mappings for future reference
-				digestToFileMap[fileDigest] = uploadedFileInfo
-			}
+	for _, ref := range refs {
+		ref.replace(digestToFileMap[ref.digest])
+	}
+
+	return nil
+}
+
+// uploadEmbeddedFiles uploads the given files concurrently, logging the progress as
+// it goes. It returns the uploaded files mapped by their digests.
+func (c *Client) uploadEmbeddedFiles(refs []*embeddedFileRef) (map[string]uploadedFile, error) {
+	type uploadResult struct {
+		digest string
+		file   uploadedFile
+		err    error
+	}
 
-			sig := uploadedFileInfo.Signature[0:6]
-			var replacement string
-			if embed.stepVar == "screenshot" {
-				replacement = fmt.Sprintf("{{ file.screenshot(%v, %v) }}", uploadedFileInfo.ID, sig)
-			} else if embed.stepVar == "download" {
-				replacement = fmt.Sprintf("{{ file.download(%v, %v, %v) }}", uploadedFileInfo.Key, sig, filepath.Base(filePath))
+	refsChan := make(chan *embeddedFileRef, len(refs))
+	for _, ref := range refs {
+		refsChan <- ref
+	}
+	close(refsChan)
+
+	resultsChan := make(chan uploadResult, len(refs))
+	for i := 0; i < embeddedFileUploadConcurrency; i++ {
+		go func() {
+			for ref := range refsChan {
+				f, err := c.uploadEmbeddedFileRef(ref)
+				resultsChan <- uploadResult{ref.digest, f, err}
 			}
+		}()
+	}
 
-			out = strings.Replace(out, embed.text, replacement, 1)
+	log.Printf("Uploading %v embedded files...", len(refs))
+	uploaded := make(map[string]uploadedFile, len(refs))
+	var firstErr error
+	for i := 0; i < len(refs); i++ {
+		res := <-resultsChan
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
 		}
+		uploaded[res.digest] = res.file
+		log.Printf("Embedded file %v uploaded (%v of %v).", res.file.Name, i+1, len(refs))
+	}
+
+	return uploaded, firstErr
+}
+
+// uploadEmbeddedFileRef registers the referenced file with Rainforest and uploads its
+// contents to AWS.
+func (c *Client) uploadEmbeddedFileRef(ref *embeddedFileRef) (uploadedFile, error) {
+	file, err := os.Open(ref.absPath)
+	if err != nil {
+		return uploadedFile{}, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return uploadedFile{}, err
+	}
+
+	fileName := filepath.Base(ref.absPath)
+	awsInfo, err := c.createTestFile(ref.test.TestID, file, data)
+	if err != nil {
+		return uploadedFile{}, err
+	}
+
+	err = c.uploadEmbeddedFile(fileName, data, awsInfo)
+	if err != nil {
+		return uploadedFile{}, err
+	}
+
+	return uploadedFile{
+		ID:        awsInfo.FileID,
+		Signature: awsInfo.FileSignature,
+		Key:       awsInfo.FileKey,
+		Digest:    ref.digest,
+		MimeType:  ref.mimeType,
+		Size:      ref.size,
+		Name:      fileName,
+	}, nil
+}
+
+// embeddedFileRef is a single embedded file found in a test step, resolved to a
+// file on disk.
+type embeddedFileRef struct {
+	test    *RFTest
+	stepIdx int
+	// inAction is true when the file is embedded in the step action, false when it's
+	// in the step response.
+	inAction bool
+	embed    embeddedFile
+
+	absPath  string
+	digest   string
+	mimeType string
+	size     int64
+}
 
-		return out, nil
+// replace swaps the step variable referencing a local path for the one referencing
+// the uploaded file.
+func (ref *embeddedFileRef) replace(f uploadedFile) {
+	sig := f.Signature
+	if len(sig) > 6 {
+		sig = sig[0:6]
 	}
 
+	var replacement string
+	if ref.embed.stepVar == "screenshot" {
+		replacement = fmt.Sprintf("{{ file.screenshot(%v, %v) }}", f.ID, sig)
+	} else if ref.embed.stepVar == "download" {
+		replacement = fmt.Sprintf("{{ file.download(%v, %v, %v) }}", f.Key, sig, filepath.Base(ref.absPath))
+	}
+
+	step := ref.test.Steps[ref.stepIdx].(RFTestStep)
+	if ref.inAction {
+		step.Action = strings.Replace(step.Action, ref.embed.text, replacement, 1)
+	} else {
+		step.Response = strings.Replace(step.Response, ref.embed.text, replacement, 1)
+	}
+	ref.test.Steps[ref.stepIdx] = step
+}
+
+// ValidateEmbeddedFiles checks that all of the files embedded in a test exist, are
+// readable and can be uploaded to Rainforest. Paths are resolved relative to the
+// test's RFML file.
+func ValidateEmbeddedFiles(test *RFTest) EmbeddedFileErrors {
+	_, fileErrors := findEmbeddedFileRefs(test)
+	return fileErrors
+}
+
+// findEmbeddedFileRefs resolves and checks all of the embedded files in a test.
+// Files that can't be uploaded are returned as errors.
+func findEmbeddedFileRefs(test *RFTest) ([]*embeddedFileRef, EmbeddedFileErrors) {
+	var refs []*embeddedFileRef
+	var fileErrors EmbeddedFileErrors
+
 	for idx, step := range test.Steps {
 		s, ok := step.(RFTestStep)
-		if ok && s.hasUploadableFiles() {
-			if embeddedFiles := s.embeddedFilesInAction(); len(embeddedFiles) > 0 {
-				s.Action, err = replaceEmbeddedFilePaths(s.Action, embeddedFiles)
-				if err != nil {
-					return err
-				}
-			}
+		if !ok {
+			continue
+		}
 
-			if embeddedFiles := s.embeddedFilesInResponse(); len(embeddedFiles) > 0 {
-				s.Response, err = replaceEmbeddedFilePaths(s.Response, embeddedFiles)
-				if err != nil {
-					return err
+		for _, part := range []struct {
+			inAction bool
+			embeds   []embeddedFile
+		}{
+			{true, s.embeddedFilesInAction()},
+			{false, s.embeddedFilesInResponse()},
+		} {
+			for _, embed := range part.embeds {
+				ref := &embeddedFileRef{test: test, stepIdx: idx, inAction: part.inAction, embed: embed}
+				if err := ref.check(); err != nil {
+					fileErrors = append(fileErrors, EmbeddedFileError{
+						RFMLPath: test.RFMLPath,
+						Step:     idx + 1,
+						Path:     embed.path,
+						Reason:   err.Error(),
+					})
+					continue
 				}
+				refs = append(refs, ref)
 			}
-			test.Steps[idx] = s
 		}
 	}
 
+	return refs, fileErrors
+}
+
+// check finds the referenced file on disk, checks it can be uploaded and fills in
+// its MIME type and size.
+func (ref *embeddedFileRef) check() error {
+	absPath, err := resolveEmbeddedFilePath(ref.test.RFMLPath, ref.embed.path)
+	if err != nil {
+		return err
+	}
+	ref.absPath = absPath
+
+	fileInfo, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no such file exists: %v", absPath)
+	} else if err != nil {
+		return err
+	}
+	if fileInfo.IsDir() {
+		return fmt.Errorf("%v is a directory", absPath)
+	}
+	ref.size = fileInfo.Size()
+	if ref.size > maxEmbeddedFileSize {
+		return fmt.Errorf("%v is %v bytes, the maximum allowed size is %v bytes", absPath, ref.size, maxEmbeddedFileSize)
+	}
+
+	if filepath.Ext(absPath) == "" {
+		return fmt.Errorf("%v has no file extension", absPath)
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("%v is not readable: %v", absPath, err)
+	}
+	defer file.Close()
+
+	ref.mimeType, err = embeddedFileMimeType(file)
+	if err != nil {
+		return fmt.Errorf("%v is not readable: %v", absPath, err)
+	}
+	if ref.embed.stepVar == "screenshot" && !strings.HasPrefix(ref.mimeType, "image/") {
+		return fmt.Errorf("%v has MIME type %v, screenshots must be images", absPath, ref.mimeType)
+	}
+
 	return nil
 }
+
+// computeDigest fills in the MD5 digest of the referenced file. digests caches
+// digests of already hashed paths.
+func (ref *embeddedFileRef) computeDigest(digests map[string]string) error {
+	if digest, ok := digests[ref.absPath]; ok {
+		ref.digest = digest
+		return nil
+	}
+
+	digest, err := fileDigest(ref.absPath)
+	if err != nil {
+		return err
+	}
+	ref.digest = digest
+	digests[ref.absPath] = digest
+
+	return nil
+}
+
+// resolveEmbeddedFilePath returns the absolute path of an embedded file. Paths are
+// relative to the RFML file, unless they start with ~/.
+func resolveEmbeddedFilePath(rfmlPath, filePath string) (string, error) {
+	if strings.HasPrefix(filePath, "~/") {
+		usr, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		filePath = filepath.Join(usr.HomeDir, filePath[2:])
+	} else if rfmlPath == "" {
+		return "", fmt.Errorf("Cannot parse relative file path %v. RFMLPath field cannot be blank.", filePath)
+	} else {
+		filePath = filepath.Join(filepath.Dir(rfmlPath), filePath)
+	}
+
+	return filepath.Abs(filePath)
+}
+
+// embeddedFileMimeType returns the MIME type of a file based on its extension,
+// falling back to sniffing its contents.
+func embeddedFileMimeType(file *os.File) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(file.Name())); mimeType != "" {
+		return mimeType, nil
+	}
+
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// EmbeddedFileError is an error for a single embedded file in an RFML test.
+type EmbeddedFileError struct {
+	RFMLPath string
+	// Step is the 1-based position of the step embedding the file
+	Step   int
+	Path   string
+	Reason string
+}
+
+func (e EmbeddedFileError) Error() string {
+	return fmt.Sprintf("%v: step %v - embedded file %v: %v", e.RFMLPath, e.Step, e.Path, e.Reason)
+}
+
+// EmbeddedFileErrors collects all of the embedded file errors found in the tests.
+type EmbeddedFileErrors []EmbeddedFileError
+
+func (e EmbeddedFileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
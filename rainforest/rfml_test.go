@@ -15,6 +15,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -576,10 +577,8 @@ func TestParseEmbeddedFiles(t *testing.T) {
 
 	existingScreenshotPath := "./assets/screenshot1.png"
 	newScreenshotPath := "./assets/screenshot2.png"
-	nonexistentScreenshotPath := "./foo"
 	existingDownloadPath := "./existing.txt"
 	newDownloadPath := "./new.txt"
-	nonexistentFilePath := "./bar"
 
 	test := RFTest{
 		TestID: 5678,
@@ -592,10 +591,6 @@ func TestParseEmbeddedFiles(t *testing.T) {
 				Action:   fmt.Sprintf("Embedding a new screenshot {{ file.screenshot(%v) }}", newScreenshotPath),
 				Response: fmt.Sprintf("Embedded a new download {{file.download(%v) }}", newDownloadPath),
 			},
-			RFTestStep{
-				Action:   fmt.Sprintf("Embedding a non-existent screenshot {{  file.screenshot(%v) }}", nonexistentScreenshotPath),
-				Response: fmt.Sprintf("Embedding a non-existent download {{ file.download(%v)  }}", nonexistentFilePath),
-			},
 		},
 		// Test does not exist, but this path is used to find the relative path to the
 		// embedded files in the action and response.
@@ -719,8 +714,7 @@ func TestParseEmbeddedFiles(t *testing.T) {
 		}
 	})
 
-	out := &bytes.Buffer{}
-	log.SetOutput(out)
+	log.SetOutput(ioutil.Discard)
 	defer log.SetOutput(os.Stdout)
 
 	err = client.ParseEmbeddedFiles(&test)
@@ -753,20 +747,214 @@ func TestParseEmbeddedFiles(t *testing.T) {
 	if !strings.Contains(step.Response, expectedStr) {
 		t.Errorf("Expected to find %v in %v", expectedStr, step.Response)
 	}
+}
+
+func TestParseEmbeddedFilesValidation(t *testing.T) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	testDir := filepath.Join(pwd, "./test")
+	rfmlPath := filepath.Join(testDir, "./fake_test.rfml")
+
+	test := RFTest{
+		TestID: 5678,
+		Steps: []interface{}{
+			RFTestStep{
+				Action:   "Embedding a non-existent screenshot {{ file.screenshot(./foo) }}",
+				Response: "Embedding a non-existent download {{ file.download(./bar) }}?",
+			},
+			RFTestStep{
+				Action:   "Embedding a text file as a screenshot {{ file.screenshot(./testfile.txt) }}",
+				Response: "Embedding an existing download {{ file.download(./testfile.txt) }}?",
+			},
+		},
+		RFMLPath: rfmlPath,
+	}
+
+	setup()
+	defer cleanup()
+
+	mux.HandleFunc(fmt.Sprintf("/tests/%v/files", test.TestID), func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected %v request, nothing should be uploaded when files are invalid", r.Method)
+	})
+
+	err = client.ParseEmbeddedFiles(&test)
+	fileErrors, ok := err.(EmbeddedFileErrors)
+	if !ok {
+		t.Fatalf("Expected EmbeddedFileErrors, got %#v", err)
+	}
+
+	expected := []struct {
+		step int
+		path string
+	}{
+		{1, "./foo"},
+		{1, "./bar"},
+		{2, "./testfile.txt"},
+	}
+	if len(fileErrors) != len(expected) {
+		t.Fatalf("Expected %v errors, got %v: %v", len(expected), len(fileErrors), fileErrors)
+	}
+	for i, exp := range expected {
+		if fileErrors[i].Step != exp.step || fileErrors[i].Path != exp.path || fileErrors[i].RFMLPath != rfmlPath {
+			t.Errorf("Unexpected error %#v, expected step %v and path %v", fileErrors[i], exp.step, exp.path)
+		}
+	}
+
+	if !strings.Contains(fileErrors[0].Reason, "no such file exists") {
+		t.Errorf("Expected missing file error, got %v", fileErrors[0].Reason)
+	}
+	if !strings.Contains(fileErrors[2].Reason, "screenshots must be images") {
+		t.Errorf("Expected MIME type error, got %v", fileErrors[2].Reason)
+	}
+
+	// Oversized files are rejected
+	defer func(size int64) { maxEmbeddedFileSize = size }(maxEmbeddedFileSize)
+	maxEmbeddedFileSize = 1
+	test.Steps = []interface{}{
+		RFTestStep{
+			Action:   "Embedding a big download {{ file.download(./testfile.txt) }}",
+			Response: "Is it too big?",
+		},
+	}
+
+	err = client.ParseEmbeddedFiles(&test)
+	if fileErrors, ok = err.(EmbeddedFileErrors); !ok || len(fileErrors) != 1 {
+		t.Fatalf("Expected a single EmbeddedFileError, got %#v", err)
+	}
+	if !strings.Contains(fileErrors[0].Reason, "maximum allowed size") {
+		t.Errorf("Expected file size error, got %v", fileErrors[0].Reason)
+	}
+}
+
+func TestValidateEmbeddedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rfml-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]os.FileMode{
+		"noextension":    0644,
+		"unreadable.txt": 0000,
+		"valid.txt":      0644,
+	}
+	for name, mode := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("data"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	test := &RFTest{
+		RFMLPath: filepath.Join(dir, "test.rfml"),
+		Steps: []interface{}{
+			RFTestStep{
+				Action:   "Download {{ file.download(./valid.txt) }}",
+				Response: "Download {{ file.download(./noextension) }}",
+			},
+			RFEmbeddedTest{RFMLID: "embedded"},
+			RFTestStep{
+				Action:   "Download {{ file.download(./unreadable.txt) }}",
+				Response: "Did it work?",
+			},
+		},
+	}
+
+	fileErrors := ValidateEmbeddedFiles(test)
+
+	expected := []struct {
+		step   int
+		path   string
+		reason string
+	}{
+		{1, "./noextension", "has no file extension"},
+		{3, "./unreadable.txt", "is not readable"},
+	}
+	if os.Geteuid() == 0 {
+		// root can read any file
+		expected = expected[:1]
+	}
+	if len(fileErrors) != len(expected) {
+		t.Fatalf("Expected %v errors, got %v: %v", len(expected), len(fileErrors), fileErrors)
+	}
+	for i, exp := range expected {
+		fileErr := fileErrors[i]
+		if fileErr.Step != exp.step || fileErr.Path != exp.path || !strings.Contains(fileErr.Reason, exp.reason) {
+			t.Errorf("Unexpected error %#v, expected step %v, path %v and reason %v", fileErr, exp.step, exp.path, exp.reason)
+		}
+	}
+}
+
+func TestParseEmbeddedFilesAcrossTests(t *testing.T) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	testDir := filepath.Join(pwd, "./test")
+	step := RFTestStep{
+		Action:   "Embedding a screenshot {{ file.screenshot(./assets/screenshot2.png) }}",
+		Response: "And the same one again {{ file.screenshot(./assets/screenshot2.png) }}?",
+	}
+	firstTest := RFTest{
+		TestID:   1111,
+		Steps:    []interface{}{step},
+		RFMLPath: filepath.Join(testDir, "./first_test.rfml"),
+	}
+	secondTest := RFTest{
+		TestID:   2222,
+		Steps:    []interface{}{step},
+		RFMLPath: filepath.Join(testDir, "./assets/../second_test.rfml"),
+	}
 
-	// Check for logger warning for nonexistent files
-	logs := out.String()
-	// -- File download error
-	absPath := filepath.Join(testDir, nonexistentFilePath)
-	expectedError := fmt.Sprintf("Error for test: %v\n\tNo such file exists: %v", test.RFMLPath, absPath)
-	if !strings.Contains(logs, expectedError) {
-		t.Errorf("Expecting nonexistent file error for %v. Got: %v", test.RFMLPath, logs)
+	var awsUploads int
+	var mu sync.Mutex
+	awsTestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		awsUploads++
+	}))
+	defer awsTestServer.Close()
+
+	setup()
+	defer cleanup()
+
+	var posts int
+	filesHandler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode([]uploadedFile{})
+		case "POST":
+			mu.Lock()
+			posts++
+			mu.Unlock()
+			json.NewEncoder(w).Encode(awsFileInfo{FileID: 42, FileSignature: "abcdefgh", URL: awsTestServer.URL})
+		}
+	}
+	mux.HandleFunc(fmt.Sprintf("/tests/%v/files", firstTest.TestID), filesHandler)
+	mux.HandleFunc(fmt.Sprintf("/tests/%v/files", secondTest.TestID), filesHandler)
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stdout)
+
+	err = client.ParseEmbeddedFiles(&firstTest, &secondTest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if posts != 1 || awsUploads != 1 {
+		t.Errorf("Expected the file to be uploaded once, got %v file creations and %v AWS uploads", posts, awsUploads)
 	}
 
-	// -- Screenshot error
-	absPath = filepath.Join(testDir, nonexistentScreenshotPath)
-	expectedError = fmt.Sprintf("Error for test: %v\n\tNo such file exists: %v", test.RFMLPath, absPath)
-	if !strings.Contains(logs, expectedError) {
-		t.Errorf("Expecting nonexistent file error for %v. Got: %v", test.RFMLPath, logs)
+	expected := RFTestStep{
+		Action:   "Embedding a screenshot {{ file.screenshot(42, abcdef) }}",
+		Response: "And the same one again {{ file.screenshot(42, abcdef) }}?",
+	}
+	for _, test := range []RFTest{firstTest, secondTest} {
+		if !reflect.DeepEqual(test.Steps[0], expected) {
+			t.Errorf("Unexpected step %#v, expected %#v", test.Steps[0], expected)
+		}
 	}
 }
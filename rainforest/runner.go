@@ -3,7 +3,9 @@ package rainforest
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
+	"time"
 )
 
 // RunParams is a struct holding all potential parameters needed to start a new RF run.
@@ -44,7 +46,20 @@ type RunStatus struct {
 		Passed   int `json:"passed"`
 		Failed   int `json:"failed"`
 	} `json:"current_progress"`
-	FrontendURL string `json:"frontend_url,omitempty"`
+	FrontendURL string    `json:"frontend_url,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RunTest represents the result of a single test in a RF run.
+type RunTest struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	State     string    `json:"state"`
+	Result    string    `json:"result"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // CreateRun starts a new RF run with given params.
@@ -163,3 +178,113 @@ func (c *Client) CheckRunStatus(runID int) (*RunStatus, error) {
 
 	return &runStatus, nil
 }
+
+// CancelRun cancels the run with the given ID.
+func (c *Client) CancelRun(runID int) error {
+	req, err := c.NewRequest("DELETE", "runs/"+strconv.Itoa(runID), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+// GetRunTests returns the tests of the run with their results.
+func (c *Client) GetRunTests(runID int) ([]RunTest, error) {
+	var runTests []RunTest
+
+	collect := func(coll interface{}) {
+		newRunTests := coll.(*[]RunTest)
+		runTests = append(runTests, *newRunTests...)
+	}
+
+	err := c.getPaginatedResource("runs/"+strconv.Itoa(runID)+"/tests", &[]RunTest{}, collect)
+	if err != nil {
+		return nil, err
+	}
+
+	return runTests, nil
+}
+
+// Run represents a RF run in the list of runs.
+type Run struct {
+	ID          int          `json:"id"`
+	State       string       `json:"state"`
+	Result      string       `json:"result"`
+	Description string       `json:"description"`
+	Release     string       `json:"release"`
+	Branch      *Branch      `json:"branch"`
+	Environment *Environment `json:"environment"`
+	RunGroupID  int          `json:"run_group_id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	FrontendURL string       `json:"frontend_url,omitempty"`
+}
+
+// RunFilters are the filters of the list of runs. Filters with a zero value aren't applied.
+type RunFilters struct {
+	State         string
+	Result        string
+	Release       string
+	Description   string
+	BranchID      int
+	EnvironmentID int
+	RunGroupID    int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Limit is the maximum number of runs to get, 0 gets all of them
+	Limit int
+}
+
+// params returns the filters as query parameters
+func (f RunFilters) params() []string {
+	var params []string
+	addParam := func(name, value string) {
+		if value != "" {
+			params = append(params, name+"="+url.QueryEscape(value))
+		}
+	}
+	addIDParam := func(name string, id int) {
+		if id > 0 {
+			params = append(params, name+"="+strconv.Itoa(id))
+		}
+	}
+	addTimeParam := func(name string, t time.Time) {
+		if !t.IsZero() {
+			addParam(name, t.UTC().Format(time.RFC3339))
+		}
+	}
+
+	addParam("state", f.State)
+	addParam("result", f.Result)
+	addParam("release", f.Release)
+	addParam("description", f.Description)
+	addIDParam("branch_id", f.BranchID)
+	addIDParam("environment_id", f.EnvironmentID)
+	addIDParam("run_group_id", f.RunGroupID)
+	addTimeParam("created_after", f.CreatedAfter)
+	addTimeParam("created_before", f.CreatedBefore)
+	return params
+}
+
+// GetRuns returns the runs matching the filters, most recent first, up to filters.Limit runs.
+func (c *Client) GetRuns(filters RunFilters) ([]Run, error) {
+	var runs []Run
+
+	// No more pages are fetched once there are enough runs
+	collect := func(coll interface{}) bool {
+		newRuns := coll.(*[]Run)
+		runs = append(runs, *newRuns...)
+		return filters.Limit == 0 || len(runs) < filters.Limit
+	}
+
+	err := c.getPaginatedResourceWhile("runs", &[]Run{}, collect, filters.params()...)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.Limit > 0 && len(runs) > filters.Limit {
+		runs = runs[:filters.Limit]
+	}
+	return runs, nil
+}
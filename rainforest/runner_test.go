@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateRun(t *testing.T) {
@@ -275,3 +278,146 @@ func TestCheckRunStatus(t *testing.T) {
 		t.Errorf("Response out = %v, want %v", out, want)
 	}
 }
+
+func TestCancelRun(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "DELETE"
+	called := false
+
+	mux.HandleFunc("/runs/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+		called = true
+		fmt.Fprint(w, `{"id": 123, "state":"aborted"}`)
+	})
+
+	if err := client.CancelRun(123); err != nil {
+		t.Error(err)
+	}
+	if !called {
+		t.Error("Expected the run to be cancelled")
+	}
+}
+
+func TestGetRunTests(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "GET"
+
+	mux.HandleFunc("/runs/123/tests", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+
+		fmt.Fprint(w, `[{"id": 1, "title": "Login", "state": "complete", "result": "passed",
+			"created_at": "2020-01-01T10:00:00Z", "updated_at": "2020-01-01T10:02:30Z"},
+			{"id": 2, "title": "Logout", "state": "complete", "result": "failed"}]`)
+	})
+
+	out, err := client.GetRunTests(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []RunTest{
+		{
+			ID:        1,
+			Title:     "Login",
+			State:     "complete",
+			Result:    "passed",
+			CreatedAt: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2020, 1, 1, 10, 2, 30, 0, time.UTC),
+		},
+		{ID: 2, Title: "Logout", State: "complete", Result: "failed"},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Response out = %v, want %v", out, want)
+	}
+}
+
+func TestGetRuns(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "GET"
+	const pages = 2
+
+	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+
+		query := r.URL.Query()
+		want := url.Values{
+			"state":          {"complete"},
+			"result":         {"failed"},
+			"release":        {"1.2 rc"},
+			"branch_id":      {"7"},
+			"environment_id": {"8"},
+			"created_after":  {"2020-01-01T00:00:00Z"},
+			"page_size":      {"100"},
+		}
+		runID := 1
+		if page := query.Get("page"); page != "" {
+			want.Set("page", page)
+			runID, _ = strconv.Atoi(page)
+		}
+		if !reflect.DeepEqual(query, want) {
+			t.Errorf("Query = %v, want %v", query, want)
+		}
+
+		w.Header().Add("X-Total-Pages", strconv.Itoa(pages))
+		fmt.Fprintf(w, `[{"id": %v, "state": "complete", "result": "failed", "release": "1.2 rc",
+			"branch": {"id": 7, "name": "feature"}, "environment": {"id": 8, "name": "QA"}}]`, runID)
+	})
+
+	out, err := client.GetRuns(RunFilters{
+		State:         "complete",
+		Result:        "failed",
+		Release:       "1.2 rc",
+		BranchID:      7,
+		EnvironmentID: 8,
+		CreatedAfter:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != pages || out[0].ID != 1 || out[1].ID != 2 {
+		t.Fatalf("Expected a run from each page, got %+v", out)
+	}
+	if out[0].Branch.Name != "feature" || out[0].Environment.Name != "QA" || out[0].Release != "1.2 rc" {
+		t.Errorf("Unexpected run %+v", out[0])
+	}
+}
+
+func TestGetRuns_Limit(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	requests := 0
+	mux.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		w.Header().Add("X-Total-Pages", "5")
+		fmt.Fprintf(w, `[{"id": %v}, {"id": %v}]`, 2*page-1, 2*page)
+	})
+
+	out, err := client.GetRuns(RunFilters{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || out[2].ID != 3 {
+		t.Errorf("Expected the first 3 runs, got %+v", out)
+	}
+	if requests != 2 {
+		t.Errorf("Expected pages to be fetched until there are enough runs, got %v requests", requests)
+	}
+}
@@ -26,6 +26,12 @@ type GeneratorColumn struct {
 	Name      string    `json:"name,omitempty"`
 }
 
+// GeneratorRow is a type of row in a tabular generator. Values are keyed by the column ID.
+type GeneratorRow struct {
+	ID     int            `json:"id,omitempty"`
+	Values map[int]string `json:"values,omitempty"`
+}
+
 // GeneratorRelatedTests is a type which holds tests where the generator has been used
 type GeneratorRelatedTests struct {
 	ID    int    `json:"id,omitempty"`
@@ -47,6 +53,24 @@ func (c *Client) GetGenerators(params ...string) ([]Generator, error) {
 	return generators, err
 }
 
+// GetGeneratorRows fetches all rows of the generator with specified ID
+func (c *Client) GetGeneratorRows(genID int) ([]GeneratorRow, error) {
+	var rows []GeneratorRow
+
+	collect := func(coll interface{}) {
+		newRows := coll.(*[]GeneratorRow)
+		for _, row := range *newRows {
+			rows = append(rows, row)
+		}
+		// The next page is decoded into the same slice, so make sure the
+		// collected rows don't share their values maps with it.
+		*newRows = nil
+	}
+
+	err := c.getPaginatedResource("generators/"+strconv.Itoa(genID)+"/rows", &[]GeneratorRow{}, collect)
+	return rows, err
+}
+
 // DeleteGenerator deletes generator with specified ID
 func (c *Client) DeleteGenerator(genID int) error {
 	// Prepare request
@@ -65,6 +89,34 @@ func (c *Client) DeleteGenerator(genID int) error {
 	return nil
 }
 
+// RenameGenerator changes the name of the generator with specified ID
+func (c *Client) RenameGenerator(genID int, name string) error {
+	body := struct {
+		Name string `json:"name"`
+	}{name}
+	req, err := c.NewRequest("PUT", "generators/"+strconv.Itoa(genID), body)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+// UpdateGeneratorDescription changes the description of the generator with specified ID
+func (c *Client) UpdateGeneratorDescription(genID int, description string) error {
+	body := struct {
+		Description string `json:"description"`
+	}{description}
+	req, err := c.NewRequest("PUT", "generators/"+strconv.Itoa(genID), body)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
 // CreateTabularVar creates new tabular variable on RF and returns Generator associated with it
 // columns argument should contain just an array of column names, contents of the generator should
 // be filled using AddGeneratorRows.
@@ -117,6 +169,36 @@ func (c *Client) AddGeneratorRows(targetGenerator *Generator, rowData []map[int]
 	return nil
 }
 
+// UpdateGeneratorRow replaces the values of a row in the specified tabular variable
+// values is in a form of { 123: "foo", 124: "bar" } where 123 is a column ID
+func (c *Client) UpdateGeneratorRow(targetGenerator *Generator, rowID int, values map[int]string) error {
+	//Prepare request
+	type rowRequest struct {
+		Values map[int]string `json:"data,omitempty"`
+	}
+	body := rowRequest{values}
+	reqURL := "generators/" + strconv.Itoa(targetGenerator.ID) + "/rows/" + strconv.Itoa(rowID)
+	req, err := c.NewRequest("PUT", reqURL, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
+// DeleteGeneratorRow deletes a row from the specified tabular variable
+func (c *Client) DeleteGeneratorRow(targetGenerator *Generator, rowID int) error {
+	reqURL := "generators/" + strconv.Itoa(targetGenerator.ID) + "/rows/" + strconv.Itoa(rowID)
+	req, err := c.NewRequest("DELETE", reqURL, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil)
+	return err
+}
+
 // AddGeneratorRowsFromTable adds rows to the specified tabular variable
 // data should be formatted as follows:
 // targetColumns contains names of existing columns to which add data e.g. ["login", "password"]
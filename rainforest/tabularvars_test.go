@@ -2,6 +2,7 @@ package rainforest
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -55,6 +56,41 @@ func TestGetGenerators(t *testing.T) {
 	}
 }
 
+func TestGetGeneratorRows(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "GET"
+	const genID = 1337
+
+	mux.HandleFunc("/generators/"+strconv.Itoa(genID)+"/rows", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"id":3,"values":{"30225":"baz","30226":"qux"}}]`)
+			return
+		}
+		w.Header().Set("X-Total-Pages", "2")
+		fmt.Fprint(w, `[{"id":1,"values":{"30225":"foo","30226":"bar"}},{"id":2,"values":{"30225":"wut"}}]`)
+	})
+
+	out, err := client.GetGeneratorRows(genID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []GeneratorRow{
+		{ID: 1, Values: map[int]string{30225: "foo", 30226: "bar"}},
+		{ID: 2, Values: map[int]string{30225: "wut"}},
+		{ID: 3, Values: map[int]string{30225: "baz", 30226: "qux"}},
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Response out = %v, want %v", out, want)
+	}
+}
+
 func TestDeleteGenerator(t *testing.T) {
 	setup()
 	defer cleanup()
@@ -80,6 +116,52 @@ func TestDeleteGenerator(t *testing.T) {
 	}
 }
 
+func TestRenameGenerator(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "PUT"
+
+	mux.HandleFunc("/generators/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if !reflect.DeepEqual(body, map[string]string{"name": "users"}) {
+			t.Errorf("Unexpected request body %v", body)
+		}
+		fmt.Fprint(w, `{"id": 123}`)
+	})
+
+	if err := client.RenameGenerator(123, "users"); err != nil {
+		t.Errorf("Got error: %v", err.Error())
+	}
+}
+
+func TestUpdateGeneratorDescription(t *testing.T) {
+	setup()
+	defer cleanup()
+
+	const reqMethod = "PUT"
+
+	mux.HandleFunc("/generators/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != reqMethod {
+			t.Errorf("Request method = %v, want %v", r.Method, reqMethod)
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["description"] != "Test users" {
+			t.Errorf("Unexpected request body %v", body)
+		}
+		fmt.Fprint(w, `{"id": 123}`)
+	})
+
+	if err := client.UpdateGeneratorDescription(123, "Test users"); err != nil {
+		t.Errorf("Got error: %v", err.Error())
+	}
+}
+
 func TestCreateTabularVar(t *testing.T) {
 	setup()
 	defer cleanup()
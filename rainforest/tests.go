@@ -333,6 +333,64 @@ func findEmbeddedFiles(s string) []embeddedFile {
 	return uploadables
 }
 
+// HasRemoteFiles returns true if test has embedded files referencing files already uploaded to
+// Rainforest, in the format {{ file.screenshot(FILE_ID, SIG) }} or {{ file.download(FILE_KEY, SIG, name) }}.
+func (t *RFTest) HasRemoteFiles() bool {
+	for _, step := range t.Steps {
+		s, ok := step.(RFTestStep)
+		if ok && (len(findRemoteFiles(s.Action)) > 0 || len(findRemoteFiles(s.Response)) > 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteFile contains the information of a step variable referencing a file
+// that has been uploaded to Rainforest
+type remoteFile struct {
+	// text is the entire step variable text. eg: "{{ file.screenshot(1234, AbCdEf) }}"
+	text string
+	// the step variable used. Either "screenshot" or "download"
+	stepVar string
+	// id is the file ID for screenshots and the file key for downloads
+	id string
+	// sig is the (shortened) file signature
+	sig string
+	// name is the file name, only present for downloads
+	name string
+}
+
+// findRemoteFiles looks through a string and parses out step variables referencing
+// uploaded files
+func findRemoteFiles(s string) []remoteFile {
+	reg := regexp.MustCompile(uploadableRegex)
+	matches := reg.FindAllStringSubmatch(s, -1)
+
+	remoteFiles := []remoteFile{}
+
+	for _, match := range matches {
+		parameters := strings.Split(match[2], ",")
+		if len(parameters) < 2 {
+			continue
+		}
+
+		remote := remoteFile{
+			text:    match[0],
+			stepVar: match[1],
+			id:      strings.TrimSpace(parameters[0]),
+			sig:     strings.TrimSpace(parameters[1]),
+		}
+		if len(parameters) > 2 {
+			remote.name = strings.TrimSpace(strings.Join(parameters[2:], ","))
+		}
+
+		remoteFiles = append(remoteFiles, remote)
+	}
+
+	return remoteFiles
+}
+
 // RFEmbeddedTest contains an embedded test details
 type RFEmbeddedTest struct {
 	RFMLID   string
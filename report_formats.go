@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// reportAPI is part of the API connected to run reports
+type reportAPI interface {
+	resourceAPI
+	CheckRunStatus(int) (*rainforest.RunStatus, error)
+	GetRunTests(int) ([]rainforest.RunTest, error)
+}
+
+// runReport is the run and test result data the local report formats are rendered from
+type runReport struct {
+	Run   *rainforest.RunStatus
+	Tests []rainforest.RunTest
+}
+
+// reportRenderer renders a run report in one format
+type reportRenderer func(io.Writer, *runReport) error
+
+// reportRenderers are the report formats rendered by the CLI. JUnit reports are rendered by
+// the API instead.
+var reportRenderers = map[string]reportRenderer{
+	"html":     renderHTMLReport,
+	"markdown": renderMarkdownReport,
+	"tap":      renderTAPReport,
+	"ctrf":     renderCTRFReport,
+}
+
+// writeReport writes the report of a run in the given --format, JUnit by default. The
+// local formats are written to --output or to STDOUT.
+func writeReport(c cliContext, api reportAPI) error {
+	format := strings.ToLower(c.String("format"))
+	if format == "" || format == "junit" {
+		return writeJunit(c, api, 0)
+	}
+
+	render, ok := reportRenderers[format]
+	if !ok {
+		return cli.NewExitError(fmt.Sprintf("Invalid report format %q. Valid formats are junit, html, markdown, tap and ctrf.", format), 1)
+	}
+
+	runIDArg := c.Args().Get(0)
+	if runIDArg == "" {
+		return cli.NewExitError("No run ID argument found.", 1)
+	}
+	runID, err := strconv.Atoi(runIDArg)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	run, err := api.CheckRunStatus(runID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	tests, err := api.GetRunTests(runID)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	report := &runReport{Run: run, Tests: tests}
+
+	var out io.Writer = os.Stdout
+	if output := c.String("output"); output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err = render(out, report); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// runTestStatus returns passed, failed, no_result or pending for a test of the run
+func runTestStatus(test rainforest.RunTest) string {
+	switch test.Result {
+	case "passed", "failed", "no_result":
+		return test.Result
+	default:
+		return "pending"
+	}
+}
+
+// runTestDuration approximates the time a test of the run took from when it was created and
+// last updated. It's zero for tests which aren't done.
+func runTestDuration(test rainforest.RunTest) time.Duration {
+	if runTestStatus(test) == "pending" || test.CreatedAt.IsZero() || test.UpdatedAt.Before(test.CreatedAt) {
+		return 0
+	}
+	return test.UpdatedAt.Sub(test.CreatedAt)
+}
+
+// counts returns the number of tests of the run by status
+func (r *runReport) counts() map[string]int {
+	counts := make(map[string]int)
+	for _, test := range r.Tests {
+		counts[runTestStatus(test)]++
+	}
+	return counts
+}
+
+// title is the title of the report
+func (r *runReport) title() string {
+	if r.Run.Description != "" {
+		return fmt.Sprintf("Run %v: %v", r.Run.ID, r.Run.Description)
+	}
+	return fmt.Sprintf("Run %v", r.Run.ID)
+}
+
+// result is the result of the run, or its state if it has no result yet
+func (r *runReport) result() string {
+	if r.Run.Result != "" {
+		return r.Run.Result
+	}
+	return r.Run.State
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"status":   runTestStatus,
+	"duration": runTestDuration,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d1d5da; padding: 6px 12px; text-align: left; }
+.passed { color: #22863a; }
+.failed { color: #cb2431; }
+.no_result, .pending { color: #6a737d; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Result: <strong class="{{.Result}}">{{.Result}}</strong>
+{{- range $status, $count := .Counts}} &middot; {{$count}} {{$status}}{{end}}</p>
+{{- if .Run.FrontendURL}}
+<p><a href="{{.Run.FrontendURL}}">Detailed results</a></p>
+{{- end}}
+<table>
+<thead><tr><th>Test ID</th><th>Test</th><th>Result</th><th>Duration</th></tr></thead>
+<tbody>
+{{- range .Tests}}
+<tr><td>{{.ID}}</td><td>{{.Title}}</td><td class="{{status .}}">{{status .}}</td><td>{{duration .}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// renderHTMLReport renders the report as a self-contained HTML page
+func renderHTMLReport(w io.Writer, r *runReport) error {
+	return htmlReportTemplate.Execute(w, map[string]interface{}{
+		"Title":  r.title(),
+		"Result": r.result(),
+		"Counts": r.counts(),
+		"Run":    r.Run,
+		"Tests":  r.Tests,
+	})
+}
+
+// renderMarkdownReport renders the report as Markdown, e.g. for pull request comments or
+// GitHub job summaries
+func renderMarkdownReport(w io.Writer, r *runReport) error {
+	counts := r.counts()
+	fmt.Fprintf(w, "## %v\n\n", markdownEscape(r.title()))
+	fmt.Fprintf(w, "**Result:** %v · %v passed · %v failed · %v no result", r.result(),
+		counts["passed"], counts["failed"], counts["no_result"])
+	if counts["pending"] > 0 {
+		fmt.Fprintf(w, " · %v pending", counts["pending"])
+	}
+	fmt.Fprintln(w)
+	if r.Run.FrontendURL != "" {
+		fmt.Fprintf(w, "\n[Detailed results](%v)\n", r.Run.FrontendURL)
+	}
+
+	fmt.Fprintln(w, "\n| Test ID | Test | Result | Duration |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, test := range r.Tests {
+		_, err := fmt.Fprintf(w, "| %v | %v | %v | %v |\n", test.ID, markdownEscape(test.Title),
+			runTestStatus(test), runTestDuration(test))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownEscape escapes the characters which would break a Markdown table or heading
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(s)
+}
+
+// renderTAPReport renders the report in the Test Anything Protocol, version 13
+func renderTAPReport(w io.Writer, r *runReport) error {
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%v\n", len(r.Tests))
+	fmt.Fprintf(w, "# %v: %v\n", r.title(), r.result())
+	for i, test := range r.Tests {
+		title := strings.NewReplacer("#", `\#`, "\n", " ").Replace(test.Title)
+		var line string
+		switch runTestStatus(test) {
+		case "passed":
+			line = fmt.Sprintf("ok %v - %v", i+1, title)
+		case "failed":
+			line = fmt.Sprintf("not ok %v - %v", i+1, title)
+		case "no_result":
+			line = fmt.Sprintf("ok %v - %v # SKIP no result", i+1, title)
+		default:
+			line = fmt.Sprintf("not ok %v - %v # TODO not finished", i+1, title)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ctrfReport is a Common Test Report Format (CTRF) JSON report
+type ctrfReport struct {
+	ReportFormat string      `json:"reportFormat"`
+	SpecVersion  string      `json:"specVersion"`
+	Results      ctrfResults `json:"results"`
+}
+
+type ctrfResults struct {
+	Tool    ctrfTool               `json:"tool"`
+	Summary ctrfSummary            `json:"summary"`
+	Tests   []ctrfTest             `json:"tests"`
+	Extra   map[string]interface{} `json:"extra,omitempty"`
+}
+
+type ctrfTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type ctrfSummary struct {
+	Tests   int   `json:"tests"`
+	Passed  int   `json:"passed"`
+	Failed  int   `json:"failed"`
+	Pending int   `json:"pending"`
+	Skipped int   `json:"skipped"`
+	Other   int   `json:"other"`
+	Start   int64 `json:"start"`
+	Stop    int64 `json:"stop"`
+}
+
+type ctrfTest struct {
+	Name     string                 `json:"name"`
+	Status   string                 `json:"status"`
+	Duration int64                  `json:"duration"`
+	Start    int64                  `json:"start,omitempty"`
+	Stop     int64                  `json:"stop,omitempty"`
+	Extra    map[string]interface{} `json:"extra,omitempty"`
+}
+
+// ctrfStatuses maps the statuses of the tests to CTRF statuses
+var ctrfStatuses = map[string]string{
+	"passed":    "passed",
+	"failed":    "failed",
+	"no_result": "other",
+	"pending":   "pending",
+}
+
+// renderCTRFReport renders the report as Common Test Report Format JSON
+func renderCTRFReport(w io.Writer, r *runReport) error {
+	report := ctrfReport{
+		ReportFormat: "CTRF",
+		SpecVersion:  "0.0.0",
+		Results: ctrfResults{
+			Tool:  ctrfTool{Name: "rainforest", Version: version},
+			Tests: make([]ctrfTest, len(r.Tests)),
+			Extra: map[string]interface{}{"runId": r.Run.ID, "result": r.result()},
+		},
+	}
+	if r.Run.FrontendURL != "" {
+		report.Results.Extra["url"] = r.Run.FrontendURL
+	}
+
+	summary := &report.Results.Summary
+	summary.Tests = len(r.Tests)
+	if !r.Run.CreatedAt.IsZero() {
+		summary.Start = r.Run.CreatedAt.UnixMilli()
+	}
+	if !r.Run.UpdatedAt.IsZero() {
+		summary.Stop = r.Run.UpdatedAt.UnixMilli()
+	}
+
+	for i, test := range r.Tests {
+		status := ctrfStatuses[runTestStatus(test)]
+		switch status {
+		case "passed":
+			summary.Passed++
+		case "failed":
+			summary.Failed++
+		case "pending":
+			summary.Pending++
+		default:
+			summary.Other++
+		}
+
+		ctrf := ctrfTest{
+			Name:     test.Title,
+			Status:   status,
+			Duration: runTestDuration(test).Milliseconds(),
+			Extra:    map[string]interface{}{"id": test.ID},
+		}
+		if !test.CreatedAt.IsZero() {
+			ctrf.Start = test.CreatedAt.UnixMilli()
+		}
+		if !test.UpdatedAt.IsZero() {
+			ctrf.Stop = test.UpdatedAt.UnixMilli()
+		}
+		report.Results.Tests[i] = ctrf
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
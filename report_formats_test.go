@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeReportAPI struct {
+	testResourceAPI
+	run   rainforest.RunStatus
+	tests []rainforest.RunTest
+}
+
+func (api fakeReportAPI) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
+	return &api.run, nil
+}
+
+func (api fakeReportAPI) GetRunTests(runID int) ([]rainforest.RunTest, error) {
+	return api.tests, nil
+}
+
+func newFakeReportAPI() fakeReportAPI {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	return fakeReportAPI{
+		run: rainforest.RunStatus{
+			ID:          123,
+			State:       "complete",
+			Result:      "failed",
+			Description: "Nightly",
+			FrontendURL: "https://app.rainforestqa.com/runs/123",
+			CreatedAt:   start,
+			UpdatedAt:   start.Add(10 * time.Minute),
+		},
+		tests: []rainforest.RunTest{
+			{ID: 1, Title: "Login | SSO", Result: "passed", CreatedAt: start, UpdatedAt: start.Add(90 * time.Second)},
+			{ID: 2, Title: "<Checkout>", Result: "failed", CreatedAt: start, UpdatedAt: start.Add(2 * time.Minute)},
+			{ID: 3, Title: "Logout", Result: "no_result"},
+			{ID: 4, Title: "Search", State: "in_progress"},
+		},
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "report")
+	api := newFakeReportAPI()
+
+	testCases := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "html",
+			want: []string{"<title>Run 123: Nightly</title>", `<td class="failed">failed</td>`,
+				"&lt;Checkout&gt;", `<a href="https://app.rainforestqa.com/runs/123">`, "<td>1m30s</td>"},
+		},
+		{
+			format: "markdown",
+			want: []string{"## Run 123: Nightly", "**Result:** failed · 1 passed · 1 failed · 1 no result · 1 pending",
+				`| 1 | Login \| SSO | passed | 1m30s |`, "[Detailed results](https://app.rainforestqa.com/runs/123)"},
+		},
+		{
+			format: "tap",
+			want: []string{"TAP version 13\n1..4\n", "ok 1 - Login | SSO\n", "not ok 2 - <Checkout>\n",
+				"ok 3 - Logout # SKIP no result\n", "not ok 4 - Search # TODO not finished\n"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		c := newFakeContext(map[string]interface{}{"format": testCase.format, "output": output}, cli.Args{"123"})
+		if err := writeReport(c, api); err != nil {
+			t.Fatalf("writeReport with format %v returned %v", testCase.format, err)
+		}
+		report, _ := os.ReadFile(output)
+		for _, want := range testCase.want {
+			if !strings.Contains(string(report), want) {
+				t.Errorf("Expected the %v report to contain %q, got:\n%s", testCase.format, want, report)
+			}
+		}
+	}
+
+	// JUnit is still the default format
+	junitFile := filepath.Join(t.TempDir(), "junit.xml")
+	api.Junit = "<testsuites/>"
+	c := newFakeContext(map[string]interface{}{"junit-file": junitFile}, cli.Args{"123"})
+	if err := writeReport(c, api); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := os.ReadFile(junitFile); string(report) != api.Junit {
+		t.Errorf("Expected the JUnit report to be written, got %q", report)
+	}
+
+	c = newFakeContext(map[string]interface{}{"format": "pdf"}, cli.Args{"123"})
+	if err := writeReport(c, api); err == nil || !strings.Contains(err.Error(), "Invalid report format") {
+		t.Errorf("Expected an invalid format error, got %v", err)
+	}
+}
+
+func TestRenderCTRFReport(t *testing.T) {
+	api := newFakeReportAPI()
+	var out bytes.Buffer
+	if err := renderCTRFReport(&out, &runReport{Run: &api.run, Tests: api.tests}); err != nil {
+		t.Fatal(err)
+	}
+
+	var report ctrfReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid CTRF report: %v\n%s", err, out.String())
+	}
+	if report.ReportFormat != "CTRF" || report.Results.Tool.Name != "rainforest" {
+		t.Errorf("Unexpected CTRF report:\n%s", out.String())
+	}
+
+	want := ctrfSummary{Tests: 4, Passed: 1, Failed: 1, Pending: 1, Other: 1,
+		Start: api.run.CreatedAt.UnixMilli(), Stop: api.run.UpdatedAt.UnixMilli()}
+	if report.Results.Summary != want {
+		t.Errorf("CTRF summary = %+v, want %+v", report.Results.Summary, want)
+	}
+	if test := report.Results.Tests[1]; test.Name != "<Checkout>" || test.Status != "failed" || test.Duration != 120000 {
+		t.Errorf("Unexpected CTRF test %+v", test)
+	}
+}
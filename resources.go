@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/olekukonko/tablewriter"
@@ -34,7 +36,13 @@ type resourceAPI interface {
 	GetEnvironments() ([]rainforest.Environment, error)
 	GetFeatures() ([]rainforest.Feature, error)
 	GetRunGroups() ([]rainforest.RunGroup, error)
-	GetRunJunit(int) (*string, error)
+	DownloadRunJunit(int, io.Writer) error
+}
+
+// runJunitAPI is part of the API connected to the JUnit reports of runs
+type runJunitAPI interface {
+	resourceAPI
+	CheckRunStatus(int) (*rainforest.RunStatus, error)
 }
 
 // printFolders fetches and prints out the available folders from the API
@@ -159,7 +167,7 @@ func augmentJunitFileName(junitFile string, rerunAttempt uint) string {
 }
 
 // write writeJunit fetches and writes a junit.xml file
-func writeJunit(c cliContext, api resourceAPI, runID int) error {
+func writeJunit(c cliContext, api runJunitAPI, runID int) error {
 	var err error
 
 	if runID > 0 {
@@ -183,19 +191,71 @@ func writeJunit(c cliContext, api resourceAPI, runID int) error {
 		junitFile = augmentJunitFileName(junitFile, rerunAttempt)
 	}
 
-	xml, err := api.GetRunJunit(runID)
+	status, err := api.CheckRunStatus(runID)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
 
-	file, err := os.Create(junitFile)
-	defer file.Close()
-
+	err = writeRunJunit(api, runID, status, junitFile)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
-	} else {
-		file.WriteString(*xml)
 	}
 
 	return nil
 }
+
+// writeRunJunit streams the JUnit report of the run to a temporary file next to junitFile,
+// which replaces junitFile once the report is validated against the status of the run, see
+// validateJunit.
+func writeRunJunit(api resourceAPI, runID int, status *rainforest.RunStatus, junitFile string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(junitFile), filepath.Base(junitFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Nothing is left behind if the report isn't written
+	defer os.Remove(tmp.Name())
+
+	err = api.DownloadRunJunit(runID, tmp)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		if err = validateJunit(tmp, status); err != nil {
+			err = fmt.Errorf("Invalid JUnit report for run %v: %v", runID, err)
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), junitFile)
+}
+
+// writeFileAtomic writes the data to a temporary file which then replaces the named file, so
+// the file is never left partially written
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/rainforestapp/rainforest-cli/rainforest"
@@ -41,6 +44,7 @@ type testResourceAPI struct {
 	Features     []rainforest.Feature
 	RunGroups    []rainforest.RunGroup
 	Junit        string
+	RunStatus    rainforest.RunStatus
 }
 
 func (api testResourceAPI) GetFolders() ([]rainforest.Folder, error) {
@@ -67,8 +71,13 @@ func (api testResourceAPI) GetRunGroups() ([]rainforest.RunGroup, error) {
 	return api.RunGroups, nil
 }
 
-func (api testResourceAPI) GetRunJunit(run_id int) (*string, error) {
-	return &api.Junit, nil
+func (api testResourceAPI) DownloadRunJunit(run_id int, w io.Writer) error {
+	_, err := io.WriteString(w, api.Junit)
+	return err
+}
+
+func (api testResourceAPI) CheckRunStatus(run_id int) (*rainforest.RunStatus, error) {
+	return &api.RunStatus, nil
 }
 
 func TestPrintFolders(t *testing.T) {
@@ -196,7 +205,7 @@ func TestPrintRunGroups(t *testing.T) {
 func TestWriteJunit(t *testing.T) {
 	fakeContext := newFakeContext(map[string]interface{}{"junit-file": "junit.xml"}, cli.Args{"1"})
 	testAPI := testResourceAPI{
-		Junit: "<xml>hai</xml>",
+		Junit: `<testsuite name="Run 1" tests="1"><testcase name="hai"/></testsuite>`,
 	}
 	err := writeJunit(fakeContext, testAPI, 0)
 
@@ -245,6 +254,34 @@ func TestWriteJunit(t *testing.T) {
 	if !reflect.DeepEqual(expected, err.Error()) {
 		t.Errorf("writeJunit should have errored: expected '%v', got '%v'", expected, err.Error())
 	}
+
+	// errors without touching the junit file when the report is malformed or doesn't match the run
+	testAPI.RunStatus.StateDetails.IsFinalState = true
+	testAPI.RunStatus.CurrentProgress.Total = 2
+	testAPI.RunStatus.CurrentProgress.Passed = 1
+	for _, junit := range []string{"", "<xml>hai</xml>", `<testsuite name="Run 1"><testcase name="hai">`, testAPI.Junit} {
+		badAPI := testAPI
+		badAPI.Junit = junit
+		fakeContext = newFakeContext(map[string]interface{}{"junit-file": "junit.xml"}, cli.Args{"1"})
+		err = writeJunit(fakeContext, badAPI, 0)
+		if err == nil || !strings.Contains(err.Error(), "Invalid JUnit report for run 1") {
+			t.Errorf("writeJunit should have errored for %q, got %v", junit, err)
+		}
+		data, _ = os.ReadFile("junit.xml")
+		if !reflect.DeepEqual(testAPI.Junit, string(data)) {
+			t.Errorf("writeJunit overwrote the report with %q", data)
+		}
+	}
+	if tmpFiles, _ := filepath.Glob("junit.xml.*.tmp"); len(tmpFiles) > 0 {
+		t.Errorf("writeJunit left temporary files behind: %v", tmpFiles)
+	}
+
+	testAPI.Junit = `<testsuites><testsuite name="Run 1"><testcase name="hai"/><testcase name="bye"><failure/></testcase></testsuite></testsuites>`
+	fakeContext = newFakeContext(map[string]interface{}{"junit-file": "junit.xml"}, cli.Args{"1"})
+	if err = writeJunit(fakeContext, testAPI, 0); err != nil {
+		t.Errorf("writeJunit returned %+v", err)
+	}
+	os.Remove("junit.xml")
 }
 
 func TestAugmentJunitFileName(t *testing.T) {
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// runStatusAPI is part of the API used to check the status of a run
+type runStatusAPI interface {
+	CheckRunStatus(int) (*rainforest.RunStatus, error)
+}
+
+// runCancelAPI is part of the API used to cancel a run
+type runCancelAPI interface {
+	resourceAPI
+	CancelRun(int) error
+}
+
+// runInterruptAPI is part of the API used when a run times out or the CLI is interrupted while
+// monitoring it
+type runInterruptAPI interface {
+	runCancelAPI
+	temporaryEnvironmentAPI
+}
+
+// runMonitorAPI is part of the API used to wait for a run and rerun its failed tests
+type runMonitorAPI interface {
+	runInterruptAPI
+	runStatusAPI
+	CreateRun(rainforest.RunParams) (*rainforest.RunStatus, error)
+}
+
+// runAttempt is the run being monitored, or one of its reruns
+type runAttempt struct {
+	runID int
+	// attempt is 0 for the run and n for its nth rerun
+	attempt uint
+	// temporaryEnvironmentID is the temporary environment created for the run, if any
+	temporaryEnvironmentID int
+}
+
+// junitFile returns the name of the JUnit report of the attempt, or "" without junit-file
+func (a runAttempt) junitFile(c cliContext) string {
+	junitFile := c.String("junit-file")
+	if junitFile == "" {
+		return ""
+	}
+	return augmentJunitFileName(junitFile, a.attempt)
+}
+
+// monitorOptions are the options for monitoring a run
+type monitorOptions struct {
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	timeout         time.Duration
+}
+
+// getMonitorOptions parses the poll-interval, max-poll-interval and timeout flags
+func getMonitorOptions(c cliContext) (monitorOptions, error) {
+	opts := monitorOptions{
+		pollInterval:    runStatusPollInterval,
+		maxPollInterval: runStatusMaxPollInterval,
+	}
+
+	for _, flag := range []struct {
+		name string
+		dest *time.Duration
+	}{
+		{"poll-interval", &opts.pollInterval},
+		{"max-poll-interval", &opts.maxPollInterval},
+		{"timeout", &opts.timeout},
+	} {
+		s := c.String(flag.name)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return monitorOptions{}, fmt.Errorf("Invalid %v %q, use a duration such as 30s or 2h", flag.name, s)
+		}
+		*flag.dest = d
+	}
+
+	if opts.maxPollInterval < opts.pollInterval {
+		opts.maxPollInterval = opts.pollInterval
+	}
+	return opts, nil
+}
+
+// runStatusPoller decides how long to wait between run status checks. The interval grows
+// while the run doesn't progress, up to the max interval, and is reset once it progresses.
+type runStatusPoller struct {
+	interval     time.Duration
+	minInterval  time.Duration
+	maxInterval  time.Duration
+	lastState    string
+	lastComplete int
+}
+
+func newRunStatusPoller(opts monitorOptions) *runStatusPoller {
+	return &runStatusPoller{
+		interval:     opts.pollInterval,
+		minInterval:  opts.pollInterval,
+		maxInterval:  opts.maxPollInterval,
+		lastComplete: -1,
+	}
+}
+
+// next returns how long to wait before checking the status again, given the last status.
+// status is nil if it couldn't be fetched.
+func (p *runStatusPoller) next(status *rainforest.RunStatus) time.Duration {
+	if status != nil && (status.State != p.lastState || status.CurrentProgress.Complete != p.lastComplete) {
+		p.lastState = status.State
+		p.lastComplete = status.CurrentProgress.Complete
+		p.interval = p.minInterval
+		return p.interval
+	}
+
+	p.interval = p.interval * 3 / 2
+	if p.interval > p.maxInterval {
+		p.interval = p.maxInterval
+	}
+	return p.interval
+}
+
+// timeOutRun writes the partial results of a run which isn't done before the timeout and,
+// with cancel-on-timeout, cancels it. The temporary environment is only deleted once the run
+// is cancelled, as a run still in progress uses it.
+func timeOutRun(c cliContext, client runInterruptAPI, a runAttempt, timeout time.Duration) error {
+	runID := a.runID
+	log.Printf("Run %v isn't done after %v", runID, timeout)
+	writePartialJunit(c, client, a)
+
+	cancelled := false
+	if c.Bool("cancel-on-timeout") {
+		if err := client.CancelRun(runID); err != nil {
+			log.Printf("Unable to cancel run %v: %v", runID, err)
+		} else {
+			log.Printf("Cancelled run %v", runID)
+			cancelled = true
+		}
+	}
+
+	if cancelled {
+		deleteTemporaryEnvironment(c, client, a.temporaryEnvironmentID)
+	} else if a.temporaryEnvironmentID != 0 {
+		log.Printf("Temporary environment %v is kept as the run may still be in progress", a.temporaryEnvironmentID)
+	}
+
+	return cli.NewExitError(fmt.Sprintf("Timed out waiting for run %v", runID), exitCodeTimeout)
+}
+
+// handleRunInterrupts calls interruptRun and exits when the CLI gets SIGINT or SIGTERM while
+// monitoring the run. The returned function stops handling the signals.
+func handleRunInterrupts(c cliContext, client runInterruptAPI, a runAttempt) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			// A second signal kills the CLI without waiting for the cleanup
+			signal.Stop(signals)
+			os.Exit(interruptRun(c, client, a, sig))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// interruptRun writes the partial results of the run and cancels it with
+// cancel-on-interrupt. The temporary environment is only deleted once the run is cancelled,
+// as a run still in progress uses it. It returns the exit code for the signal.
+func interruptRun(c cliContext, client runInterruptAPI, a runAttempt, sig os.Signal) int {
+	runID := a.runID
+	log.Printf("Received %v while waiting for run %v", sig, runID)
+	writePartialJunit(c, client, a)
+
+	cancelled := false
+	if c.Bool("cancel-on-interrupt") {
+		if err := client.CancelRun(runID); err != nil {
+			log.Printf("Unable to cancel run %v: %v", runID, err)
+		} else {
+			log.Printf("Cancelled run %v", runID)
+			cancelled = true
+		}
+	} else {
+		log.Printf("Run %v is still in progress, use --cancel-on-interrupt to cancel it", runID)
+	}
+
+	if cancelled {
+		deleteTemporaryEnvironment(c, client, a.temporaryEnvironmentID)
+	} else if a.temporaryEnvironmentID != 0 {
+		log.Printf("Temporary environment %v is kept as the run may still be in progress", a.temporaryEnvironmentID)
+	}
+
+	// The conventional exit code for a process terminated by a signal is 128 + the signal
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 128 + int(syscall.SIGINT)
+}
+
+// writePartialJunit writes the results of a run which isn't done to the junit-file, if any
+func writePartialJunit(c cliContext, client resourceAPI, a runAttempt) {
+	junitFile := a.junitFile(c)
+	if junitFile == "" {
+		return
+	}
+	if err := writeRunJunit(client, a.runID, nil, junitFile); err != nil {
+		log.Printf("Unable to write the partial results of run %v: %v", a.runID, err)
+	}
+}
+
+// printRerunSummary prints the outcome of the run and each of its reruns
+func printRerunSummary(attempts []runAttempt, statuses []*rainforest.RunStatus) {
+	rows := make([][]string, len(attempts))
+	for i, a := range attempts {
+		status := statuses[i]
+		rows[i] = []string{
+			strconv.Itoa(int(a.attempt)),
+			strconv.Itoa(a.runID),
+			status.Result,
+			strconv.Itoa(status.CurrentProgress.Passed),
+			strconv.Itoa(status.CurrentProgress.Failed),
+			strconv.Itoa(status.CurrentProgress.NoResult),
+		}
+	}
+	printResourceTable([]string{"Attempt", "Run ID", "Result", "Passed", "Failed", "No Result"}, rows)
+}
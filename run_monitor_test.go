@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeRunCancelAPI struct {
+	testResourceAPI
+	cancelled           []int
+	deletedEnvironments []int
+	cancelErr           error
+}
+
+func (f *fakeRunCancelAPI) CancelRun(runID int) error {
+	if f.cancelErr != nil {
+		return f.cancelErr
+	}
+	f.cancelled = append(f.cancelled, runID)
+	return nil
+}
+
+func (f *fakeRunCancelAPI) DeleteEnvironment(envID int) error {
+	f.deletedEnvironments = append(f.deletedEnvironments, envID)
+	return nil
+}
+
+func TestGetMonitorOptions(t *testing.T) {
+	opts, err := getMonitorOptions(newFakeContext(map[string]interface{}{}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.pollInterval != runStatusPollInterval || opts.maxPollInterval != runStatusMaxPollInterval || opts.timeout != 0 {
+		t.Errorf("Unexpected default options: %+v", opts)
+	}
+
+	opts, err = getMonitorOptions(newFakeContext(map[string]interface{}{
+		"poll-interval":     "1m",
+		"max-poll-interval": "10s",
+		"timeout":           "2h",
+	}, cli.Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := monitorOptions{pollInterval: time.Minute, maxPollInterval: time.Minute, timeout: 2 * time.Hour}
+	if opts != want {
+		t.Errorf("Unexpected options. Want %+v, got %+v", want, opts)
+	}
+
+	for _, timeout := range []string{"2", "-1h"} {
+		_, err = getMonitorOptions(newFakeContext(map[string]interface{}{"timeout": timeout}, cli.Args{}))
+		if err == nil {
+			t.Errorf("Expected an error for timeout %q", timeout)
+		}
+	}
+}
+
+func TestRunStatusPoller(t *testing.T) {
+	p := newRunStatusPoller(monitorOptions{pollInterval: 10 * time.Second, maxPollInterval: 30 * time.Second})
+	status := &rainforest.RunStatus{State: "in_progress"}
+	status.CurrentProgress.Complete = 1
+
+	steps := []struct {
+		status *rainforest.RunStatus
+		want   time.Duration
+	}{
+		{status, 10 * time.Second},
+		{status, 15 * time.Second},
+		{nil, 22500 * time.Millisecond},
+		{status, 30 * time.Second},
+		{status, 30 * time.Second},
+		{&rainforest.RunStatus{State: "in_progress"}, 10 * time.Second},
+	}
+	for i, step := range steps {
+		if got := p.next(step.status); got != step.want {
+			t.Errorf("Step %v: got interval %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestTimeOutRun(t *testing.T) {
+	junitFile := filepath.Join(t.TempDir(), "junit.xml")
+	api := &fakeRunCancelAPI{testResourceAPI: testResourceAPI{Junit: "<testsuite/>"}}
+	c := newFakeContext(map[string]interface{}{
+		"junit-file":        junitFile,
+		"cancel-on-timeout": true,
+	}, cli.Args{})
+
+	err := timeOutRun(c, api, runAttempt{runID: 123}, time.Hour)
+	exitErr, ok := err.(*cli.ExitError)
+	if !ok || exitErr.ExitCode() != exitCodeTimeout {
+		t.Errorf("Expected exit code %v, got %v", exitCodeTimeout, err)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != 123 {
+		t.Errorf("Expected run 123 to be cancelled, got %v", api.cancelled)
+	}
+	if junit, err := os.ReadFile(junitFile); err != nil || string(junit) != "<testsuite/>" {
+		t.Errorf("Expected the partial results to be written, got %q (%v)", junit, err)
+	}
+
+	a := runAttempt{runID: 123, temporaryEnvironmentID: 45}
+	api = &fakeRunCancelAPI{}
+	timeOutRun(c, api, a, time.Hour)
+	if !reflect.DeepEqual(api.deletedEnvironments, []int{45}) {
+		t.Errorf("Expected environment 45 to be deleted, got %v", api.deletedEnvironments)
+	}
+
+	api = &fakeRunCancelAPI{}
+	timeOutRun(newFakeContext(map[string]interface{}{}, cli.Args{}), api, a, time.Hour)
+	if len(api.cancelled) != 0 || len(api.deletedEnvironments) != 0 {
+		t.Errorf("Expected nothing to be cancelled or deleted, got %v and %v", api.cancelled, api.deletedEnvironments)
+	}
+
+	// The temporary environment is kept while the run may still be in progress
+	api = &fakeRunCancelAPI{cancelErr: errors.New("cancel failed")}
+	timeOutRun(newFakeContext(map[string]interface{}{"cancel-on-timeout": true}, cli.Args{}), api, a, time.Hour)
+	if len(api.deletedEnvironments) != 0 {
+		t.Errorf("Expected the environment to be kept when the run wasn't cancelled, got %v", api.deletedEnvironments)
+	}
+}
+
+func TestInterruptRun(t *testing.T) {
+	junitFile := filepath.Join(t.TempDir(), "junit.xml")
+	api := &fakeRunCancelAPI{testResourceAPI: testResourceAPI{Junit: "<testsuite/>"}}
+	c := newFakeContext(map[string]interface{}{
+		"junit-file":          junitFile,
+		"cancel-on-interrupt": true,
+	}, cli.Args{})
+
+	a := runAttempt{runID: 123, attempt: 1, temporaryEnvironmentID: 45}
+	if code := interruptRun(c, api, a, syscall.SIGTERM); code != 143 {
+		t.Errorf("Expected exit code 143, got %v", code)
+	}
+	if !reflect.DeepEqual(api.cancelled, []int{123}) {
+		t.Errorf("Expected run 123 to be cancelled, got %v", api.cancelled)
+	}
+	if !reflect.DeepEqual(api.deletedEnvironments, []int{45}) {
+		t.Errorf("Expected environment 45 to be deleted, got %v", api.deletedEnvironments)
+	}
+	if _, err := os.Stat(junitFile + ".1"); err != nil {
+		t.Errorf("Expected the partial results of the rerun to be written: %v", err)
+	}
+
+	// The temporary environment is kept while the run may still be in progress
+	api = &fakeRunCancelAPI{}
+	a = runAttempt{runID: 123, temporaryEnvironmentID: 45}
+	if code := interruptRun(newFakeContext(map[string]interface{}{}, cli.Args{}), api, a, os.Interrupt); code != 130 {
+		t.Errorf("Expected exit code 130, got %v", code)
+	}
+	if len(api.cancelled) != 0 || len(api.deletedEnvironments) != 0 {
+		t.Errorf("Expected nothing to be cancelled or deleted, got %v and %v", api.cancelled, api.deletedEnvironments)
+	}
+
+	api = &fakeRunCancelAPI{cancelErr: errors.New("cancel failed")}
+	c = newFakeContext(map[string]interface{}{"cancel-on-interrupt": true}, cli.Args{})
+	interruptRun(c, api, a, os.Interrupt)
+	if len(api.deletedEnvironments) != 0 {
+		t.Errorf("Expected the environment to be kept when the run wasn't cancelled, got %v", api.deletedEnvironments)
+	}
+}
+
+type fakeRunMonitorAPI struct {
+	fakeRunCancelAPI
+	statuses   map[int]rainforest.RunStatus
+	junit      map[int]string
+	junitErr   error
+	nextRunID  int
+	runParams  []rainforest.RunParams
+	checkedIDs []int
+}
+
+func (f *fakeRunMonitorAPI) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
+	f.checkedIDs = append(f.checkedIDs, runID)
+	status := f.statuses[runID]
+	return &status, nil
+}
+
+func (f *fakeRunMonitorAPI) CreateRun(params rainforest.RunParams) (*rainforest.RunStatus, error) {
+	f.runParams = append(f.runParams, params)
+	f.nextRunID++
+	return &rainforest.RunStatus{ID: f.nextRunID}, nil
+}
+
+func (f *fakeRunMonitorAPI) DownloadRunJunit(runID int, w io.Writer) error {
+	if f.junitErr != nil {
+		return f.junitErr
+	}
+	_, err := io.WriteString(w, f.junit[runID])
+	return err
+}
+
+func newFinishedRunStatus(runID int, state, result string) rainforest.RunStatus {
+	status := rainforest.RunStatus{ID: runID, State: state, Result: result}
+	status.StateDetails.IsFinalState = true
+	return status
+}
+
+func TestMonitorRun_Reruns(t *testing.T) {
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	newAPI := func() *fakeRunMonitorAPI {
+		return &fakeRunMonitorAPI{
+			statuses: map[int]rainforest.RunStatus{
+				1: newFinishedRunStatus(1, "complete", "failed"),
+				2: newFinishedRunStatus(2, "complete", "failed"),
+				3: newFinishedRunStatus(3, "complete", "passed"),
+			},
+			junit: map[int]string{
+				1: `<testsuite name="Run 1"><testcase name="A"><failure message="oops"/></testcase><testcase name="B"/></testsuite>`,
+				2: `<testsuite name="Run 2"><testcase name="A"><failure message="oops"/></testcase></testsuite>`,
+				3: `<testsuite name="Run 3"><testcase name="A"/></testsuite>`,
+			},
+			nextRunID: 1,
+		}
+	}
+
+	dir := t.TempDir()
+	junitFile := filepath.Join(dir, "junit.xml")
+	runIDFile := filepath.Join(dir, "run_id")
+	api := newAPI()
+	c := newFakeContext(map[string]interface{}{
+		"max-reruns":  uint(2),
+		"junit-file":  junitFile,
+		"save-run-id": runIDFile,
+		"conflict":    "cancel",
+	}, cli.Args{})
+
+	if err := monitorRun(c, api, 1, 45); err != nil {
+		t.Fatalf("Expected the run to pass after reruns, got %v", err)
+	}
+	want := []rainforest.RunParams{{RunID: 1, Conflict: "cancel"}, {RunID: 2, Conflict: "cancel"}}
+	if !reflect.DeepEqual(api.runParams, want) {
+		t.Errorf("Unexpected reruns. Want %v, got %v", want, api.runParams)
+	}
+	if !reflect.DeepEqual(api.deletedEnvironments, []int{45}) {
+		t.Errorf("Expected the temporary environment to be deleted once, got %v", api.deletedEnvironments)
+	}
+	if runID, _ := os.ReadFile(runIDFile); string(runID) != "3\n" {
+		t.Errorf("Expected the ID of the last rerun to be saved, got %q", runID)
+	}
+	for _, name := range []string{junitFile + ".1", junitFile + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Expected the JUnit report %v to be written: %v", name, err)
+		}
+	}
+	merged, _ := os.ReadFile(junitFile)
+	report, err := parseJunit(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != "2" || suite.Failures != "0" || len(suite.TestCases) != 2 || suite.TestCases[0].Failure != nil {
+		t.Errorf("Unexpected merged JUnit report:\n%s", merged)
+	}
+	if !strings.Contains(tablesOut.(*bytes.Buffer).String(), "passed") {
+		t.Errorf("Expected a summary of the attempts, got:\n%v", tablesOut)
+	}
+
+	// The reruns can be merged into a single report with the failed attempts
+	junitFile = filepath.Join(dir, "merged.xml")
+	api = newAPI()
+	c = newFakeContext(map[string]interface{}{
+		"max-reruns":         uint(2),
+		"junit-file":         junitFile,
+		"junit-merge-reruns": true,
+	}, cli.Args{})
+	if err := monitorRun(c, api, 1, 0); err != nil {
+		t.Fatalf("Expected the run to pass after reruns, got %v", err)
+	}
+	if _, err := os.Stat(junitFile + ".1"); !os.IsNotExist(err) {
+		t.Errorf("Expected the JUnit reports of the reruns not to be written separately, got %v", err)
+	}
+	merged, _ = os.ReadFile(junitFile)
+	if report, err = parseJunit(merged); err != nil || report.Suites[0].Failures != "0" ||
+		len(report.Suites[0].TestCases[0].FlakyFailures) != 2 {
+		t.Errorf("Unexpected merged JUnit report:\n%s", merged)
+	}
+
+	// Without enough reruns the run fails with the outcome of the last rerun
+	api = newAPI()
+	c = newFakeContext(map[string]interface{}{"max-reruns": uint(1), "junit-file": junitFile}, cli.Args{})
+	err = monitorRun(c, api, 1, 0)
+	if exitErr, ok := err.(*cli.ExitError); !ok || exitErr.ExitCode() != exitCodeTestsFailed {
+		t.Errorf("Expected exit code %v, got %v", exitCodeTestsFailed, err)
+	}
+	merged, _ = os.ReadFile(junitFile)
+	if report, err = parseJunit(merged); err != nil || report.Suites[0].Failures != "1" {
+		t.Errorf("Unexpected merged JUnit report:\n%s", merged)
+	}
+
+	// A report which doesn't match the run fails the command instead of being dropped
+	for _, mergeReruns := range []bool{false, true} {
+		api = newAPI()
+		status := api.statuses[2]
+		status.CurrentProgress.Total = 2
+		api.statuses[2] = status
+		c = newFakeContext(map[string]interface{}{
+			"max-reruns":         uint(2),
+			"junit-file":         filepath.Join(dir, "mismatch.xml"),
+			"junit-merge-reruns": mergeReruns,
+		}, cli.Args{})
+		err = monitorRun(c, api, 1, 0)
+		if exitErr, ok := err.(*cli.ExitError); !ok || exitErr.ExitCode() != exitCodeValidationError ||
+			!strings.Contains(err.Error(), "Invalid JUnit report for run 2") {
+			t.Errorf("Expected exit code %v for a mismatching report, got %v", exitCodeValidationError, err)
+		}
+		if len(api.runParams) != 1 {
+			t.Errorf("Expected no more reruns after the mismatching report, got %v", api.runParams)
+		}
+	}
+
+	// A report which can't be downloaded is an API error
+	api = newAPI()
+	api.junitErr = &rainforest.APIError{StatusCode: 503}
+	c = newFakeContext(map[string]interface{}{"junit-file": filepath.Join(dir, "unavailable.xml")}, cli.Args{})
+	err = monitorRun(c, api, 1, 0)
+	if exitErr, ok := err.(*cli.ExitError); !ok || exitErr.ExitCode() != exitCodeAPIError {
+		t.Errorf("Expected exit code %v for a report which couldn't be downloaded, got %v", exitCodeAPIError, err)
+	}
+
+	// A cancelled run isn't rerun
+	api = newAPI()
+	api.statuses[1] = newFinishedRunStatus(1, "aborted", "failed")
+	c = newFakeContext(map[string]interface{}{"max-reruns": uint(2)}, cli.Args{})
+	err = monitorRun(c, api, 1, 0)
+	if exitErr, ok := err.(*cli.ExitError); !ok || exitErr.ExitCode() != exitCodeRunCancelled {
+		t.Errorf("Expected exit code %v, got %v", exitCodeRunCancelled, err)
+	}
+	if len(api.runParams) != 0 {
+		t.Errorf("Expected no reruns, got %v", api.runParams)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWebhookReceiver(t *testing.T) {
+	receiver, err := startRunWebhookReceiver("127.0.0.1:0", 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	webhookURL := "http://" + receiver.Addr().String()
+
+	post := func(body string) {
+		resp, err := http.Post(webhookURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected status code %v", resp.StatusCode)
+		}
+	}
+
+	post(`{"callback_type":"after_run","options":{"run_id":456}}`)
+	if receiver.wait(50 * time.Millisecond) {
+		t.Error("Expected the webhook of another run to be ignored")
+	}
+
+	post(`{"callback_type":"after_run","options":{"run_id":123}}`)
+	if !receiver.wait(time.Second) {
+		t.Error("Expected the webhook of the run to be received")
+	}
+
+	post(`not json`)
+	if !receiver.wait(time.Second) {
+		t.Error("Expected a webhook without a run ID to trigger a status check")
+	}
+
+	resp, err := http.Get(webhookURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code for GET: %v", resp.StatusCode)
+	}
+	if receiver.wait(50 * time.Millisecond) {
+		t.Error("Expected a GET request not to trigger a status check")
+	}
+}
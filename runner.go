@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
@@ -9,7 +10,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	gitTrigger "github.com/rainforestapp/rainforest-cli/gittrigger"
@@ -21,11 +21,20 @@ type runnerAPI interface {
 	CreateRun(params rainforest.RunParams) (*rainforest.RunStatus, error)
 	CreateTemporaryEnvironment(string, string, string) (*rainforest.Environment, error)
 	CheckRunStatus(int) (*rainforest.RunStatus, error)
+	temporaryEnvironmentAPI
 	rfAPI
 }
 
+// temporaryEnvironmentAPI is part of the API used to clean up temporary environments
+type temporaryEnvironmentAPI interface {
+	DeleteEnvironment(int) error
+}
+
 type runner struct {
 	client runnerAPI
+	// temporaryEnvironmentID is the ID of the temporary environment created for a run with
+	// --custom-url, which is deleted once the run is done
+	temporaryEnvironmentID int
 }
 
 func startRun(c cliContext) error {
@@ -48,9 +57,9 @@ func (r *runner) startRun(c cliContext) error {
 	if runIDStr := c.String("reattach"); runIDStr != "" {
 		runID, err := strconv.Atoi(runIDStr)
 		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
+			return cli.NewExitError(err.Error(), exitCodeValidationError)
 		}
-		return monitorRunStatus(c, runID)
+		return monitorRunStatus(c, runID, 0)
 	}
 
 	// verify --max-reruns is not used with either --fail-fast or --background
@@ -61,10 +70,14 @@ func (r *runner) startRun(c cliContext) error {
 		return cli.NewExitError(
 			"You can't use --fail-fast or --background when --max-reruns is greater than 0. "+
 				"For the CLI to rerun on failure, it has to wait until completion.",
-			1,
+			exitCodeValidationError,
 		)
 	}
 
+	if _, err := getMonitorOptions(c); err != nil {
+		return cli.NewExitError(err.Error(), exitCodeValidationError)
+	}
+
 	var err error
 	var branchID int
 	branchName := c.String("branch")
@@ -77,26 +90,34 @@ func (r *runner) startRun(c cliContext) error {
 	}
 
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
 	}
 
 	var localTests []*rainforest.RFTest
 	if c.Bool("f") {
 		localTests, err = r.prepareLocalRun(c, branchID)
 		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
+			return newErrorExitError(err)
 		}
 	}
 
 	params, err := r.makeRunParams(c, localTests, branchID)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
 	}
 
+	// The temporary environment isn't used by anything if the run isn't created
+	runCreated := false
+	defer func() {
+		if !runCreated {
+			deleteTemporaryEnvironment(c, r.client, r.temporaryEnvironmentID)
+		}
+	}()
+
 	if c.Bool("git-trigger") {
 		git, err := gitTrigger.NewGitTrigger()
 		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
+			return newErrorExitError(err)
 		}
 		if !git.CheckTrigger() {
 			log.Printf("Git trigger enabled, but %v was not found in latest commit. Exiting...", git.Trigger)
@@ -114,33 +135,52 @@ func (r *runner) startRun(c cliContext) error {
 
 	err = preRunCSVUpload(c, api)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
+	}
+
+	err = preRunVariableRows(c, api)
+	if err != nil {
+		return newErrorExitError(err)
+	}
+
+	err = preRunMobileUpload(c, api, &params)
+	if err != nil {
+		return newErrorExitError(err)
 	}
 
 	runStatus, err := r.client.CreateRun(params)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
 	}
+	runCreated = true
 	r.showRunCreated(runStatus)
 	writeRunID(c, runStatus)
 
 	// if background flag is enabled we'll skip monitoring run status
 	if c.Bool("bg") {
+		if r.temporaryEnvironmentID != 0 {
+			log.Printf("Temporary environment %v is kept for the run, "+
+				"use `rainforest environments prune` to delete it later", r.temporaryEnvironmentID)
+		}
 		return nil
 	}
 
-	return monitorRunStatus(c, runStatus.ID)
+	return monitorRunStatus(c, runStatus.ID, r.temporaryEnvironmentID)
 }
 
 // rerunRun reruns failed tests from a previous Rainforest run & depending on passed flags monitors its execution
 func (r *runner) rerunRun(c cliContext) error {
+	if _, err := getMonitorOptions(c); err != nil {
+		return cli.NewExitError(err.Error(), exitCodeValidationError)
+	}
+
 	params, err := r.makeRerunParams(c)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
 	}
 	runStatus, err := r.client.CreateRun(params)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return newErrorExitError(err)
 	}
 	r.showRunCreated(runStatus)
 	writeRunID(c, runStatus)
@@ -150,7 +190,7 @@ func (r *runner) rerunRun(c cliContext) error {
 		return nil
 	}
 
-	return monitorRunStatus(c, runStatus.ID)
+	return monitorRunStatus(c, runStatus.ID, 0)
 }
 
 func (r *runner) showRunCreated(runStatus *rainforest.RunStatus) {
@@ -267,89 +307,248 @@ func filterExecuteTests(tests []*rainforest.RFTest, tags []string, forceExecute,
 	return result
 }
 
-func monitorRunStatus(c cliContext, runID int) error {
-	failedAttempts := 1
+// monitorRunStatus waits for the run to be done and, with max-reruns, reruns its failed
+// tests until they pass or no reruns are left. The temporary environment with the ID
+// temporaryEnvironmentID, if any, is deleted once the run and its reruns are done or when
+// the CLI is interrupted.
+func monitorRunStatus(c cliContext, runID int, temporaryEnvironmentID int) error {
+	return monitorRun(c, api, runID, temporaryEnvironmentID)
+}
 
-	for {
-		status, msg, done, err := getRunStatus(c.Bool("fail-fast"), runID, api)
-		log.Print(msg)
+func monitorRun(c cliContext, client runMonitorAPI, runID int, temporaryEnvironmentID int) error {
+	opts, err := getMonitorOptions(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), exitCodeValidationError)
+	}
+	conflict, err := getConflict(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), exitCodeValidationError)
+	}
 
-		if done {
-			if c.String("junit-file") != "" {
-				writeJunit(c, api, runID)
+	// The timeout covers the run and all its reruns
+	var deadline time.Time
+	if opts.timeout > 0 {
+		deadline = time.Now().Add(opts.timeout)
+	}
+
+	a := runAttempt{
+		runID:                  runID,
+		attempt:                c.Uint("rerun-attempt"),
+		temporaryEnvironmentID: temporaryEnvironmentID,
+	}
+	maxReruns := c.Uint("max-reruns")
+	mergeReruns := c.Bool("junit-merge-reruns")
+	var attempts []runAttempt
+	var statuses []*rainforest.RunStatus
+	var junitReports [][]byte
+
+	for {
+		status, err := waitForRun(c, client, a, opts, deadline)
+		if err != nil {
+			return err
+		}
+		attempts = append(attempts, a)
+		statuses = append(statuses, status)
+
+		if mergeReruns && len(attempts) > 1 {
+			// The reruns are merged into the report of the first attempt as soon as they're done
+			if junitFile := attempts[0].junitFile(c); junitFile != "" {
+				if err := mergeRerunJunit(client, a.runID, status, junitFile, &junitReports); err != nil {
+					deleteTemporaryEnvironment(c, client, temporaryEnvironmentID)
+					return junitExitError(a.runID, err)
+				}
+			}
+		} else if junitFile := a.junitFile(c); junitFile != "" {
+			if err := writeRunJunit(client, a.runID, status, junitFile); err != nil {
+				deleteTemporaryEnvironment(c, client, temporaryEnvironmentID)
+				return junitExitError(a.runID, err)
 			}
+		}
 
-			if status.Result != "passed" {
-				rerunAttempt := c.Uint("rerun-attempt")
-				remainingReruns := c.Uint("max-reruns") - rerunAttempt
-				if remainingReruns > 0 {
-					cmd, _ := buildRerunArgs(c, runID)
-					path, err := os.Executable()
-					if err != nil {
-						return cli.NewExitError(err.Error(), 1)
-					}
+		// A cancelled run isn't rerun
+		exitCode := runExitCode(status)
+		if exitCode == 0 || exitCode == exitCodeRunCancelled || a.attempt >= maxReruns {
+			break
+		}
+
+		log.Printf("Rerunning %v, attempt %v", a.runID, a.attempt+1)
+		rerun, err := client.CreateRun(rainforest.RunParams{RunID: a.runID, Conflict: conflict})
+		if err != nil {
+			deleteTemporaryEnvironment(c, client, temporaryEnvironmentID)
+			return newErrorExitError(err)
+		}
+		log.Printf("Run %v has been created. The detailed results are available at %v", rerun.ID, rerun.FrontendURL)
+		writeRunID(c, rerun)
 
-					log.Printf("Rerunning %v, attempt %v", runID, rerunAttempt+1)
-					exec_err := syscall.Exec(path, cmd, os.Environ())
-					if exec_err != nil {
-						return cli.NewExitError(exec_err.Error(), 1)
+		a.runID = rerun.ID
+		a.attempt++
+	}
+
+	deleteTemporaryEnvironment(c, client, temporaryEnvironmentID)
+
+	if len(attempts) > 1 {
+		printRerunSummary(attempts, statuses)
+
+		// The report of the first attempt is replaced by the merged report of all attempts
+		if junitFile := attempts[0].junitFile(c); junitFile != "" {
+			if !mergeReruns {
+				for _, attempt := range attempts {
+					report, err := os.ReadFile(attempt.junitFile(c))
+					if err != nil {
+						return junitExitError(attempt.runID, err)
 					}
-				} else {
-					return cli.NewExitError("", 1)
+					junitReports = append(junitReports, report)
+				}
+				if err := writeMergedJunit(junitFile, junitReports, false); err != nil {
+					return junitExitError(runID, err)
 				}
 			}
+			log.Printf("Merged the JUnit reports of %v attempts into %v", len(attempts), junitFile)
+		}
+	}
 
-			if status.FrontendURL != "" {
-				log.Printf("The detailed results are available at %v\n", status.FrontendURL)
-			}
+	status := statuses[len(statuses)-1]
+	if status.FrontendURL != "" {
+		log.Printf("The detailed results are available at %v\n", status.FrontendURL)
+	}
+	if exitCode := runExitCode(status); exitCode != 0 {
+		return cli.NewExitError("", exitCode)
+	}
 
-			return nil
+	return nil
+}
+
+// mergeRerunJunit downloads the JUnit report of a rerun and merges it with the reports of the
+// earlier attempts in reports into junitFile, keeping the failed attempts of the rerun tests
+func mergeRerunJunit(client runMonitorAPI, runID int, status *rainforest.RunStatus, junitFile string, reports *[][]byte) error {
+	// The report of the first attempt was written to junitFile
+	if len(*reports) == 0 {
+		report, err := os.ReadFile(junitFile)
+		if err != nil {
+			return err
+		}
+		*reports = append(*reports, report)
+	}
+
+	var report bytes.Buffer
+	if err := client.DownloadRunJunit(runID, &report); err != nil {
+		return err
+	}
+	if err := validateJunit(bytes.NewReader(report.Bytes()), status); err != nil {
+		return fmt.Errorf("Invalid JUnit report for run %v: %v", runID, err)
+	}
+	*reports = append(*reports, report.Bytes())
+	return writeMergedJunit(junitFile, *reports, true)
+}
+
+// junitExitError is the error for a JUnit report which couldn't be written. The run isn't
+// reported as done without the report which was asked for. Only a failed download is an API
+// error, an invalid report or a file which can't be written is a validation error.
+func junitExitError(runID int, err error) *cli.ExitError {
+	return cli.NewExitError(fmt.Sprintf("Unable to write the JUnit report of run %v: %v", runID, err), errorExitCode(err))
+}
+
+// writeMergedJunit merges the JUnit reports of a run and its reruns into junitFile, keeping the
+// failed attempts of the rerun tests with history
+func writeMergedJunit(junitFile string, reports [][]byte, history bool) error {
+	merged, err := mergeJunitFiles(reports, history)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(junitFile, merged)
+}
+
+// waitForRun polls the status of the run until it's done
+func waitForRun(c cliContext, client runMonitorAPI, a runAttempt, opts monitorOptions, deadline time.Time) (*rainforest.RunStatus, error) {
+	failedAttempts := 1
+	poller := newRunStatusPoller(opts)
+
+	stop := handleRunInterrupts(c, client, a)
+	defer stop()
+
+	var receiver *runWebhookReceiver
+	if addr := c.String("webhook-listen"); addr != "" {
+		var err error
+		receiver, err = startRunWebhookReceiver(addr, a.runID)
+		if err != nil {
+			log.Printf("Unable to listen for webhooks on %v, polling the run status instead: %v", addr, err)
+		} else {
+			defer receiver.Close()
+			log.Printf("Listening for webhooks of run %v on %v", a.runID, receiver.Addr())
+		}
+	}
+
+	for {
+		status, msg, done, err := getRunStatus(c.Bool("fail-fast"), a.runID, client)
+		log.Print(msg)
+
+		if done {
+			return status, nil
 		}
 
 		// If we've had too many errors, give up
 		if failedAttempts >= 5 {
+			if a.temporaryEnvironmentID != 0 {
+				log.Printf("Temporary environment %v is kept as the run may still be in progress", a.temporaryEnvironmentID)
+			}
 			msg := fmt.Sprintf("Can not get run status after %d attempts, giving up", failedAttempts)
-			return cli.NewExitError(msg, 1)
+			return nil, cli.NewExitError(msg, exitCodeAPIError)
 		}
 
 		// If we hit an error, record it
 		if err != nil {
 			failedAttempts++
+			status = nil
 		} else {
 			// Reset attempts
 			failedAttempts = 1
 		}
 
-		time.Sleep(runStatusPollInterval)
-	}
-}
+		wait := poller.next(status)
+		// With a webhook receiver the status is checked when a webhook arrives, polling only
+		// in case webhooks don't reach the CLI
+		if receiver != nil && err == nil {
+			wait = webhookFallbackPollInterval
+		}
 
-func buildRerunArgs(c cliContext, runID int) ([]string, error) {
-	maxReruns := c.Uint("max-reruns")
-	rerunAttempt := c.Uint("rerun-attempt")
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return nil, timeOutRun(c, client, a, opts.timeout)
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
 
-	cmd := []string{
-		"rainforest-cli",
-		"rerun", strconv.Itoa(runID),
-		"--max-reruns", fmt.Sprint(maxReruns),
-		"--rerun-attempt", fmt.Sprint(rerunAttempt + 1),
-		"--skip-update", // skip auto-updates for reruns
+		if receiver != nil && err == nil {
+			receiver.wait(wait)
+		} else {
+			time.Sleep(wait)
+		}
 	}
+}
 
-	if token := c.GlobalString("token"); len(token) > 0 {
-		cmd = append(cmd, "--token", token)
-	}
-	if conflict := c.String("conflict"); len(conflict) > 0 {
-		cmd = append(cmd, "--conflict", conflict)
+// deleteTemporaryEnvironment deletes the temporary environment created for a run, unless
+// the keep-temporary-environment flag is set. Failing to delete it doesn't fail the run.
+func deleteTemporaryEnvironment(c cliContext, client temporaryEnvironmentAPI, temporaryEnvironmentID int) {
+	if temporaryEnvironmentID == 0 {
+		return
 	}
-	if junitFile := c.String("junit-file"); len(junitFile) > 0 {
-		cmd = append(cmd, "--junit-file", junitFile)
+	if c.Bool("keep-temporary-environment") {
+		log.Printf("Keeping temporary environment %v", temporaryEnvironmentID)
+		return
 	}
 
-	return cmd, nil
+	err := client.DeleteEnvironment(temporaryEnvironmentID)
+	if err != nil {
+		log.Printf("Unable to delete temporary environment %v: %v", temporaryEnvironmentID, err)
+		return
+	}
+	log.Printf("Deleted temporary environment %v", temporaryEnvironmentID)
 }
 
-func getRunStatus(failFast bool, runID int, client runnerAPI) (*rainforest.RunStatus, string, bool, error) {
+func getRunStatus(failFast bool, runID int, client runStatusAPI) (*rainforest.RunStatus, string, bool, error) {
 	newStatus, err := client.CheckRunStatus(runID)
 	if err != nil {
 		msg := fmt.Sprintf("API error: %v\n", err)
@@ -444,6 +643,7 @@ func (r *runner) makeRunParams(c cliContext, localTests []*rainforest.RFTest, br
 
 		log.Printf("Created temporary environment with name %v", environment.Name)
 		environmentID = environment.ID
+		r.temporaryEnvironmentID = environment.ID
 	} else if s := c.String("environment-id"); s != "" {
 		environmentID, err = strconv.Atoi(c.String("environment-id"))
 		if err != nil {
@@ -614,13 +814,11 @@ func writeRunID(c cliContext, runStatus *rainforest.RunStatus) error {
 	}
 
 	file, err := os.Create(filePath)
-	defer file.Close()
-
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
-	} else {
-		file.WriteString(fmt.Sprintf("%v\n", runStatus.ID))
 	}
+	defer file.Close()
 
+	file.WriteString(fmt.Sprintf("%v\n", runStatus.ID))
 	return nil
 }
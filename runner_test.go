@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -85,6 +86,8 @@ type fakeRunnerClient struct {
 
 	temporaryEnvironmentURL     string
 	temporaryEnvironmentWebhook string
+	deletedEnvironments         []int
+	createRunErr                error
 }
 
 func (r *fakeRunnerClient) CheckRunStatus(runID int) (*rainforest.RunStatus, error) {
@@ -125,8 +128,16 @@ func (r *fakeRunnerClient) CreateTemporaryEnvironment(n string, s string, t stri
 	return &r.environment, nil
 }
 
+func (r *fakeRunnerClient) DeleteEnvironment(envID int) error {
+	r.deletedEnvironments = append(r.deletedEnvironments, envID)
+	return nil
+}
+
 func (r *fakeRunnerClient) CreateRun(p rainforest.RunParams) (*rainforest.RunStatus, error) {
 	r.runParams = p
+	if r.createRunErr != nil {
+		return nil, r.createRunErr
+	}
 	return &rainforest.RunStatus{}, nil
 }
 
@@ -487,54 +498,45 @@ func TestStartLocalRun(t *testing.T) {
 	}
 }
 
-func TestBuildRerunArgs(t *testing.T) {
+func TestStartRun_TemporaryEnvironmentCleanup(t *testing.T) {
 	testCases := []struct {
-		Mappings map[string]interface{}
-		Args     cli.Args
-		RunID    int
-		WantArgs []string
+		mappings     map[string]interface{}
+		createRunErr error
+		wantDeleted  []int
 	}{
 		{
-			Mappings: map[string]interface{}{
-				"junit-file":  "result.xml",
-				"max-reruns":  uint(2),
-				"skip-update": true,
-			},
-			Args:  cli.Args{},
-			RunID: 123,
-			WantArgs: []string{
-				"rainforest-cli",
-				"rerun",
-				"123",
-				"--max-reruns", "2",
-				"--rerun-attempt", "1",
-				"--skip-update",
-				"--junit-file", "result.xml",
-			},
+			mappings:    map[string]interface{}{"custom-url": "https://example.com", "bg": true},
+			wantDeleted: nil,
 		},
 		{
-			Mappings: map[string]interface{}{
-				"max-reruns": uint(1),
-				"token":      "deadbeef",
-			},
-			Args:  cli.Args{},
-			RunID: 123,
-			WantArgs: []string{
-				"rainforest-cli",
-				"rerun",
-				"123",
-				"--max-reruns", "1",
-				"--rerun-attempt", "1",
-				"--skip-update",
-				"--token", "deadbeef",
+			mappings:     map[string]interface{}{"custom-url": "https://example.com", "bg": true},
+			createRunErr: errors.New("run not created"),
+			wantDeleted:  []int{123},
+		},
+		{
+			mappings: map[string]interface{}{
+				"custom-url":                 "https://example.com",
+				"keep-temporary-environment": true,
 			},
+			createRunErr: errors.New("run not created"),
+			wantDeleted:  nil,
 		},
 	}
+
 	for _, testCase := range testCases {
-		c := newFakeContext(testCase.Mappings, testCase.Args)
-		gotArgs, _ := buildRerunArgs(c, testCase.RunID)
-		if !reflect.DeepEqual(gotArgs, testCase.WantArgs) {
-			t.Errorf("\nWanted %v\n   got %v", testCase.WantArgs, gotArgs)
+		c := newFakeContext(testCase.mappings, cli.Args{"all"})
+		client := &fakeRunnerClient{
+			environment:  rainforest.Environment{ID: 123, Name: "temporary-env-for-custom-url-via-CLI"},
+			createRunErr: testCase.createRunErr,
+		}
+		r := runner{client: client}
+
+		err := r.startRun(c)
+		if testCase.createRunErr == nil && err != nil {
+			t.Error("Error starting run:", err)
+		}
+		if !reflect.DeepEqual(client.deletedEnvironments, testCase.wantDeleted) {
+			t.Errorf("Deleted environments %v, want %v", client.deletedEnvironments, testCase.wantDeleted)
 		}
 	}
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// runListAPI is part of the API connected to listing runs
+type runListAPI interface {
+	GetRuns(rainforest.RunFilters) ([]rainforest.Run, error)
+	branchAPI
+	environmentAPI
+}
+
+// printRuns fetches and prints the runs matching the filters, to be used with the runs cli
+// command.
+func printRuns(c cliContext, api runListAPI) error {
+	filters, err := getRunFilters(c, api, time.Now())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	format := c.String("format")
+	if format == "" {
+		format = "table"
+	}
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid format %q. Valid formats are table and json.", format), 1)
+	}
+
+	runs, err := api.GetRuns(filters)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if format == "json" {
+		if runs == nil {
+			runs = []rainforest.Run{}
+		}
+		encoder := json.NewEncoder(tablesOut)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(runs); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	rows := make([][]string, len(runs))
+	for i, run := range runs {
+		var created, branch, environment string
+		if !run.CreatedAt.IsZero() {
+			created = run.CreatedAt.Local().Format("2006-01-02 15:04")
+		}
+		if run.Branch != nil {
+			branch = run.Branch.Name
+		}
+		if run.Environment != nil {
+			environment = run.Environment.Name
+		}
+		rows[i] = []string{strconv.Itoa(run.ID), created, run.State, run.Result, run.Release,
+			branch, environment, run.Description}
+	}
+
+	printResourceTable([]string{"Run ID", "Created", "State", "Result", "Release", "Branch",
+		"Environment", "Description"}, rows)
+	return nil
+}
+
+// getRunFilters gets the filters of the runs command from the cli. The branch and environment
+// can be given by name.
+func getRunFilters(c cliContext, api runListAPI, now time.Time) (rainforest.RunFilters, error) {
+	filters := rainforest.RunFilters{
+		State:       strings.TrimSpace(c.String("state")),
+		Result:      strings.TrimSpace(c.String("result")),
+		Release:     strings.TrimSpace(c.String("release")),
+		Description: strings.TrimSpace(c.String("description")),
+		RunGroupID:  c.Int("run-group"),
+	}
+	if limit := c.Int("limit"); limit > 0 {
+		filters.Limit = limit
+	}
+
+	var err error
+	if branchName := strings.TrimSpace(c.String("branch")); branchName != "" {
+		filters.BranchID, err = getBranchID(branchName, api)
+		if err != nil {
+			return filters, err
+		}
+	}
+	if environment := c.String("environment"); environment != "" {
+		filters.EnvironmentID, err = getEnvironmentID(environment, api)
+		if err != nil {
+			return filters, err
+		}
+	}
+
+	if since := c.String("since"); since != "" {
+		filters.CreatedAfter, err = parseRunDate(since, now)
+		if err != nil {
+			return filters, err
+		}
+	}
+	if until := c.String("until"); until != "" {
+		filters.CreatedBefore, err = parseRunDate(until, now)
+		if err != nil {
+			return filters, err
+		}
+	}
+	if !filters.CreatedAfter.IsZero() && !filters.CreatedBefore.IsZero() &&
+		filters.CreatedBefore.Before(filters.CreatedAfter) {
+		return filters, fmt.Errorf("--until %v is before --since %v", c.String("until"), c.String("since"))
+	}
+
+	return filters, nil
+}
+
+// parseRunDate parses a date (2006-01-02), a time (RFC 3339) or an age before now (e.g. 36h
+// or 7d) of the date range of the runs command
+func parseRunDate(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if age, err := parseAge(s); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid date %q, use a date such as 2006-01-02, a time such as 2006-01-02T15:04:05Z or an age such as 7d", s)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeRunListAPI struct {
+	*fakeEnvironmentAPI
+	*testBranchAPI
+	runs    []rainforest.Run
+	filters rainforest.RunFilters
+}
+
+func (f *fakeRunListAPI) GetRuns(filters rainforest.RunFilters) ([]rainforest.Run, error) {
+	f.filters = filters
+	if filters.Limit > 0 && len(f.runs) > filters.Limit {
+		return f.runs[:filters.Limit], nil
+	}
+	return f.runs, nil
+}
+
+func newFakeRunListAPI() *fakeRunListAPI {
+	return &fakeRunListAPI{
+		fakeEnvironmentAPI: &fakeEnvironmentAPI{environments: []rainforest.Environment{{ID: 8, Name: "QA"}}},
+		testBranchAPI: &testBranchAPI{
+			handleGetBranches: func(params ...string) ([]rainforest.Branch, error) {
+				return []rainforest.Branch{{ID: 7, Name: "feature"}}, nil
+			},
+		},
+		runs: []rainforest.Run{
+			{
+				ID:          3,
+				State:       "complete",
+				Result:      "failed",
+				Release:     "1.2.0",
+				Description: "Nightly",
+				Branch:      &rainforest.Branch{ID: 7, Name: "feature"},
+				Environment: &rainforest.Environment{ID: 8, Name: "QA"},
+			},
+			{ID: 2, State: "complete", Result: "passed"},
+		},
+	}
+}
+
+func TestPrintRuns(t *testing.T) {
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	api := newFakeRunListAPI()
+	c := newFakeContext(map[string]interface{}{
+		"result":      "failed",
+		"release":     "1.2.0",
+		"branch":      "feature",
+		"environment": "QA",
+		"run-group":   12,
+		"description": "Nightly",
+		"since":       "2020-01-01T00:00:00Z",
+	}, cli.Args{})
+	if err := printRuns(c, api); err != nil {
+		t.Fatal(err)
+	}
+
+	want := rainforest.RunFilters{
+		Result:        "failed",
+		Release:       "1.2.0",
+		Description:   "Nightly",
+		BranchID:      7,
+		EnvironmentID: 8,
+		RunGroupID:    12,
+		CreatedAfter:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(api.filters, want) {
+		t.Errorf("Filters = %+v, want %+v", api.filters, want)
+	}
+	regexMatchOut(`\| +RUN ID +\| +CREATED +\| +STATE +\| +RESULT +\| +RELEASE +\| +BRANCH +\| +ENVIRONMENT +\| +DESCRIPTION +\|`, t)
+	regexMatchOut(`\| +3 +\| +\| +complete +\| +failed +\| +1\.2\.0 +\| +feature +\| +QA +\| +Nightly +\|`, t)
+	regexMatchOut(`\| +2 +\| +\| +complete +\| +passed +\|`, t)
+
+	// The most recent runs can be printed as JSON
+	tablesOut = &bytes.Buffer{}
+	c = newFakeContext(map[string]interface{}{"limit": 1, "format": "json"}, cli.Args{})
+	if err := printRuns(c, api); err != nil {
+		t.Fatal(err)
+	}
+	var runs []rainforest.Run
+	if err := json.Unmarshal(tablesOut.(*bytes.Buffer).Bytes(), &runs); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%v", err, tablesOut)
+	}
+	if len(runs) != 1 || runs[0].ID != 3 || api.filters.Limit != 1 {
+		t.Errorf("Expected only the most recent run, got %+v with limit %v", runs, api.filters.Limit)
+	}
+
+	c = newFakeContext(map[string]interface{}{"format": "yaml"}, cli.Args{})
+	if err := printRuns(c, api); err == nil {
+		t.Error("Expected an invalid format error")
+	}
+}
+
+func TestGetRunFilters_Dates(t *testing.T) {
+	now := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	api := newFakeRunListAPI()
+
+	c := newFakeContext(map[string]interface{}{"since": "7d", "until": "36h"}, cli.Args{})
+	filters, err := getRunFilters(c, api, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-7 * 24 * time.Hour); !filters.CreatedAfter.Equal(want) {
+		t.Errorf("CreatedAfter = %v, want %v", filters.CreatedAfter, want)
+	}
+	if want := now.Add(-36 * time.Hour); !filters.CreatedBefore.Equal(want) {
+		t.Errorf("CreatedBefore = %v, want %v", filters.CreatedBefore, want)
+	}
+
+	c = newFakeContext(map[string]interface{}{"since": "2020-01-05"}, cli.Args{})
+	if filters, err = getRunFilters(c, api, now); err != nil || filters.CreatedAfter.Day() != 5 {
+		t.Errorf("Expected runs since 2020-01-05, got %v, %v", filters.CreatedAfter, err)
+	}
+
+	for _, mappings := range []map[string]interface{}{
+		{"since": "last week"},
+		{"since": "1d", "until": "7d"},
+		{"environment": "Production"},
+	} {
+		if _, err := getRunFilters(newFakeContext(mappings, cli.Args{}), api, now); err == nil {
+			t.Errorf("Expected an error for %v", mappings)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+// siteEnvironmentsAPI is part of the API connected to site environments
+type siteEnvironmentsAPI interface {
+	GetSites() ([]rainforest.Site, error)
+	GetEnvironments() ([]rainforest.Environment, error)
+	GetSiteEnvironments() ([]rainforest.SiteEnvironment, error)
+	SetSiteEnvironmentURL(siteID int, environmentID int, newURL string) error
+	UpdateURLs(siteID int, environmentID int, slotURLs map[int]string) error
+}
+
+// printSiteEnvironments fetches and prints out the URL of each site in each environment,
+// with a row for each app slot. The list can be filtered by site-id and environment-id.
+func printSiteEnvironments(c cliContext, api siteEnvironmentsAPI) error {
+	siteEnvironments, err := api.GetSiteEnvironments()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	sites, err := api.GetSites()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	environments, err := api.GetEnvironments()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	siteNames := make(map[int]string)
+	for _, site := range sites {
+		siteNames[site.ID] = site.Name
+	}
+	environmentNames := make(map[int]string)
+	for _, environment := range environments {
+		environmentNames[environment.ID] = environment.Name
+	}
+
+	siteID := c.Int("site-id")
+	environmentID := c.Int("environment-id")
+	rows := [][]string{}
+	for _, siteEnvironment := range siteEnvironments {
+		if (siteID != 0 && siteEnvironment.SiteID != siteID) ||
+			(environmentID != 0 && siteEnvironment.EnvironmentID != environmentID) {
+			continue
+		}
+		for i, slotURL := range strings.Split(siteEnvironment.URL, "|") {
+			rows = append(rows, []string{
+				strconv.Itoa(siteEnvironment.SiteID),
+				siteNames[siteEnvironment.SiteID],
+				strconv.Itoa(siteEnvironment.EnvironmentID),
+				environmentNames[siteEnvironment.EnvironmentID],
+				strconv.Itoa(i + 1),
+				slotURL,
+			})
+		}
+	}
+
+	if len(rows) == 0 {
+		log.Print("No site environments found.")
+		return nil
+	}
+	printResourceTable([]string{"Site ID", "Site Name", "Environment ID", "Environment Name", "Slot", "URL"}, rows)
+	return nil
+}
+
+// setSiteEnvironmentURL changes the URL of a site in an environment, to be used with the
+// site-environments set-url cli command. With app-slot only the URL of that slot changes,
+// otherwise the whole URL is replaced.
+func setSiteEnvironmentURL(c cliContext, api siteEnvironmentsAPI) error {
+	newURL := c.Args().First()
+	if newURL == "" {
+		return cli.NewExitError("URL not specified", 1)
+	}
+	if strings.Contains(newURL, "|") {
+		return cli.NewExitError("URL can't contain |, use --app-slot to set the URL of each app slot", 1)
+	}
+	if u, err := url.Parse(newURL); err != nil || u.Scheme == "" {
+		return cli.NewExitError(fmt.Sprintf("Invalid URL %v", newURL), 1)
+	}
+
+	siteID := c.Int("site-id")
+	if siteID == 0 {
+		return cli.NewExitError("site-id flag required", 1)
+	}
+	environmentID := c.Int("environment-id")
+	if environmentID == 0 {
+		return cli.NewExitError("environment-id flag required", 1)
+	}
+
+	var err error
+	if appSlot := c.Int("app-slot"); appSlot != 0 {
+		if appSlot < 1 || appSlot > 100 {
+			return cli.NewExitError("app-slot must be an integer (1 to 100)", 1)
+		}
+		err = api.UpdateURLs(siteID, environmentID, map[int]string{appSlot: newURL})
+	} else {
+		err = api.SetSiteEnvironmentURL(siteID, environmentID, newURL)
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	log.Printf("URL of site %v in environment %v set to %v", siteID, environmentID, newURL)
+	return nil
+}
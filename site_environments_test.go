@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+)
+
+type fakeSiteEnvironmentsAPI struct {
+	siteEnvironments []rainforest.SiteEnvironment
+	setURLs          []string
+	updatedSlots     []map[int]string
+}
+
+func (f *fakeSiteEnvironmentsAPI) GetSites() ([]rainforest.Site, error) {
+	return []rainforest.Site{{ID: 1, Name: "Web"}, {ID: 2, Name: "Rider app"}}, nil
+}
+
+func (f *fakeSiteEnvironmentsAPI) GetEnvironments() ([]rainforest.Environment, error) {
+	return []rainforest.Environment{{ID: 10, Name: "QA"}, {ID: 11, Name: "Staging"}}, nil
+}
+
+func (f *fakeSiteEnvironmentsAPI) GetSiteEnvironments() ([]rainforest.SiteEnvironment, error) {
+	return f.siteEnvironments, nil
+}
+
+func (f *fakeSiteEnvironmentsAPI) SetSiteEnvironmentURL(siteID int, environmentID int, newURL string) error {
+	f.setURLs = append(f.setURLs, newURL)
+	return nil
+}
+
+func (f *fakeSiteEnvironmentsAPI) UpdateURLs(siteID int, environmentID int, slotURLs map[int]string) error {
+	f.updatedSlots = append(f.updatedSlots, slotURLs)
+	return nil
+}
+
+func TestPrintSiteEnvironments(t *testing.T) {
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	f := &fakeSiteEnvironmentsAPI{
+		siteEnvironments: []rainforest.SiteEnvironment{
+			{ID: 1, SiteID: 1, EnvironmentID: 10, URL: "https://qa.example.com"},
+			{ID: 2, SiteID: 2, EnvironmentID: 10, URL: "https://apps.example.com/rider.apk|https://apps.example.com/driver.apk"},
+			{ID: 3, SiteID: 1, EnvironmentID: 11, URL: "https://staging.example.com"},
+		},
+	}
+
+	if err := printSiteEnvironments(newFakeContext(map[string]interface{}{}, cli.Args{}), f); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	table := tablesOut.(*bytes.Buffer).String()
+	for _, want := range []string{
+		"| Web       |             10 | QA               |    1 | https://qa.example.com",
+		"| Rider app |             10 | QA               |    1 | https://apps.example.com/rider.apk",
+		"| Rider app |             10 | QA               |    2 | https://apps.example.com/driver.apk",
+		"| Web       |             11 | Staging          |    1 | https://staging.example.com",
+	} {
+		if !strings.Contains(table, want) {
+			t.Errorf("Expected table to contain %q, got %v", want, table)
+		}
+	}
+
+	tablesOut = &bytes.Buffer{}
+	context := newFakeContext(map[string]interface{}{"site-id": 1, "environment-id": 11}, cli.Args{})
+	if err := printSiteEnvironments(context, f); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	table = tablesOut.(*bytes.Buffer).String()
+	if !strings.Contains(table, "staging.example.com") || strings.Contains(table, "qa.example.com") {
+		t.Errorf("Expected only the filtered site environment, got %v", table)
+	}
+}
+
+func TestSetSiteEnvironmentURL(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	f := &fakeSiteEnvironmentsAPI{}
+	context := newFakeContext(map[string]interface{}{
+		"site-id":        1,
+		"environment-id": 10,
+	}, cli.Args{"https://pr-123.example.com"})
+	if err := setSiteEnvironmentURL(context, f); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"https://pr-123.example.com"}; !reflect.DeepEqual(f.setURLs, expected) {
+		t.Errorf("Incorrect URLs set. Got %v, expected: %v", f.setURLs, expected)
+	}
+
+	context = newFakeContext(map[string]interface{}{
+		"site-id":        2,
+		"environment-id": 10,
+		"app-slot":       2,
+	}, cli.Args{"https://apps.example.com/driver-2.apk"})
+	if err := setSiteEnvironmentURL(context, f); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []map[int]string{{2: "https://apps.example.com/driver-2.apk"}}; !reflect.DeepEqual(f.updatedSlots, expected) {
+		t.Errorf("Incorrect slots updated. Got %v, expected: %v", f.updatedSlots, expected)
+	}
+
+	testCases := []struct {
+		mappings map[string]interface{}
+		args     cli.Args
+		err      string
+	}{
+		{map[string]interface{}{"site-id": 1, "environment-id": 10}, cli.Args{}, "URL not specified"},
+		{map[string]interface{}{"site-id": 1, "environment-id": 10}, cli.Args{"example.com"}, "Invalid URL"},
+		{map[string]interface{}{"site-id": 1, "environment-id": 10}, cli.Args{"https://a.com|https://b.com"}, "can't contain |"},
+		{map[string]interface{}{"environment-id": 10}, cli.Args{"https://a.com"}, "site-id flag required"},
+		{map[string]interface{}{"site-id": 1}, cli.Args{"https://a.com"}, "environment-id flag required"},
+		{map[string]interface{}{"site-id": 1, "environment-id": 10, "app-slot": 101}, cli.Args{"https://a.com"}, "app-slot must be"},
+	}
+	for _, tc := range testCases {
+		err := setSiteEnvironmentURL(newFakeContext(tc.mappings, tc.args), f)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q for %v %v, got %v", tc.err, tc.mappings, tc.args, err)
+		}
+	}
+}
@@ -0,0 +1,824 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of tabular variable sources
+const (
+	tabularFormatCSV   = "csv"
+	tabularFormatJSON  = "json"
+	tabularFormatJSONL = "jsonl"
+	tabularFormatXLSX  = "xlsx"
+)
+
+// tabularReader reads tabular data one record at a time. The first record is the header
+// with column names. Read returns io.EOF when there are no more records.
+type tabularReader interface {
+	Read() ([]string, error)
+	Close() error
+}
+
+// openTabularSource opens the file at filePath, or stdin if filePath is "-", for reading
+// records in the given format. If format is empty, it's detected from the file extension
+// and defaults to CSV.
+func openTabularSource(filePath, format string) (tabularReader, error) {
+	if format == "" {
+		format = tabularFormatFromPath(filePath)
+	}
+	// zip archives need random access, so XLSX files are read from the file itself. Data
+	// from stdin is spooled to a file by tabularInput.prepare first.
+	if format == tabularFormatXLSX {
+		return newXLSXTabularReader(filePath)
+	}
+
+	var f io.ReadCloser
+	if filePath == "-" {
+		f = ioutil.NopCloser(os.Stdin)
+	} else {
+		var err error
+		f, err = os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case tabularFormatCSV:
+		r := csv.NewReader(f)
+		// rows with a wrong number of columns are reported by tabularInput.validate
+		r.FieldsPerRecord = -1
+		return &csvTabularReader{r, f}, nil
+	case tabularFormatJSON:
+		return newJSONTabularReader(f, true), nil
+	case tabularFormatJSONL:
+		return newJSONTabularReader(f, false), nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("Unsupported format %v, use one of: %v, %v, %v, %v", format,
+			tabularFormatCSV, tabularFormatJSON, tabularFormatJSONL, tabularFormatXLSX)
+	}
+}
+
+// tabularFormatFromPath returns the tabular format matching the file extension
+func tabularFormatFromPath(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return tabularFormatJSON
+	case ".jsonl", ".ndjson":
+		return tabularFormatJSONL
+	case ".xlsx":
+		return tabularFormatXLSX
+	default:
+		return tabularFormatCSV
+	}
+}
+
+// sniffTabularFormat detects the format of the file at filePath from its content, for
+// input without a file extension such as stdin: XLSX files are zip archives, JSON starts with
+// an array and JSON lines with an object. Anything else is read as CSV.
+func sniffTabularFormat(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return tabularFormatXLSX, nil
+	}
+	switch trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n"); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return tabularFormatJSON, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return tabularFormatJSONL, nil
+	default:
+		return tabularFormatCSV, nil
+	}
+}
+
+// readTabularBatch reads up to size records. At the end of the data it returns the
+// remaining records, possibly none, together with io.EOF.
+func readTabularBatch(r tabularReader, size int) ([][]string, error) {
+	batch := make([][]string, 0, size)
+	for len(batch) < size {
+		record, err := r.Read()
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, record)
+	}
+	return batch, nil
+}
+
+// readAllTabular reads all of the remaining records
+func readAllTabular(r tabularReader) ([][]string, error) {
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+// csvTabularReader reads records from CSV files
+type csvTabularReader struct {
+	*csv.Reader
+	io.Closer
+}
+
+// jsonTabularReader reads records from a JSON array or from JSON lines. Each element is
+// either an object, in which case keys of the first object become the header, or an
+// array of values, in which case the first array is the header.
+type jsonTabularReader struct {
+	io.Closer
+	dec       *json.Decoder
+	inArray   bool
+	started   bool
+	header    []string
+	headerIdx map[string]int
+	pending   []string
+	rowNum    int
+}
+
+func newJSONTabularReader(f io.ReadCloser, inArray bool) *jsonTabularReader {
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	return &jsonTabularReader{Closer: f, dec: dec, inArray: inArray}
+}
+
+// Read returns the next record
+func (r *jsonTabularReader) Read() ([]string, error) {
+	if !r.started {
+		r.started = true
+		if r.inArray {
+			if err := r.expectDelim('['); err != nil {
+				return nil, err
+			}
+		}
+
+		header, values, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if values != nil {
+			// the first element was an object, return its values after the header
+			r.pending = values
+		}
+		return header, nil
+	}
+
+	if r.pending != nil {
+		values := r.pending
+		r.pending = nil
+		return values, nil
+	}
+
+	record, values, err := r.next()
+	if values != nil {
+		return values, err
+	}
+	return record, err
+}
+
+// next parses the next element. Arrays are returned as a record, objects are returned
+// as values in header order, along with the header if it was just created.
+func (r *jsonTabularReader) next() ([]string, []string, error) {
+	if !r.dec.More() {
+		if r.inArray {
+			if err := r.expectDelim(']'); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, io.EOF
+	}
+	r.rowNum++
+
+	tok, err := r.dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch tok {
+	case json.Delim('['):
+		var record []string
+		for r.dec.More() {
+			value, err := r.readValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			record = append(record, value)
+		}
+		if err = r.expectDelim(']'); err != nil {
+			return nil, nil, err
+		}
+		if r.header == nil {
+			r.header = record
+		}
+		return record, nil, nil
+	case json.Delim('{'):
+		var keys, values []string
+		for r.dec.More() {
+			keyTok, err := r.dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			value, err := r.readValue()
+			if err != nil {
+				return nil, nil, err
+			}
+			keys = append(keys, keyTok.(string))
+			values = append(values, value)
+		}
+		if err = r.expectDelim('}'); err != nil {
+			return nil, nil, err
+		}
+
+		if r.header == nil {
+			r.header = keys
+			r.headerIdx = make(map[string]int)
+			for i, key := range keys {
+				r.headerIdx[key] = i
+			}
+			return keys, values, nil
+		}
+		if r.headerIdx == nil {
+			return nil, nil, fmt.Errorf("element %v is an object, but the first element was an array", r.rowNum)
+		}
+
+		record := make([]string, len(r.header))
+		for i, key := range keys {
+			idx, ok := r.headerIdx[key]
+			if !ok {
+				return nil, nil, fmt.Errorf("element %v has key %q which isn't present in the first element", r.rowNum, key)
+			}
+			record[idx] = values[i]
+		}
+		return nil, record, nil
+	default:
+		return nil, nil, fmt.Errorf("element %v must be an object or an array", r.rowNum)
+	}
+}
+
+// readValue reads a single value and formats it as a string. Nested objects and
+// arrays are not supported.
+func (r *jsonTabularReader) readValue() (string, error) {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return "", err
+	}
+
+	switch value := tok.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("element %v contains a nested value, only strings, numbers and booleans are supported", r.rowNum)
+	}
+}
+
+// expectDelim reads the next token and makes sure it's the given delimiter
+func (r *jsonTabularReader) expectDelim(delim json.Delim) error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// xlsxTabularReader reads records from the first sheet of an XLSX workbook. Rows of the
+// sheet are streamed, only shared strings are held in memory.
+type xlsxTabularReader struct {
+	archive       *zip.ReadCloser
+	sheet         io.ReadCloser
+	dec           *xml.Decoder
+	sharedStrings []string
+	width         int
+}
+
+// xlsxRelationshipsNS is the namespace of relationship IDs in XLSX files
+const xlsxRelationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// newXLSXTabularReader opens the first sheet of the XLSX file at filePath. The zip archive is
+// read from the file as needed instead of being loaded into memory.
+func newXLSXTabularReader(filePath string) (_ *xlsxTabularReader, err error) {
+	archive, err := zip.OpenReader(filePath)
+	if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) {
+		return nil, fmt.Errorf("invalid XLSX file: %v", err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			archive.Close()
+		}
+	}()
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := xlsxFirstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	sheetFile, ok := files[sheetPath]
+	if !ok {
+		return nil, errors.New("invalid XLSX file: no worksheets found")
+	}
+
+	r := &xlsxTabularReader{archive: archive}
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if r.sharedStrings, err = xlsxSharedStrings(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.sheet, err = sheetFile.Open(); err != nil {
+		return nil, err
+	}
+	r.dec = xml.NewDecoder(r.sheet)
+
+	return r, nil
+}
+
+// xlsxFirstSheetPath finds the path of the first sheet in the workbook
+func xlsxFirstSheetPath(files map[string]*zip.File) (string, error) {
+	const defaultPath = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	workbookFile, ok := files["xl/workbook.xml"]
+	relsFile, relsOk := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !relsOk {
+		return defaultPath, nil
+	}
+	if err := decodeXLSXFile(workbookFile, &workbook); err != nil {
+		return "", err
+	}
+	if err := decodeXLSXFile(relsFile, &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("invalid XLSX file: no worksheets found")
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return defaultPath, nil
+}
+
+// xlsxSharedStrings reads the shared strings table, which cells of type "s" refer to
+func xlsxSharedStrings(file *zip.File) ([]string, error) {
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeXLSXFile(file, &sst); err != nil {
+		return nil, err
+	}
+
+	sharedStrings := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		text := item.Text
+		for _, run := range item.Runs {
+			text += run.Text
+		}
+		sharedStrings[i] = text
+	}
+	return sharedStrings, nil
+}
+
+// decodeXLSXFile unmarshals an XML file from the workbook
+func decodeXLSXFile(file *zip.File, v interface{}) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = xml.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX file: %v: %v", file.Name, err)
+	}
+	return nil
+}
+
+// xlsxRow is a row of an XLSX sheet
+type xlsxRow struct {
+	Cells []struct {
+		Ref    string `xml:"r,attr"`
+		Type   string `xml:"t,attr"`
+		Value  string `xml:"v"`
+		Inline string `xml:"is>t"`
+	} `xml:"c"`
+}
+
+// Read returns the next non-empty row. Rows are padded with empty values to the width
+// of the header, as XLSX files omit trailing empty cells.
+func (r *xlsxTabularReader) Read() ([]string, error) {
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err = r.dec.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		if len(row.Cells) == 0 {
+			continue
+		}
+
+		var record []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = xlsxColumnIndex(cell.Ref)
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(r.sharedStrings) {
+					return nil, fmt.Errorf("invalid XLSX file: unknown shared string in cell %v", cell.Ref)
+				}
+				record[col] = r.sharedStrings[idx]
+			case "inlineStr":
+				record[col] = cell.Inline
+			case "b":
+				record[col] = strconv.FormatBool(cell.Value == "1")
+			default:
+				record[col] = cell.Value
+			}
+		}
+
+		if r.width == 0 {
+			r.width = len(record)
+		}
+		for len(record) < r.width {
+			record = append(record, "")
+		}
+		return record, nil
+	}
+}
+
+// Close closes the sheet
+func (r *xlsxTabularReader) Close() error {
+	err := r.sheet.Close()
+	if archiveErr := r.archive.Close(); err == nil {
+		err = archiveErr
+	}
+	return err
+}
+
+// xlsxColumnIndex returns the zero based column index of a cell reference such as "AB12"
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+	return col - 1
+}
+
+// maxTabularValidationErrors is the number of problems listed when validating tabular data
+const maxTabularValidationErrors = 10
+
+// tabularInput describes a file a tabular variable is read from
+type tabularInput struct {
+	// path of the file, "-" reads from stdin
+	path string
+	// format is one of the tabular formats, or empty to detect it from the file extension
+	format string
+	// mapping to apply to the columns, optional
+	mapping *tabularMapping
+}
+
+// prepare validates the input before anything is uploaded. Stdin can only be read once,
+// so it's saved to a temporary file first, and without a format its format is detected
+// from the content. The returned func removes the temporary file.
+func (in *tabularInput) prepare() (func(), error) {
+	cleanup := func() {}
+	if in.path == "-" {
+		tmp, err := ioutil.TempFile("", "rainforest-tabular")
+		if err != nil {
+			return cleanup, err
+		}
+		cleanup = func() { os.Remove(tmp.Name()) }
+		_, err = io.Copy(tmp, os.Stdin)
+		tmp.Close()
+		if err != nil {
+			cleanup()
+			return func() {}, err
+		}
+		in.path = tmp.Name()
+
+		if in.format == "" {
+			in.format, err = sniffTabularFormat(in.path)
+			if err != nil {
+				cleanup()
+				return func() {}, err
+			}
+		}
+	}
+
+	if err := in.validate(); err != nil {
+		cleanup()
+		return func() {}, err
+	}
+	return cleanup, nil
+}
+
+// open opens the input for reading, with the mapping applied to all records
+func (in *tabularInput) open() (tabularReader, error) {
+	source, err := openTabularSource(in.path, in.format)
+	if err != nil || in.mapping == nil {
+		return source, err
+	}
+	return newMappedTabularReader(source, in.mapping), nil
+}
+
+// validate reads through the whole input and checks that the header has unique, non-empty
+// column names, that all rows have as many columns as the header and that the mapping
+// can be applied.
+func (in *tabularInput) validate() error {
+	source, err := openTabularSource(in.path, in.format)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	header, err := source.Read()
+	if err == io.EOF {
+		return fmt.Errorf("%v is empty", in.path)
+	} else if err != nil {
+		return fmt.Errorf("%v: %v", in.path, err)
+	}
+
+	var problems []string
+	columnNames := parseColumnNames(header)
+	seen := make(map[string]int)
+	for i, colName := range columnNames {
+		if colName == "" {
+			problems = append(problems, fmt.Sprintf("column %v has an empty header", i+1))
+		} else if prev, ok := seen[colName]; ok {
+			problems = append(problems, fmt.Sprintf("columns %v and %v are both named %v", prev+1, i+1, colName))
+		} else {
+			seen[colName] = i
+		}
+	}
+
+	if in.mapping != nil && len(problems) == 0 {
+		if _, _, err = in.mapping.apply(columnNames); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// the header is the first row
+	rowNum := 1
+	for {
+		record, err := source.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			problems = append(problems, fmt.Sprintf("row %v: %v", rowNum+1, err))
+			break
+		}
+		rowNum++
+		if len(record) != len(header) {
+			problems = append(problems, fmt.Sprintf("row %v has %v columns, expected %v", rowNum, len(record), len(header)))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > maxTabularValidationErrors {
+		more := len(problems) - maxTabularValidationErrors
+		problems = append(problems[:maxTabularValidationErrors], fmt.Sprintf("... and %v more", more))
+	}
+	return fmt.Errorf("%v is invalid:\n%v", in.path, strings.Join(problems, "\n"))
+}
+
+// tabularMapping describes how columns of a data file map to columns of a tabular variable.
+// Column names are compared the way they are stored, lowercased and with spaces replaced by
+// underscores.
+type tabularMapping struct {
+	// Rename maps column names in the file to column names of the variable
+	Rename map[string]string `yaml:"rename"`
+	// Drop lists columns which are left out
+	Drop []string `yaml:"drop"`
+	// Order lists columns which come first, in that order. The rest of the columns follow
+	// in the order of the file.
+	Order []string `yaml:"order"`
+	// Required lists columns which have to be present after renaming and dropping
+	Required []string `yaml:"required"`
+}
+
+// loadTabularMapping reads a mapping file. The file is YAML, so JSON works as well.
+func loadTabularMapping(mappingPath string) (*tabularMapping, error) {
+	content, err := ioutil.ReadFile(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping tabularMapping
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err = dec.Decode(&mapping); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%v: %v", mappingPath, err)
+	}
+	return &mapping, nil
+}
+
+// apply maps the header of a file. It returns the resulting column names and for each
+// of them the index of the column in the file.
+func (m *tabularMapping) apply(header []string) ([]string, []int, error) {
+	normalize := func(name string) string {
+		return parseColumnNames([]string{name})[0]
+	}
+
+	headerIdx := make(map[string]int)
+	for i, colName := range header {
+		headerIdx[normalize(colName)] = i
+	}
+
+	var problems []string
+	dropped := make(map[int]bool)
+	for _, colName := range m.Drop {
+		idx, ok := headerIdx[normalize(colName)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("mapping drops column %v which doesn't exist", colName))
+			continue
+		}
+		dropped[idx] = true
+	}
+
+	renamed := make(map[int]string)
+	for from, to := range m.Rename {
+		idx, ok := headerIdx[normalize(from)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("mapping renames column %v which doesn't exist", from))
+			continue
+		}
+		renamed[idx] = normalize(to)
+	}
+
+	var columns []string
+	var indexes []int
+	mappedIdx := make(map[string]int)
+	for i, colName := range header {
+		if dropped[i] {
+			continue
+		}
+		name := normalize(colName)
+		if newName, ok := renamed[i]; ok {
+			name = newName
+		}
+		if _, ok := mappedIdx[name]; ok {
+			problems = append(problems, fmt.Sprintf("mapping results in more than one column named %v", name))
+			continue
+		}
+		mappedIdx[name] = len(columns)
+		columns = append(columns, name)
+		indexes = append(indexes, i)
+	}
+
+	for _, colName := range m.Required {
+		if _, ok := mappedIdx[normalize(colName)]; !ok {
+			problems = append(problems, fmt.Sprintf("required column %v is missing", colName))
+		}
+	}
+
+	// move ordered columns to the front
+	var orderedColumns []string
+	var orderedIndexes []int
+	ordered := make(map[string]bool)
+	for _, colName := range m.Order {
+		name := normalize(colName)
+		idx, ok := mappedIdx[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("mapping orders column %v which doesn't exist", colName))
+			continue
+		}
+		if ordered[name] {
+			continue
+		}
+		ordered[name] = true
+		orderedColumns = append(orderedColumns, name)
+		orderedIndexes = append(orderedIndexes, indexes[idx])
+	}
+	for i, name := range columns {
+		if !ordered[name] {
+			orderedColumns = append(orderedColumns, name)
+			orderedIndexes = append(orderedIndexes, indexes[i])
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return orderedColumns, orderedIndexes, nil
+}
+
+// mappedTabularReader applies a mapping to records of another reader
+type mappedTabularReader struct {
+	tabularReader
+	mapping *tabularMapping
+	indexes []int
+	started bool
+}
+
+func newMappedTabularReader(source tabularReader, mapping *tabularMapping) *mappedTabularReader {
+	return &mappedTabularReader{tabularReader: source, mapping: mapping}
+}
+
+// Read returns the next record with the mapping applied
+func (r *mappedTabularReader) Read() ([]string, error) {
+	record, err := r.tabularReader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.started {
+		r.started = true
+		var header []string
+		header, r.indexes, err = r.mapping.apply(record)
+		return header, err
+	}
+
+	mapped := make([]string, len(r.indexes))
+	for i, idx := range r.indexes {
+		if idx < len(record) {
+			mapped[i] = record[idx]
+		}
+	}
+	return mapped, nil
+}
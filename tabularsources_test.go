@@ -0,0 +1,449 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+)
+
+func writeTabularTestFile(t *testing.T, dir, name string, content []byte) string {
+	filePath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// createTestXLSX builds a minimal workbook with a header and two rows. The second row
+// skips a cell and uses an inline string.
+func createTestXLSX(t *testing.T) []byte {
+	files := map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId3"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/data.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Login</t></si><si><t>Password</t></si><si><t>Admin</t></si><si><r><t>al</t></r><r><t>ice</t></r></si>
+</sst>`,
+		"xl/worksheets/data.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>
+<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2"><v>1234</v></c><c r="C2" t="b"><v>1</v></c></row>
+<row r="3"/>
+<row r="4"><c r="A4" t="inlineStr"><is><t>bob</t></is></c></row>
+</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenTabularSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := [][]string{{"login", "password", "admin"}, {"alice", "1234", "true"}, {"bob", "", ""}}
+	expectedXLSX := [][]string{{"Login", "Password", "Admin"}, {"alice", "1234", "true"}, {"bob", "", ""}}
+
+	var testCases = []struct {
+		name     string
+		content  []byte
+		format   string
+		expected [][]string
+	}{
+		{
+			name:     "data.csv",
+			content:  []byte("login,password,admin\nalice,1234,true\nbob,,\n"),
+			expected: expected,
+		},
+		{
+			name:     "data.json",
+			content:  []byte(`[{"login": "alice", "password": 1234, "admin": true}, {"login": "bob", "password": null}]`),
+			expected: expected,
+		},
+		{
+			name:     "data.json",
+			content:  []byte(`[["login", "password", "admin"], ["alice", 1234, true], ["bob", "", ""]]`),
+			expected: expected,
+		},
+		{
+			name:     "data.jsonl",
+			content:  []byte("{\"login\": \"alice\", \"password\": \"1234\", \"admin\": \"true\"}\n{\"admin\": \"\", \"login\": \"bob\"}\n"),
+			expected: expected,
+		},
+		{
+			name:     "data.txt",
+			content:  []byte("{\"login\": \"alice\", \"password\": \"1234\", \"admin\": \"true\"}\n{\"login\": \"bob\"}\n"),
+			format:   tabularFormatJSONL,
+			expected: expected,
+		},
+		{
+			name:     "data.xlsx",
+			content:  createTestXLSX(t),
+			expected: expectedXLSX,
+		},
+	}
+
+	for _, testCase := range testCases {
+		filePath := writeTabularTestFile(t, dir, testCase.name, testCase.content)
+		source, err := openTabularSource(filePath, testCase.format)
+		if err != nil {
+			t.Errorf("Unexpected error opening %v: %v", testCase.name, err)
+			continue
+		}
+
+		records, err := readAllTabular(source)
+		source.Close()
+		if err != nil {
+			t.Errorf("Unexpected error reading %v: %v", testCase.name, err)
+		}
+		if !reflect.DeepEqual(records, testCase.expected) {
+			t.Errorf("Incorrect records read from %v. Got %v, expected: %v", testCase.name, records, testCase.expected)
+		}
+	}
+}
+
+func TestOpenTabularSource_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown_key.json",
+			content: `[{"login": "alice"}, {"login": "bob", "email": "bob@example.com"}]`,
+			wantErr: `element 2 has key "email"`,
+		},
+		{
+			name:    "nested.jsonl",
+			content: `{"login": {"name": "alice"}}`,
+			wantErr: "nested value",
+		},
+		{
+			name:    "scalar.json",
+			content: `["login", "password"]`,
+			wantErr: "must be an object or an array",
+		},
+		{
+			name:    "not_zip.xlsx",
+			content: "login,password",
+			wantErr: "invalid XLSX file",
+		},
+	}
+
+	for _, testCase := range testCases {
+		filePath := writeTabularTestFile(t, dir, testCase.name, []byte(testCase.content))
+		source, err := openTabularSource(filePath, "")
+		if err == nil {
+			_, err = readAllTabular(source)
+			source.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+			t.Errorf("Expected error containing %q for %v, got %v", testCase.wantErr, testCase.name, err)
+		}
+	}
+
+	_, err = openTabularSource(filepath.Join(dir, "data.csv"), "yaml")
+	if err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestReadTabularBatch(t *testing.T) {
+	source := newJSONTabularReader(ioutil.NopCloser(strings.NewReader(`["a"] ["b"] ["c"]`)), false)
+
+	batch, err := readTabularBatch(source, 2)
+	if err != nil || !reflect.DeepEqual(batch, [][]string{{"a"}, {"b"}}) {
+		t.Errorf("Incorrect first batch %v, error: %v", batch, err)
+	}
+	batch, err = readTabularBatch(source, 2)
+	if err != io.EOF || !reflect.DeepEqual(batch, [][]string{{"c"}}) {
+		t.Errorf("Incorrect last batch %v, error: %v", batch, err)
+	}
+}
+
+func TestUploadTabularVar_Streaming(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tabularBatchSize = 2
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+
+	var batches [][][]string
+	var deleted []int
+	f := fakeAPI{
+		createTabularVar: func(name, description string,
+			columns []string, singleUse bool) (*rainforest.Generator, error) {
+			if expected := []string{"login", "password"}; !reflect.DeepEqual(columns, expected) {
+				t.Errorf("Incorrect columns. Got %v, expected: %v", columns, expected)
+			}
+			return &rainforest.Generator{ID: 123}, nil
+		},
+		addGeneratorRowsFromTable: func(targetGenerator *rainforest.Generator,
+			targetColumns []string, rowData [][]string) error {
+			batches = append(batches, rowData)
+			return nil
+		},
+		deleteGenerator: func(genID int) error {
+			deleted = append(deleted, genID)
+			return nil
+		},
+	}
+
+	filePath := writeTabularTestFile(t, dir, "data.jsonl", []byte(
+		"{\"login\":\"a\",\"password\":\"1\"}\n{\"login\":\"b\",\"password\":\"2\"}\n{\"login\":\"c\",\"password\":\"3\"}\n"))
+	err = uploadTabularVar(f, tabularInput{path: filePath}, "testVar", false, false)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err.Error())
+	}
+	expected := [][][]string{{{"a", "1"}, {"b", "2"}}, {{"c", "3"}}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("Incorrect batches uploaded. Got %v, expected: %v", batches, expected)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("No tabular variables should be deleted, deleted: %v", deleted)
+	}
+
+	// Upload errors are returned
+	f.addGeneratorRowsFromTable = func(targetGenerator *rainforest.Generator,
+		targetColumns []string, rowData [][]string) error {
+		return errors.New("upload failed")
+	}
+	err = uploadTabularVar(f, tabularInput{path: filePath}, "testVar", false, false)
+	if err == nil || err.Error() != "upload failed" {
+		t.Errorf("Expected upload error, got %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("No tabular variables should be deleted, deleted: %v", deleted)
+	}
+}
+
+func TestTabularInputValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var testCases = []struct {
+		content  string
+		wantErrs []string
+	}{
+		{
+			content: "login,password\nfoo,bar\n",
+		},
+		{
+			content:  "",
+			wantErrs: []string{"is empty"},
+		},
+		{
+			content:  "Login,password,login \nfoo,bar,baz\n",
+			wantErrs: []string{"columns 1 and 3 are both named login"},
+		},
+		{
+			content:  "login,,password\nfoo,bar,baz\n",
+			wantErrs: []string{"column 2 has an empty header"},
+		},
+		{
+			content:  "login,password\nfoo,bar\nbaz\nqux,quux,corge\n",
+			wantErrs: []string{"row 3 has 1 columns, expected 2", "row 4 has 3 columns, expected 2"},
+		},
+		{
+			content:  "login\n" + strings.Repeat("a,b\n", 12),
+			wantErrs: []string{"row 11 has 2 columns", "... and 2 more"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		filePath := writeTabularTestFile(t, dir, "data.csv", []byte(testCase.content))
+		input := tabularInput{path: filePath}
+		err := input.validate()
+		if len(testCase.wantErrs) == 0 {
+			if err != nil {
+				t.Errorf("Unexpected error for %q: %v", testCase.content, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Expected an error for %q", testCase.content)
+			continue
+		}
+		for _, wantErr := range testCase.wantErrs {
+			if !strings.Contains(err.Error(), wantErr) {
+				t.Errorf("Expected error for %q to contain %q, got %v", testCase.content, wantErr, err)
+			}
+		}
+	}
+
+	// Nothing is uploaded when the file is invalid
+	filePath := writeTabularTestFile(t, dir, "empty.csv", []byte(""))
+	f := fakeAPI{
+		createTabularVar: func(name, description string,
+			columns []string, singleUse bool) (*rainforest.Generator, error) {
+			t.Error("Tabular variable shouldn't be created from an invalid file")
+			return &rainforest.Generator{}, nil
+		},
+	}
+	err = uploadTabularVar(f, tabularInput{path: filePath}, "testVar", false, false)
+	if err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("Expected an error for an empty file, got %v", err)
+	}
+}
+
+func TestTabularMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mappingPath := writeTabularTestFile(t, dir, "mapping.yml", []byte(`
+rename:
+  E-mail: email
+  Pass word: password
+drop:
+  - notes
+order:
+  - password
+required:
+  - email
+  - password
+`))
+	mapping, err := loadTabularMapping(mappingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := writeTabularTestFile(t, dir, "data.csv", []byte(
+		"Name,E-mail,Notes,Pass word\nalice,alice@example.com,vip,secret\nbob,bob@example.com,,hunter2\n"))
+	input := tabularInput{path: filePath, mapping: mapping}
+	if err = input.validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	source, err := input.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readAllTabular(source)
+	source.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"password", "name", "email"},
+		{"secret", "alice", "alice@example.com"},
+		{"hunter2", "bob", "bob@example.com"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Incorrect mapped records. Got %v, expected: %v", records, expected)
+	}
+
+	// Mapping problems are reported during validation
+	filePath = writeTabularTestFile(t, dir, "other.csv", []byte("name,password\nalice,secret\n"))
+	input = tabularInput{path: filePath, mapping: mapping}
+	err = input.validate()
+	if err == nil {
+		t.Fatal("Expected a validation error")
+	}
+	for _, wantErr := range []string{
+		"mapping drops column notes which doesn't exist",
+		"mapping renames column E-mail which doesn't exist",
+		"required column email is missing",
+	} {
+		if !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Expected error to contain %q, got %v", wantErr, err)
+		}
+	}
+
+	// Renaming two columns to the same name is an error
+	_, _, err = (&tabularMapping{Rename: map[string]string{"a": "c", "b": "c"}}).apply([]string{"a", "b"})
+	if err == nil || !strings.Contains(err.Error(), "more than one column named c") {
+		t.Errorf("Expected duplicate column error, got %v", err)
+	}
+
+	// Unknown keys in the mapping file are an error
+	mappingPath = writeTabularTestFile(t, dir, "typo.yml", []byte("renames:\n  a: b\n"))
+	if _, err = loadTabularMapping(mappingPath); err == nil {
+		t.Error("Expected an error for an unknown mapping key")
+	}
+}
+
+func TestTabularInputPrepare_Stdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tabular-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		data   string
+		format string
+	}{
+		{`[{"login":"a","password":"1"}]`, tabularFormatJSON},
+		{"\n{\"login\":\"a\",\"password\":\"1\"}\n{\"login\":\"b\",\"password\":\"2\"}\n", tabularFormatJSONL},
+		{"login,password\na,1\n", tabularFormatCSV},
+	}
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	for _, testCase := range testCases {
+		f, err := os.Open(writeTabularTestFile(t, dir, "stdin", []byte(testCase.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdin = f
+
+		in := tabularInput{path: "-"}
+		cleanup, err := in.prepare()
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", testCase.data, err)
+		} else if in.format != testCase.format {
+			t.Errorf("Detected format %v for %q, expected %v", in.format, testCase.data, testCase.format)
+		}
+		cleanup()
+		f.Close()
+	}
+}
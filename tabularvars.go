@@ -1,8 +1,11 @@
 package main
 
 import (
-	"math"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"sync"
 
 	"encoding/csv"
 
@@ -20,101 +23,219 @@ import (
 type tabularVariablesAPI interface {
 	GetGenerators(params ...string) ([]rainforest.Generator, error)
 	DeleteGenerator(genID int) error
+	RenameGenerator(genID int, name string) error
+	UpdateGeneratorDescription(genID int, description string) error
 	CreateTabularVar(name, description string,
 		columns []string, singleUse bool) (*rainforest.Generator, error)
 	AddGeneratorRowsFromTable(targetGenerator *rainforest.Generator,
 		targetColumns []string, rowData [][]string) error
+	GetGeneratorRows(genID int) ([]rainforest.GeneratorRow, error)
+	AddGeneratorRows(targetGenerator *rainforest.Generator, rowData []map[int]string) error
+	UpdateGeneratorRow(targetGenerator *rainforest.Generator, rowID int, values map[int]string) error
+	DeleteGeneratorRow(targetGenerator *rainforest.Generator, rowID int) error
 }
 
-// uploadTabularVar takes a path to csv file and creates tabular variable generator from it.
-func uploadTabularVar(api tabularVariablesAPI, pathToCSV, name string, overwrite, singleUse bool) error {
-	// Open up the CSV file and parse it, return early with an error if we fail to get to the file
-	f, err := os.Open(pathToCSV)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// tabularUploadSuffix is added to the name of a tabular variable while it's uploaded to replace
+// an existing one
+const tabularUploadSuffix = "_uploading"
+
+// Modes of updating an existing tabular variable in place
+const (
+	// tabularAppend adds all rows from the CSV file to the existing ones
+	tabularAppend = "append"
+	// tabularReplace replaces all existing rows with the ones from the CSV file
+	tabularReplace = "replace"
+	// tabularUpsert updates existing rows matched by a key column and adds the rest
+	tabularUpsert = "upsert"
+	// tabularSync works like tabularUpsert but also removes existing rows which weren't matched
+	tabularSync = "sync"
+)
 
-	r := csv.NewReader(f)
-	records, err := r.ReadAll()
+// uploadTabularVar takes a tabular data file and creates tabular variable generator from it.
+// The whole file is validated first, then rows are read and uploaded in batches, so large
+// files are never held in memory.
+func uploadTabularVar(api tabularVariablesAPI, input tabularInput, name string, overwrite, singleUse bool) error {
+	// Validate the file, return early with an error if we fail to get to the file
+	cleanup, err := input.prepare()
 	if err != nil {
 		return err
 	}
+	defer cleanup()
 
 	// Check if the variable exists in RF
-	var existingGenID int
-	var description string
+	var existing *rainforest.Generator
 	generators, err := api.GetGenerators("generator_type=tabular", "name="+name)
 	if err != nil {
 		return err
 	}
 
-	for _, gen := range generators {
+	for i, gen := range generators {
 		if gen.Name == name {
-			existingGenID = gen.ID
-			description = gen.Description
+			existing = &generators[i]
 		}
 	}
 
-	if existingGenID != 0 {
+	if existing != nil {
 		if overwrite {
-			// if variable exists and we want to override it with new one delete it here
 			log.Printf("Tabular var %v exists, overwriting it with new data.\n", name)
-			err = api.DeleteGenerator(existingGenID)
-			if err != nil {
-				return err
+			return replaceTabularVar(api, input, existing, name, existing.Description, singleUse)
+		}
+		// if variable exists but we didn't specify to override it then return with error
+		return errors.New("Tabular variable: " + name +
+			" already exists, use different name or choose an option to override it")
+	}
+
+	_, err = createTabularVarFromFile(api, input, name, "Uploaded via the CLI", singleUse)
+	return err
+}
+
+// replaceTabularVar uploads a tabular data file as a new tabular variable under a temporary
+// name, deletes the existing variable once all rows are uploaded and then gives the new one
+// the name of the existing one, as names of tabular variables are unique. If the upload
+// fails the new variable is deleted instead and the existing one is kept.
+func replaceTabularVar(api tabularVariablesAPI, input tabularInput, existing *rainforest.Generator,
+	name, description string, singleUse bool) error {
+	tempName := name + tabularUploadSuffix
+	newGenerator, err := createTabularVarFromFile(api, input, tempName, description, singleUse)
+	if err != nil {
+		if newGenerator != nil {
+			if deleteErr := api.DeleteGenerator(newGenerator.ID); deleteErr != nil {
+				log.Printf("Couldn't delete the incomplete new tabular variable %v: %v\n", tempName, deleteErr)
 			}
-		} else {
-			// if variable exists but we didn't specify to override it then return with error
-			return errors.New("Tabular variable: " + name +
-				" already exists, use different name or choose an option to override it")
 		}
-	} else {
-		description = "Uploaded via the CLI"
+		return fmt.Errorf("Upload of tabular variable %v failed, the existing variable was kept: %w", name, err)
 	}
 
-	// prepare input data
-	columnNames, rows := records[0], records[1:]
-	parsedColumnNames := make([]string, len(columnNames))
-	for i, colName := range columnNames {
-		formattedColName := strings.TrimSpace(strings.ToLower(colName))
-		parsedColName := strings.Replace(formattedColName, " ", "_", -1)
-		parsedColumnNames[i] = parsedColName
+	if err = api.DeleteGenerator(existing.ID); err != nil {
+		if deleteErr := api.DeleteGenerator(newGenerator.ID); deleteErr != nil {
+			log.Printf("Couldn't delete the new tabular variable %v: %v\n", tempName, deleteErr)
+		}
+		return fmt.Errorf("Tabular variable %v couldn't be deleted, the existing variable was kept: %w", name, err)
+	}
+
+	if err = api.RenameGenerator(newGenerator.ID, name); err != nil {
+		return fmt.Errorf("Tabular variable %v was replaced but the new one couldn't be renamed from %v: %w",
+			name, tempName, err)
+	}
+	return nil
+}
+
+// createTabularVarFromFile creates new tabular variable generator from a tabular data file, which
+// should already be validated. Rows are read and uploaded in batches. The new generator is
+// returned even if uploading its rows fails.
+func createTabularVarFromFile(api tabularVariablesAPI, input tabularInput, name, description string,
+	singleUse bool) (*rainforest.Generator, error) {
+	source, err := input.open()
+	if err != nil {
+		return nil, err
 	}
+	defer source.Close()
+
+	columnNames, err := source.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare input data
+	parsedColumnNames := parseColumnNames(columnNames)
 
 	// create new generator for the tabular variable
 	newGenerator, err := api.CreateTabularVar(name, description, parsedColumnNames, singleUse)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// batch the rows and put them into a channel
-	numOfBatches := int(math.Ceil(float64(len(rows)) / float64(tabularBatchSize)))
-	rowsToUpload := make(chan [][]string, numOfBatches)
-	for i := 0; i < len(rows); i += tabularBatchSize {
-		batch := rows[i:min(i+tabularBatchSize, len(rows))]
-		rowsToUpload <- batch
-	}
-	close(rowsToUpload)
+	log.Println("Beginning batch upload of tabular data...")
 
-	// chan to gather errors from workers
-	errors := make(chan error, numOfBatches)
+	return newGenerator, uploadTabularRows(api, newGenerator, parsedColumnNames, source, name)
+}
 
-	log.Println("Beginning batch upload of csv file...")
+// uploadTabularRows reads rows from source in batches and uploads them using
+// tabularConcurrency workers while the following batches are being read.
+func uploadTabularRows(api tabularVariablesAPI, generator *rainforest.Generator,
+	columns []string, source tabularReader, name string) error {
+	rowsToUpload := make(chan [][]string, tabularConcurrency)
+	readErrors := make(chan error, 1)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	readerDone := make(chan struct{})
+
+	// read batches of rows and put them into a channel
+	go func() {
+		defer close(readerDone)
+		defer close(rowsToUpload)
+		for {
+			batch, err := readTabularBatch(source, tabularBatchSize)
+			if len(batch) > 0 {
+				select {
+				case rowsToUpload <- batch:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErrors <- err
+				}
+				return
+			}
+		}
+	}()
+
+	// chan to gather errors from workers
+	errors := make(chan error, tabularConcurrency)
 
 	// spawn workers to upload the rows
+	var wg sync.WaitGroup
 	for i := 0; i < tabularConcurrency; i++ {
-		go rowUploadWorker(api, newGenerator, parsedColumnNames, rowsToUpload, errors)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rowUploadWorker(api, generator, columns, rowsToUpload, errors, stop)
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(errors)
+	}()
 
-	for i := 0; i < numOfBatches; i++ {
-		if err := <-errors; err != nil {
-			return err
+	// wait for all workers, stop reading more rows after the first error
+	var firstErr error
+	batchNum := 0
+	for err := range errors {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+				stopOnce.Do(func() { close(stop) })
+			}
+			continue
 		}
-		log.Printf("Tabular variable '%v' batch %v of %v uploaded.", name, i+1, numOfBatches)
+		batchNum++
+		log.Printf("Tabular variable '%v' batch %v uploaded.", name, batchNum)
+	}
+	// the caller closes source once we return, so the reader has to be done with it
+	<-readerDone
+	if firstErr != nil {
+		return firstErr
 	}
 
-	return nil
+	select {
+	case err := <-readErrors:
+		return err
+	default:
+		return nil
+	}
+}
+
+// parseColumnNames formats CSV header names the way they are stored as generator columns
+func parseColumnNames(columnNames []string) []string {
+	parsedColumnNames := make([]string, len(columnNames))
+	for i, colName := range columnNames {
+		formattedColName := strings.TrimSpace(strings.ToLower(colName))
+		parsedColName := strings.Replace(formattedColName, " ", "_", -1)
+		parsedColumnNames[i] = parsedColName
+	}
+	return parsedColumnNames
 }
 
 // Well... yeah...
@@ -126,16 +247,281 @@ func min(a, b int) int {
 }
 
 // rowUploadWorker is a helper worker which reads batch of rows to upload from rows chan
-// and pushes potential errors through errorsChan
+// and pushes potential errors through errorsChan. It stops after its first error or once
+// stop is closed, without uploading the batches which are still queued.
 func rowUploadWorker(api tabularVariablesAPI, generator *rainforest.Generator,
-	columns []string, rowsChan <-chan [][]string, errorsChan chan<- error) {
+	columns []string, rowsChan <-chan [][]string, errorsChan chan<- error, stop <-chan struct{}) {
 	for rows := range rowsChan {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
 		error := api.AddGeneratorRowsFromTable(generator, columns, rows)
 		errorsChan <- error
+		if error != nil {
+			return
+		}
 	}
 }
 
-// csvUpload is a wrapper around uploadTabularVar to function with csv-upload cli command
+// updateTabularVar takes a tabular data file and updates rows of an existing tabular variable
+// in place, keeping its ID and settings. mode is one of tabularAppend, tabularReplace, tabularUpsert
+// or tabularSync, keyColumn is used to match rows in tabularUpsert and tabularSync modes. If the variable doesn't
+// exist yet it's created. Rows are read and applied in batches, if any change fails, the rows
+// are restored to their original state.
+func updateTabularVar(api tabularVariablesAPI, input tabularInput, name, mode, keyColumn string, singleUse bool) error {
+	matchByKey := mode == tabularUpsert || mode == tabularSync
+	if mode != tabularAppend && mode != tabularReplace && !matchByKey {
+		return fmt.Errorf("Invalid update mode %v, use one of: %v, %v, %v, %v",
+			mode, tabularAppend, tabularReplace, tabularUpsert, tabularSync)
+	}
+
+	generator, err := findTabularVar(api, name)
+	if err != nil {
+		return err
+	}
+	if generator == nil {
+		log.Printf("Tabular var %v doesn't exist, creating it.\n", name)
+		return uploadTabularVar(api, input, name, false, singleUse)
+	}
+
+	cleanup, err := input.prepare()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	source, err := input.open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	header, err := source.Read()
+	if err != nil {
+		return err
+	}
+	columnNames := parseColumnNames(header)
+
+	// the file has to have exactly the columns of the existing variable
+	colNameToID := make(map[string]int)
+	for _, column := range generator.Columns {
+		colNameToID[column.Name] = column.ID
+	}
+	columnIDs := make([]int, len(columnNames))
+	for i, colName := range columnNames {
+		id, ok := colNameToID[colName]
+		if !ok {
+			return fmt.Errorf("Column %v doesn't exist in tabular variable %v", colName, name)
+		}
+		columnIDs[i] = id
+	}
+	if len(columnNames) != len(generator.Columns) {
+		return fmt.Errorf("%v has %v columns, tabular variable %v has %v", input.path, len(columnNames), name, len(generator.Columns))
+	}
+
+	keyIdx := -1
+	if matchByKey {
+		if keyColumn == "" {
+			keyColumn = columnNames[0]
+		} else {
+			keyColumn = parseColumnNames([]string{keyColumn})[0]
+		}
+		for i, colName := range columnNames {
+			if colName == keyColumn {
+				keyIdx = i
+			}
+		}
+		if keyIdx < 0 {
+			return fmt.Errorf("Key column %v not found in %v", keyColumn, input.path)
+		}
+	}
+
+	// take a snapshot of existing rows, both to plan the changes and to roll them back
+	snapshot, err := api.GetGeneratorRows(generator.ID)
+	if err != nil {
+		return err
+	}
+
+	// rows with duplicate keys are matched in order
+	existingByKey := make(map[string][]rainforest.GeneratorRow)
+	matched := make(map[int]bool)
+	if matchByKey {
+		for _, row := range snapshot {
+			key := row.Values[columnIDs[keyIdx]]
+			existingByKey[key] = append(existingByKey[key], row)
+		}
+	}
+
+	var added, updated, deleted int
+	applyBatch := func(rows [][]string) error {
+		var rowsToAdd [][]string
+		var rowsToUpdate []rainforest.GeneratorRow
+
+		if matchByKey {
+			for _, row := range rows {
+				if len(row) != len(columnIDs) {
+					return fmt.Errorf("Invalid number of columns in row %v of %v", row, input.path)
+				}
+				key := row[keyIdx]
+				matches := existingByKey[key]
+				if len(matches) == 0 {
+					rowsToAdd = append(rowsToAdd, row)
+					continue
+				}
+				existingByKey[key] = matches[1:]
+				matched[matches[0].ID] = true
+
+				values := make(map[int]string)
+				changed := false
+				for i, colID := range columnIDs {
+					values[colID] = row[i]
+					if matches[0].Values[colID] != row[i] {
+						changed = true
+					}
+				}
+				if changed {
+					rowsToUpdate = append(rowsToUpdate, rainforest.GeneratorRow{ID: matches[0].ID, Values: values})
+				}
+			}
+		} else {
+			rowsToAdd = rows
+		}
+
+		var jobs []func() error
+		if len(rowsToAdd) > 0 {
+			jobs = append(jobs, func() error {
+				return api.AddGeneratorRowsFromTable(generator, columnNames, rowsToAdd)
+			})
+		}
+		for _, row := range rowsToUpdate {
+			jobs = append(jobs, func() error {
+				return api.UpdateGeneratorRow(generator, row.ID, row.Values)
+			})
+		}
+		added += len(rowsToAdd)
+		updated += len(rowsToUpdate)
+		return runTabularJobs(jobs)
+	}
+
+	for {
+		batch, readErr := readTabularBatch(source, tabularBatchSize)
+		if readErr != nil && readErr != io.EOF {
+			err = readErr
+			break
+		}
+		if err = applyBatch(batch); err != nil || readErr == io.EOF {
+			break
+		}
+	}
+
+	// only delete rows once everything else succeeded, new rows are added before
+	// the old ones are deleted so that the variable is never empty
+	if err == nil && (mode == tabularReplace || mode == tabularSync) {
+		var jobs []func() error
+		for _, row := range snapshot {
+			if mode == tabularSync && matched[row.ID] {
+				continue
+			}
+			jobs = append(jobs, func() error {
+				return api.DeleteGeneratorRow(generator, row.ID)
+			})
+		}
+		deleted = len(jobs)
+		err = runTabularJobs(jobs)
+	}
+
+	if err != nil {
+		log.Printf("Updating tabular variable %v failed, rolling back changes.\n", name)
+		if rollbackErr := rollbackTabularVar(api, generator, snapshot); rollbackErr != nil {
+			return fmt.Errorf("Updating tabular variable %v failed: %w. Rolling back failed as well: %w", name, err, rollbackErr)
+		}
+		return fmt.Errorf("Updating tabular variable %v failed: %w. All changes have been rolled back", name, err)
+	}
+
+	log.Printf("Tabular variable %v updated: %v rows added, %v updated, %v removed.\n",
+		name, added, updated, deleted)
+	return nil
+}
+
+// rollbackTabularVar restores rows of a tabular variable to the given snapshot. Rows which
+// have been deleted are added back, but get new IDs.
+func rollbackTabularVar(api tabularVariablesAPI, generator *rainforest.Generator,
+	snapshot []rainforest.GeneratorRow) error {
+	current, err := api.GetGeneratorRows(generator.ID)
+	if err != nil {
+		return err
+	}
+
+	snapshotByID := make(map[int]rainforest.GeneratorRow)
+	for _, row := range snapshot {
+		snapshotByID[row.ID] = row
+	}
+
+	var jobs []func() error
+	remaining := make(map[int]bool)
+	for _, row := range current {
+		original, ok := snapshotByID[row.ID]
+		if !ok {
+			jobs = append(jobs, func() error {
+				return api.DeleteGeneratorRow(generator, row.ID)
+			})
+			continue
+		}
+		remaining[row.ID] = true
+		if !reflect.DeepEqual(original.Values, row.Values) {
+			jobs = append(jobs, func() error {
+				return api.UpdateGeneratorRow(generator, row.ID, original.Values)
+			})
+		}
+	}
+
+	var deletedRows []map[int]string
+	for _, row := range snapshot {
+		if !remaining[row.ID] {
+			deletedRows = append(deletedRows, row.Values)
+		}
+	}
+	for i := 0; i < len(deletedRows); i += tabularBatchSize {
+		batch := deletedRows[i:min(i+tabularBatchSize, len(deletedRows))]
+		jobs = append(jobs, func() error {
+			return api.AddGeneratorRows(generator, batch)
+		})
+	}
+
+	return runTabularJobs(jobs)
+}
+
+// runTabularJobs runs jobs using tabularConcurrency workers. It waits for all of the jobs
+// to finish and returns the first error encountered.
+func runTabularJobs(jobs []func() error) error {
+	jobsChan := make(chan func() error, len(jobs))
+	for _, job := range jobs {
+		jobsChan <- job
+	}
+	close(jobsChan)
+
+	errorsChan := make(chan error, len(jobs))
+	for i := 0; i < tabularConcurrency; i++ {
+		go func() {
+			for job := range jobsChan {
+				errorsChan <- job()
+			}
+		}()
+	}
+
+	var firstErr error
+	for range jobs {
+		if err := <-errorsChan; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// csvUpload is a wrapper around uploadTabularVar and updateTabularVar to function with csv-upload cli command
 func csvUpload(c cliContext, api tabularVariablesAPI) error {
 	// Get the csv file path either from the option or command argument
 	filePath := c.Args().First()
@@ -152,7 +538,16 @@ func csvUpload(c cliContext, api tabularVariablesAPI) error {
 	overwrite := c.Bool("overwrite-variable")
 	singleUse := c.Bool("single-use")
 
-	err := uploadTabularVar(api, filePath, name, overwrite, singleUse)
+	input, err := newTabularInput(filePath, c.String("format"), c.String("mapping"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if mode := c.String("update-mode"); mode != "" {
+		err = updateTabularVar(api, input, name, mode, c.String("key"), singleUse)
+	} else {
+		err = uploadTabularVar(api, input, name, overwrite, singleUse)
+	}
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
@@ -160,7 +555,7 @@ func csvUpload(c cliContext, api tabularVariablesAPI) error {
 	return nil
 }
 
-// preRunCSVUpload is a wrapper around uploadTabularVar to be ran before starting a new run
+// preRunCSVUpload is a wrapper around uploadTabularVar and updateTabularVar to be ran before starting a new run
 func preRunCSVUpload(c cliContext, api tabularVariablesAPI) error {
 	// Get the csv file path either and skip uploading if it's not present
 	filePath := c.String("import-variable-csv-file")
@@ -174,5 +569,319 @@ func preRunCSVUpload(c cliContext, api tabularVariablesAPI) error {
 	overwrite := c.Bool("overwrite-variable")
 	singleUse := c.Bool("single-use")
 
-	return uploadTabularVar(api, filePath, name, overwrite, singleUse)
+	input, err := newTabularInput(filePath, c.String("import-variable-format"), c.String("import-variable-mapping"))
+	if err != nil {
+		return err
+	}
+
+	if mode := c.String("import-variable-update-mode"); mode != "" {
+		return updateTabularVar(api, input, name, mode, c.String("import-variable-key"), singleUse)
+	}
+	return uploadTabularVar(api, input, name, overwrite, singleUse)
+}
+
+// newTabularInput creates a tabularInput, loading the mapping file if there is one
+func newTabularInput(filePath, format, mappingPath string) (tabularInput, error) {
+	input := tabularInput{path: filePath, format: format}
+	if mappingPath != "" {
+		mapping, err := loadTabularMapping(mappingPath)
+		if err != nil {
+			return input, err
+		}
+		input.mapping = mapping
+	}
+	return input, nil
+}
+
+// findTabularVar returns the tabular variable with the given name or nil if it doesn't exist
+func findTabularVar(api tabularVariablesAPI, name string) (*rainforest.Generator, error) {
+	generators, err := api.GetGenerators("generator_type=tabular", "name="+name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gen := range generators {
+		if gen.Name == name {
+			return &gen, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// downloadTabularVar fetches column names and rows of the named tabular variable
+func downloadTabularVar(api tabularVariablesAPI, name string) ([]string, [][]string, error) {
+	generator, err := findTabularVar(api, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if generator == nil {
+		return nil, nil, fmt.Errorf("Tabular variable %v not found", name)
+	}
+
+	return generatorTable(api, generator)
+}
+
+// generatorTable fetches rows of the generator and returns them along with column names,
+// with values in the order of the columns
+func generatorTable(api tabularVariablesAPI, generator *rainforest.Generator) ([]string, [][]string, error) {
+	genRows, err := api.GetGeneratorRows(generator.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make([]string, len(generator.Columns))
+	for i, column := range generator.Columns {
+		columns[i] = column.Name
+	}
+
+	rows := make([][]string, len(genRows))
+	for i, genRow := range genRows {
+		row := make([]string, len(generator.Columns))
+		for j, column := range generator.Columns {
+			row[j] = genRow.Values[column.ID]
+		}
+		rows[i] = row
+	}
+
+	return columns, rows, nil
+}
+
+// csvDownload writes the contents of a tabular variable as CSV, to be used with
+// csv-download cli command
+func csvDownload(c cliContext, api tabularVariablesAPI) error {
+	name := c.Args().First()
+	if name == "" {
+		return cli.NewExitError("Tabular variable name not specified", 1)
+	}
+
+	columns, rows, err := downloadTabularVar(api, name)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var out io.Writer = os.Stdout
+	var f *os.File
+	if outputPath := c.String("output"); outputPath != "" {
+		f, err = os.Create(outputPath)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	w.Write(columns)
+	w.WriteAll(rows)
+	err = w.Error()
+	if f != nil {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.String("output") != "" {
+		log.Printf("Tabular variable %v with %v rows written to %v", name, len(rows), c.String("output"))
+	}
+
+	return nil
+}
+
+// tabularRowChange is a row which exists in both the tabular variable and the CSV file
+// but with different values
+type tabularRowChange struct {
+	key      string
+	old, new []string
+}
+
+// tabularDiff describes the changes uploading a CSV file would make to a tabular variable.
+// Rows are expressed in terms of columns, which is the union of remote and local columns.
+type tabularDiff struct {
+	keyColumn      string
+	columns        []string
+	addedColumns   []string
+	removedColumns []string
+	added          [][]string
+	removed        [][]string
+	changed        []tabularRowChange
+}
+
+// diffTabularRows compares remote tabular variable rows against local ones. Rows are
+// matched by the value of keyColumn, rows with duplicate keys are matched in order.
+func diffTabularRows(remoteColumns []string, remoteRows [][]string,
+	localColumns []string, localRows [][]string, keyColumn string) (*tabularDiff, error) {
+	diff := &tabularDiff{keyColumn: keyColumn}
+
+	remoteIndex := make(map[string]int)
+	for i, col := range remoteColumns {
+		remoteIndex[col] = i
+		diff.columns = append(diff.columns, col)
+	}
+	localIndex := make(map[string]int)
+	for i, col := range localColumns {
+		localIndex[col] = i
+		if _, ok := remoteIndex[col]; !ok {
+			diff.addedColumns = append(diff.addedColumns, col)
+			diff.columns = append(diff.columns, col)
+		}
+	}
+	for _, col := range remoteColumns {
+		if _, ok := localIndex[col]; !ok {
+			diff.removedColumns = append(diff.removedColumns, col)
+		}
+	}
+
+	if _, ok := remoteIndex[keyColumn]; !ok {
+		return nil, fmt.Errorf("Key column %v not found in tabular variable", keyColumn)
+	}
+	if _, ok := localIndex[keyColumn]; !ok {
+		return nil, fmt.Errorf("Key column %v not found in CSV file", keyColumn)
+	}
+
+	// project rows onto the combined columns so they can be compared
+	project := func(row []string, index map[string]int) []string {
+		projected := make([]string, len(diff.columns))
+		for i, col := range diff.columns {
+			if j, ok := index[col]; ok && j < len(row) {
+				projected[i] = row[j]
+			}
+		}
+		return projected
+	}
+	keyIdx := remoteIndex[keyColumn]
+
+	remoteByKey := make(map[string][][]string)
+	for _, row := range remoteRows {
+		projected := project(row, remoteIndex)
+		key := projected[keyIdx]
+		remoteByKey[key] = append(remoteByKey[key], projected)
+	}
+
+	for _, row := range localRows {
+		projected := project(row, localIndex)
+		key := projected[keyIdx]
+		matches := remoteByKey[key]
+		if len(matches) == 0 {
+			diff.added = append(diff.added, projected)
+			continue
+		}
+		remoteByKey[key] = matches[1:]
+		if !reflect.DeepEqual(matches[0], projected) {
+			diff.changed = append(diff.changed, tabularRowChange{key: key, old: matches[0], new: projected})
+		}
+	}
+
+	// whatever is left unmatched, in the original order, has been removed
+	for _, row := range remoteRows {
+		key := project(row, remoteIndex)[keyIdx]
+		if matches := remoteByKey[key]; len(matches) > 0 {
+			diff.removed = append(diff.removed, matches[0])
+			remoteByKey[key] = matches[1:]
+		}
+	}
+
+	return diff, nil
+}
+
+// empty returns true if there are no differences
+func (d *tabularDiff) empty() bool {
+	return len(d.addedColumns) == 0 && len(d.removedColumns) == 0 &&
+		len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+// print writes a human readable version of the diff
+func (d *tabularDiff) print(out io.Writer) {
+	if len(d.addedColumns) > 0 {
+		fmt.Fprintf(out, "+ columns: %v\n", strings.Join(d.addedColumns, ", "))
+	}
+	if len(d.removedColumns) > 0 {
+		fmt.Fprintf(out, "- columns: %v\n", strings.Join(d.removedColumns, ", "))
+	}
+	for _, row := range d.added {
+		printDiffRow(out, "+ ", row)
+	}
+	for _, row := range d.removed {
+		printDiffRow(out, "- ", row)
+	}
+	for _, change := range d.changed {
+		var changes []string
+		for i, col := range d.columns {
+			if change.old[i] != change.new[i] {
+				changes = append(changes, fmt.Sprintf("%v %q -> %q", col, change.old[i], change.new[i]))
+			}
+		}
+		fmt.Fprintf(out, "~ %v=%v: %v\n", d.keyColumn, change.key, strings.Join(changes, ", "))
+	}
+	fmt.Fprintf(out, "%v added, %v removed, %v changed\n", len(d.added), len(d.removed), len(d.changed))
+}
+
+// printDiffRow prints a row as a CSV record after the prefix, quoting the values if needed
+func printDiffRow(out io.Writer, prefix string, row []string) {
+	io.WriteString(out, prefix)
+	w := csv.NewWriter(out)
+	w.Write(row)
+	w.Flush()
+}
+
+// csvDiff shows the differences between a tabular variable and a data file, to be used
+// with csv-diff cli command
+func csvDiff(c cliContext, api tabularVariablesAPI) error {
+	name := c.Args().Get(0)
+	filePath := c.Args().Get(1)
+	if name == "" {
+		return cli.NewExitError("Tabular variable name not specified", 1)
+	}
+	if filePath == "" {
+		return cli.NewExitError("CSV filename not specified", 1)
+	}
+
+	input, err := newTabularInput(filePath, c.String("format"), c.String("mapping"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	cleanup, err := input.prepare()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer cleanup()
+
+	source, err := input.open()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer source.Close()
+
+	records, err := readAllTabular(source)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	localColumns, localRows := parseColumnNames(records[0]), records[1:]
+
+	remoteColumns, remoteRows, err := downloadTabularVar(api, name)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	keyColumn := c.String("key")
+	if keyColumn == "" {
+		keyColumn = localColumns[0]
+	} else {
+		keyColumn = parseColumnNames([]string{keyColumn})[0]
+	}
+
+	diff, err := diffTabularRows(remoteColumns, remoteRows, localColumns, localRows, keyColumn)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if diff.empty() {
+		log.Printf("Tabular variable %v is up to date with %v", name, filePath)
+		return nil
+	}
+	diff.print(os.Stdout)
+
+	return nil
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"testing"
@@ -10,6 +13,8 @@ import (
 	"log"
 
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rainforestapp/rainforest-cli/rainforest"
 	"github.com/urfave/cli"
@@ -59,6 +64,12 @@ type fakeAPI struct {
 		columns []string, singleUse bool) (*rainforest.Generator, error)
 	addGeneratorRowsFromTable func(targetGenerator *rainforest.Generator,
 		targetColumns []string, rowData [][]string) error
+	getGeneratorRows           func(genID int) ([]rainforest.GeneratorRow, error)
+	addGeneratorRows           func(targetGenerator *rainforest.Generator, rowData []map[int]string) error
+	updateGeneratorRow         func(targetGenerator *rainforest.Generator, rowID int, values map[int]string) error
+	deleteGeneratorRow         func(targetGenerator *rainforest.Generator, rowID int) error
+	updateGeneratorDescription func(genID int, description string) error
+	renameGenerator            func(genID int, name string) error
 }
 
 func (f fakeAPI) GetGenerators(params ...string) ([]rainforest.Generator, error) {
@@ -91,6 +102,48 @@ func (f fakeAPI) AddGeneratorRowsFromTable(targetGenerator *rainforest.Generator
 	return nil
 }
 
+func (f fakeAPI) GetGeneratorRows(genID int) ([]rainforest.GeneratorRow, error) {
+	if f.getGeneratorRows != nil {
+		return f.getGeneratorRows(genID)
+	}
+	return nil, nil
+}
+
+func (f fakeAPI) AddGeneratorRows(targetGenerator *rainforest.Generator, rowData []map[int]string) error {
+	if f.addGeneratorRows != nil {
+		return f.addGeneratorRows(targetGenerator, rowData)
+	}
+	return nil
+}
+
+func (f fakeAPI) UpdateGeneratorRow(targetGenerator *rainforest.Generator, rowID int, values map[int]string) error {
+	if f.updateGeneratorRow != nil {
+		return f.updateGeneratorRow(targetGenerator, rowID, values)
+	}
+	return nil
+}
+
+func (f fakeAPI) DeleteGeneratorRow(targetGenerator *rainforest.Generator, rowID int) error {
+	if f.deleteGeneratorRow != nil {
+		return f.deleteGeneratorRow(targetGenerator, rowID)
+	}
+	return nil
+}
+
+func (f fakeAPI) RenameGenerator(genID int, name string) error {
+	if f.renameGenerator != nil {
+		return f.renameGenerator(genID, name)
+	}
+	return nil
+}
+
+func (f fakeAPI) UpdateGeneratorDescription(genID int, description string) error {
+	if f.updateGeneratorDescription != nil {
+		return f.updateGeneratorDescription(genID, description)
+	}
+	return nil
+}
+
 func TestRowUploadWorker(t *testing.T) {
 	const testBatchesCount = 2
 	gen := &rainforest.Generator{ID: 123}
@@ -122,7 +175,7 @@ func TestRowUploadWorker(t *testing.T) {
 			return nil
 		},
 	}
-	rowUploadWorker(f, gen, cols, inChan, errorsChan)
+	rowUploadWorker(f, gen, cols, inChan, errorsChan, nil)
 	if callCount != testBatchesCount {
 		t.Errorf("Api called wrong number of times. Called: %v, expected: %v", callCount, testBatchesCount)
 	}
@@ -136,6 +189,144 @@ func TestRowUploadWorker(t *testing.T) {
 	}
 }
 
+// slowTabularReader delays reads and records reads made after it was closed
+type slowTabularReader struct {
+	tabularReader
+	closed         bool
+	readAfterClose bool
+}
+
+func (r *slowTabularReader) Read() ([]string, error) {
+	time.Sleep(time.Millisecond)
+	if r.closed {
+		r.readAfterClose = true
+	}
+	return r.tabularReader.Read()
+}
+
+func (r *slowTabularReader) Close() error {
+	r.closed = true
+	return r.tabularReader.Close()
+}
+
+func TestUploadTabularRows_StopsAfterError(t *testing.T) {
+	oldBatchSize := tabularBatchSize
+	tabularBatchSize = 1
+	defer func() { tabularBatchSize = oldBatchSize }()
+
+	var data strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&data, "%v,value\n", i)
+	}
+	source := &slowTabularReader{tabularReader: csvTabularReader{csv.NewReader(strings.NewReader(data.String())), ioutil.NopCloser(nil)}}
+
+	var mu sync.Mutex
+	calls := 0
+	f := fakeAPI{
+		addGeneratorRowsFromTable: func(targetGenerator *rainforest.Generator,
+			targetColumns []string, rowData [][]string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return errors.New("network error")
+		},
+	}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stdout)
+
+	err := uploadTabularRows(f, &rainforest.Generator{ID: 1}, []string{"id", "value"}, source, "testVar")
+	source.Close()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if source.readAfterClose {
+		t.Error("Expected the source not to be read after the upload returned")
+	}
+	if calls > tabularConcurrency {
+		t.Errorf("Expected the queued batches not to be uploaded after the error, got %v uploads", calls)
+	}
+}
+
+func TestUploadTabularVar_Overwrite_FailedUpload(t *testing.T) {
+	createValidFakeCSV(t)
+	defer deleteFakeCSV(t)
+	tabularBatchSize = 2
+
+	var deleted []int
+	f := fakeAPI{
+		getGenerators: func(params ...string) ([]rainforest.Generator, error) {
+			return []rainforest.Generator{{ID: 42, Name: "testVar", Description: "Old"}}, nil
+		},
+		createTabularVar: func(name, description string, columns []string, singleUse bool) (*rainforest.Generator, error) {
+			if name != "testVar"+tabularUploadSuffix {
+				t.Errorf("Expected the new variable to be uploaded under a temporary name, got %v", name)
+			}
+			return &rainforest.Generator{ID: 99, Name: name, Description: description}, nil
+		},
+		addGeneratorRowsFromTable: func(targetGenerator *rainforest.Generator,
+			targetColumns []string, rowData [][]string) error {
+			return errors.New("network error")
+		},
+		deleteGenerator: func(genID int) error {
+			deleted = append(deleted, genID)
+			return nil
+		},
+	}
+
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stdout)
+
+	err := uploadTabularVar(f, tabularInput{path: fakeCSVPath}, "testVar", true, false)
+	if err == nil || !strings.Contains(err.Error(), "existing variable was kept") {
+		t.Errorf("Expected the failed upload to be reported, got %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []int{99}) {
+		t.Errorf("Expected only the incomplete new variable to be deleted, got %v", deleted)
+	}
+
+	// The existing variable is only deleted once the new one is complete
+	deleted = nil
+	f.addGeneratorRowsFromTable = func(targetGenerator *rainforest.Generator, targetColumns []string, rowData [][]string) error {
+		if len(deleted) > 0 {
+			t.Error("The existing variable was deleted before the upload finished")
+		}
+		return nil
+	}
+	var renamed []string
+	f.renameGenerator = func(genID int, name string) error {
+		renamed = append(renamed, fmt.Sprintf("%v %v", genID, name))
+		return nil
+	}
+	if err = uploadTabularVar(f, tabularInput{path: fakeCSVPath}, "testVar", true, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []int{42}) {
+		t.Errorf("Expected the existing variable to be deleted, got %v", deleted)
+	}
+	if !reflect.DeepEqual(renamed, []string{"99 testVar"}) {
+		t.Errorf("Expected the new variable to take the name of the existing one, got %v", renamed)
+	}
+
+	// The new variable is deleted if the existing one can't be
+	deleted = nil
+	renamed = nil
+	f.deleteGenerator = func(genID int) error {
+		deleted = append(deleted, genID)
+		if genID == 42 {
+			return errors.New("network error")
+		}
+		return nil
+	}
+	err = uploadTabularVar(f, tabularInput{path: fakeCSVPath}, "testVar", true, false)
+	if err == nil || !strings.Contains(err.Error(), "existing variable was kept") {
+		t.Errorf("Expected the failed delete to be reported, got %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []int{42, 99}) || len(renamed) != 0 {
+		t.Errorf("Expected the new variable to be deleted, got deletes %v and renames %v", deleted, renamed)
+	}
+}
+
 func TestRowUploadWorker_Error(t *testing.T) {
 	const testBatchesCount = 2
 	gen := &rainforest.Generator{ID: 123}
@@ -167,9 +358,10 @@ func TestRowUploadWorker_Error(t *testing.T) {
 			return errors.New("PICNIC!!1")
 		},
 	}
-	rowUploadWorker(f, gen, cols, inChan, errorsChan)
-	if callCount != testBatchesCount {
-		t.Errorf("Api called wrong number of times. Called: %v, expected: %v", callCount, testBatchesCount)
+	rowUploadWorker(f, gen, cols, inChan, errorsChan, nil)
+	// The queued batches aren't uploaded after an error
+	if callCount != 1 {
+		t.Errorf("Api called wrong number of times. Called: %v, expected: %v", callCount, 1)
 	}
 	err := <-errorsChan
 	if err == nil {
@@ -285,7 +477,7 @@ func TestUploadTabularVar(t *testing.T) {
 	log.SetOutput(&outBuffer)
 	defer log.SetOutput(os.Stdout)
 
-	err := uploadTabularVar(f, fakeCSVPath, variableName, variableOverwrite, variableSingleUse)
+	err := uploadTabularVar(f, tabularInput{path: fakeCSVPath}, variableName, variableOverwrite, variableSingleUse)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err.Error())
 	}
@@ -394,7 +586,7 @@ func TestUploadTabularVar_Exists_NoOverwrite(t *testing.T) {
 			return &fakeNewGen, nil
 		},
 	}
-	err := uploadTabularVar(f, fakeCSVPath, variableName, variableOverwrite, variableSingleUse)
+	err := uploadTabularVar(f, tabularInput{path: fakeCSVPath}, variableName, variableOverwrite, variableSingleUse)
 	if err == nil {
 		t.Errorf("Expected error, got nil")
 	}
@@ -487,8 +679,8 @@ func TestUploadTabularVar_Exists_Overwrite(t *testing.T) {
 		},
 		createTabularVar: func(name, description string, columns []string,
 			singleUse bool) (*rainforest.Generator, error) {
-			if variableName != name {
-				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, variableName)
+			if expected := variableName + tabularUploadSuffix; expected != name {
+				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, expected)
 			}
 			if variableDescription != description {
 				t.Errorf("Incorrect value of description passed to newTabVar. Got: %v, expected: %v", description, variableDescription)
@@ -502,6 +694,13 @@ func TestUploadTabularVar_Exists_Overwrite(t *testing.T) {
 			callCount["createTabularVar"] = callCount["createTabularVar"] + 1
 			return &fakeNewGen, nil
 		},
+		renameGenerator: func(genID int, name string) error {
+			if genID != fakeNewGen.ID || name != variableName {
+				t.Errorf("Incorrect rename of generator %v to %v", genID, name)
+			}
+			callCount["renameGenerator"] = callCount["renameGenerator"] + 1
+			return nil
+		},
 	}
 
 	// Capture output
@@ -509,7 +708,7 @@ func TestUploadTabularVar_Exists_Overwrite(t *testing.T) {
 	log.SetOutput(&outBuffer)
 	defer log.SetOutput(os.Stdout)
 
-	err := uploadTabularVar(f, fakeCSVPath, variableName, variableOverwrite, variableSingleUse)
+	err := uploadTabularVar(f, tabularInput{path: fakeCSVPath}, variableName, variableOverwrite, variableSingleUse)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err.Error())
 	}
@@ -519,6 +718,9 @@ func TestUploadTabularVar_Exists_Overwrite(t *testing.T) {
 	if expected := 1; callCount["deleteGenerator"] != expected {
 		t.Errorf("api.deleteGenerator called invalid number of times: %v, expected %v", callCount["getGenerators"], expected)
 	}
+	if expected := 1; callCount["renameGenerator"] != expected {
+		t.Errorf("api.renameGenerator called invalid number of times: %v, expected %v", callCount["renameGenerator"], expected)
+	}
 	if expected := 1; callCount["createTabularVar"] != expected {
 		t.Errorf("api.createTabularVar called invalid number of times: %v, expected %v", callCount["getGenerators"], expected)
 	}
@@ -607,8 +809,8 @@ func TestCSVUpload(t *testing.T) {
 		},
 		createTabularVar: func(name, description string, columns []string,
 			singleUse bool) (*rainforest.Generator, error) {
-			if variableName != name {
-				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, variableName)
+			if expected := variableName + tabularUploadSuffix; expected != name {
+				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, expected)
 			}
 			if !reflect.DeepEqual(columns, cols) {
 				t.Errorf("Incorrect value of columns passed to newTabVar. Got: %v, expected: %v", columns, cols)
@@ -847,8 +1049,8 @@ func TestPreRunCSVUpload(t *testing.T) {
 		},
 		createTabularVar: func(name, description string, columns []string,
 			singleUse bool) (*rainforest.Generator, error) {
-			if variableName != name {
-				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, variableName)
+			if expected := variableName + tabularUploadSuffix; expected != name {
+				t.Errorf("Incorrect value of name passed to newTabVar. Got: %v, expected: %v", name, expected)
 			}
 			if !reflect.DeepEqual(columns, cols) {
 				t.Errorf("Incorrect value of columns passed to newTabVar. Got: %v, expected: %v", columns, cols)
@@ -1014,3 +1216,438 @@ func TestPreRunCSVUpload_MissingName(t *testing.T) {
 		t.Errorf("api.createTabularVar called invalid number of times: %v, expected %v", callCount["getGenerators"], expected)
 	}
 }
+
+func newFakeTabularVarAPI(t *testing.T) fakeAPI {
+	return fakeAPI{
+		getGenerators: func(params ...string) ([]rainforest.Generator, error) {
+			return []rainforest.Generator{
+				{
+					ID:   42,
+					Name: "Kappa",
+				},
+				{
+					ID:   123,
+					Name: "testVar",
+					Columns: []rainforest.GeneratorColumn{
+						{ID: 456, Name: "test"},
+						{ID: 789, Name: "columns"},
+					},
+				},
+			}, nil
+		},
+		getGeneratorRows: func(genID int) ([]rainforest.GeneratorRow, error) {
+			if genID != 123 {
+				t.Errorf("Incorrect generator ID passed to GetGeneratorRows. Got %v, expected: %v", genID, 123)
+			}
+			return []rainforest.GeneratorRow{
+				{ID: 1, Values: map[int]string{456: "foo", 789: "bar"}},
+				{ID: 2, Values: map[int]string{456: "baz", 789: "old"}},
+				{ID: 3, Values: map[int]string{456: "gone", 789: "row"}},
+				{ID: 4, Values: map[int]string{456: "qwe"}},
+			}, nil
+		},
+	}
+}
+
+func TestCSVDownload(t *testing.T) {
+	f := newFakeTabularVarAPI(t)
+	defer os.Remove(fakeCSVPath)
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+
+	fakeContext := newFakeContext(map[string]interface{}{
+		"output": fakeCSVPath,
+	}, cli.Args{"testVar"})
+
+	err := csvDownload(fakeContext, f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+
+	content, err := ioutil.ReadFile(fakeCSVPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "test,columns\nfoo,bar\nbaz,old\ngone,row\nqwe,\n"
+	if string(content) != expected {
+		t.Errorf("Incorrect CSV written. Got %q, expected: %q", content, expected)
+	}
+
+	// Unknown variables are an error
+	fakeContext = newFakeContext(map[string]interface{}{}, cli.Args{"missing"})
+	err = csvDownload(fakeContext, f)
+	if err == nil {
+		t.Error("Expected an error for a missing tabular variable")
+	}
+}
+
+func TestDiffTabularRows(t *testing.T) {
+	remoteColumns := []string{"login", "password"}
+	remoteRows := [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"dup", "x"}, {"dup", "y"}}
+	localColumns := []string{"login", "password"}
+	localRows := [][]string{{"b", "2"}, {"a", "changed"}, {"d", "4"}, {"dup", "x"}}
+
+	diff, err := diffTabularRows(remoteColumns, remoteRows, localColumns, localRows, "login")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+
+	if expected := [][]string{{"d", "4"}}; !reflect.DeepEqual(diff.added, expected) {
+		t.Errorf("Incorrect added rows. Got %v, expected: %v", diff.added, expected)
+	}
+	if expected := [][]string{{"c", "3"}, {"dup", "y"}}; !reflect.DeepEqual(diff.removed, expected) {
+		t.Errorf("Incorrect removed rows. Got %v, expected: %v", diff.removed, expected)
+	}
+	expectedChanges := []tabularRowChange{{key: "a", old: []string{"a", "1"}, new: []string{"a", "changed"}}}
+	if !reflect.DeepEqual(diff.changed, expectedChanges) {
+		t.Errorf("Incorrect changed rows. Got %v, expected: %v", diff.changed, expectedChanges)
+	}
+
+	// Column changes are reported and rows are compared on all columns
+	diff, err = diffTabularRows(remoteColumns, [][]string{{"a", "1"}},
+		[]string{"email", "login"}, [][]string{{"a@example.com", "a"}}, "login")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+	if !reflect.DeepEqual(diff.addedColumns, []string{"email"}) || !reflect.DeepEqual(diff.removedColumns, []string{"password"}) {
+		t.Errorf("Incorrect column changes. Got added %v and removed %v", diff.addedColumns, diff.removedColumns)
+	}
+	if len(diff.changed) != 1 {
+		t.Errorf("Expected one changed row, got %v", diff.changed)
+	}
+
+	// Key column must exist on both sides
+	_, err = diffTabularRows(remoteColumns, remoteRows, []string{"email"}, nil, "email")
+	if err == nil {
+		t.Error("Expected an error for a missing key column")
+	}
+}
+
+func TestTabularDiffPrint(t *testing.T) {
+	diff, err := diffTabularRows([]string{"login", "password"}, [][]string{{"a", "1"}, {"c", "3"}},
+		[]string{"login", "password"}, [][]string{{"a", "2"}, {"b", "2"}}, "login")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+
+	var out bytes.Buffer
+	diff.print(&out)
+	expected := "+ b,2\n- c,3\n~ login=a: password \"1\" -> \"2\"\n1 added, 1 removed, 1 changed\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect diff output. Got %q, expected: %q", out.String(), expected)
+	}
+
+	// Values are quoted like in a CSV file
+	diff, err = diffTabularRows([]string{"login", "name"}, nil,
+		[]string{"login", "name"}, [][]string{{"a", "Doe, \"Jane\""}}, "login")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+	out.Reset()
+	diff.print(&out)
+	if expected := "+ a,\"Doe, \"\"Jane\"\"\"\n"; !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("Incorrect diff output. Got %q, expected it to start with: %q", out.String(), expected)
+	}
+}
+
+func TestCSVDiff_MissingArgs(t *testing.T) {
+	f := newFakeTabularVarAPI(t)
+
+	fakeContext := newFakeContext(map[string]interface{}{}, cli.Args{"testVar"})
+	err := csvDiff(fakeContext, f)
+	if err == nil {
+		t.Error("Expected an error when the CSV file isn't specified")
+	}
+}
+
+// fakeTabularAccount keeps tabular variables of an account in memory
+type fakeTabularAccount struct {
+	mu         sync.Mutex
+	generators []rainforest.Generator
+	rows       map[int][]rainforest.GeneratorRow
+	nextID     int
+	calls      []string
+	// failAdd makes adding rows fail once that many batches have been added
+	failAdd int
+	adds    int
+}
+
+func newFakeTabularAccount() *fakeTabularAccount {
+	return &fakeTabularAccount{rows: make(map[int][]rainforest.GeneratorRow), nextID: 1, failAdd: -1}
+}
+
+// addVariable adds a variable with the given columns and rows
+func (a *fakeTabularAccount) addVariable(name string, singleUse bool, columns []string, rows ...[]string) {
+	gen, _ := a.CreateTabularVar(name, "", columns, singleUse)
+	a.AddGeneratorRowsFromTable(gen, columns, rows)
+	a.calls = nil
+	a.adds = 0
+}
+
+// table returns rows of the named variable
+func (a *fakeTabularAccount) table(name string) [][]string {
+	for _, gen := range a.generators {
+		if gen.Name == name {
+			_, rows, _ := generatorTable(a, &gen)
+			return rows
+		}
+	}
+	return nil
+}
+
+func (a *fakeTabularAccount) GetGenerators(params ...string) ([]rainforest.Generator, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	generators := make([]rainforest.Generator, len(a.generators))
+	copy(generators, a.generators)
+	for i := range generators {
+		generators[i].RowCount = len(a.rows[generators[i].ID])
+	}
+	return generators, nil
+}
+
+func (a *fakeTabularAccount) DeleteGenerator(genID int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, gen := range a.generators {
+		if gen.ID == genID {
+			a.calls = append(a.calls, "delete "+gen.Name)
+			a.generators = append(a.generators[:i], a.generators[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("generator not found")
+}
+
+func (a *fakeTabularAccount) CreateTabularVar(name, description string,
+	columns []string, singleUse bool) (*rainforest.Generator, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, gen := range a.generators {
+		if gen.Name == name {
+			return nil, errors.New("name has already been taken")
+		}
+	}
+	gen := rainforest.Generator{ID: a.nextID, Name: name, Description: description, SingleUse: singleUse}
+	a.nextID++
+	for _, col := range columns {
+		gen.Columns = append(gen.Columns, rainforest.GeneratorColumn{ID: a.nextID, Name: col})
+		a.nextID++
+	}
+	a.generators = append(a.generators, gen)
+	a.calls = append(a.calls, "create "+name)
+	return &gen, nil
+}
+
+func (a *fakeTabularAccount) RenameGenerator(genID int, name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, gen := range a.generators {
+		if gen.Name == name {
+			return errors.New("name has already been taken")
+		}
+	}
+	for i, gen := range a.generators {
+		if gen.ID == genID {
+			a.calls = append(a.calls, "rename "+gen.Name+" to "+name)
+			a.generators[i].Name = name
+			return nil
+		}
+	}
+	return errors.New("generator not found")
+}
+
+func (a *fakeTabularAccount) UpdateGeneratorDescription(genID int, description string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, gen := range a.generators {
+		if gen.ID == genID {
+			a.calls = append(a.calls, "describe "+gen.Name)
+			a.generators[i].Description = description
+			return nil
+		}
+	}
+	return errors.New("generator not found")
+}
+
+func (a *fakeTabularAccount) AddGeneratorRowsFromTable(targetGenerator *rainforest.Generator,
+	targetColumns []string, rowData [][]string) error {
+	a.mu.Lock()
+	if a.adds == a.failAdd {
+		a.mu.Unlock()
+		return errors.New("batch failed")
+	}
+	a.adds++
+	a.mu.Unlock()
+	var formatted []map[int]string
+	for _, row := range rowData {
+		values := make(map[int]string)
+		for i, col := range targetColumns {
+			for _, genCol := range targetGenerator.Columns {
+				if genCol.Name == col {
+					values[genCol.ID] = row[i]
+				}
+			}
+		}
+		formatted = append(formatted, values)
+	}
+	return a.AddGeneratorRows(targetGenerator, formatted)
+}
+
+func (a *fakeTabularAccount) GetGeneratorRows(genID int) ([]rainforest.GeneratorRow, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rows := make([]rainforest.GeneratorRow, len(a.rows[genID]))
+	copy(rows, a.rows[genID])
+	return rows, nil
+}
+
+func (a *fakeTabularAccount) AddGeneratorRows(targetGenerator *rainforest.Generator, rowData []map[int]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, values := range rowData {
+		a.rows[targetGenerator.ID] = append(a.rows[targetGenerator.ID], rainforest.GeneratorRow{ID: a.nextID, Values: values})
+		a.nextID++
+	}
+	return nil
+}
+
+func (a *fakeTabularAccount) UpdateGeneratorRow(targetGenerator *rainforest.Generator, rowID int, values map[int]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rows := a.rows[targetGenerator.ID]
+	for i := range rows {
+		if rows[i].ID == rowID {
+			rows[i].Values = values
+			return nil
+		}
+	}
+	return errors.New("row not found")
+}
+
+func (a *fakeTabularAccount) DeleteGeneratorRow(targetGenerator *rainforest.Generator, rowID int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rows := a.rows[targetGenerator.ID]
+	for i := range rows {
+		if rows[i].ID == rowID {
+			a.rows[targetGenerator.ID] = append(rows[:i], rows[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("row not found")
+}
+
+func TestUpdateTabularVar(t *testing.T) {
+	createValidFakeCSV(t)
+	defer deleteFakeCSV(t)
+	tabularBatchSize = 2
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+
+	var testCases = []struct {
+		mode      string
+		keyColumn string
+		existing  [][]string
+		expected  [][]string
+	}{
+		{
+			mode:     tabularAppend,
+			existing: [][]string{{"old", "row"}},
+			expected: [][]string{{"old", "row"}, {"foo", "bar"}, {"baz", "wut"}, {"qwe", "asd"}, {"zxc", "jkl"}},
+		},
+		{
+			mode:     tabularReplace,
+			existing: [][]string{{"old", "row"}, {"foo", "bar"}},
+			expected: [][]string{{"foo", "bar"}, {"baz", "wut"}, {"qwe", "asd"}, {"zxc", "jkl"}},
+		},
+		{
+			mode:     tabularUpsert,
+			existing: [][]string{{"old", "row"}, {"baz", "old value"}, {"foo", "bar"}},
+			expected: [][]string{{"old", "row"}, {"baz", "wut"}, {"foo", "bar"}, {"qwe", "asd"}, {"zxc", "jkl"}},
+		},
+		{
+			mode:     tabularSync,
+			existing: [][]string{{"old", "row"}, {"baz", "old value"}, {"foo", "bar"}},
+			expected: [][]string{{"baz", "wut"}, {"foo", "bar"}, {"qwe", "asd"}, {"zxc", "jkl"}},
+		},
+		{
+			mode:      tabularUpsert,
+			keyColumn: "columns",
+			existing:  [][]string{{"old", "bar"}},
+			expected:  [][]string{{"foo", "bar"}, {"baz", "wut"}, {"qwe", "asd"}, {"zxc", "jkl"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		account := newFakeTabularAccount()
+		account.addVariable("testVar", false, []string{"test", "columns"}, testCase.existing...)
+		err := updateTabularVar(account, tabularInput{path: fakeCSVPath}, "testVar", testCase.mode, testCase.keyColumn, false)
+		if err != nil {
+			t.Errorf("Unexpected error in %v mode: %v", testCase.mode, err.Error())
+		}
+		if table := account.table("testVar"); !reflect.DeepEqual(table, testCase.expected) {
+			t.Errorf("Incorrect rows after %v update. Got %v, expected: %v", testCase.mode, table, testCase.expected)
+		}
+		if len(account.calls) != 0 {
+			t.Errorf("Tabular variable shouldn't be recreated in %v mode, got calls: %v", testCase.mode, account.calls)
+		}
+	}
+}
+
+func TestUpdateTabularVar_Rollback(t *testing.T) {
+	createValidFakeCSV(t)
+	defer deleteFakeCSV(t)
+	tabularBatchSize = 2
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+
+	existing := [][]string{{"baz", "old value"}, {"other", "row"}}
+	for _, mode := range []string{tabularAppend, tabularReplace, tabularUpsert, tabularSync} {
+		account := newFakeTabularAccount()
+		account.addVariable("testVar", false, []string{"test", "columns"}, existing...)
+		// first batch succeeds, second one fails
+		account.failAdd = 1
+		err := updateTabularVar(account, tabularInput{path: fakeCSVPath}, "testVar", mode, "", false)
+		if err == nil {
+			t.Errorf("Expected an error in %v mode", mode)
+		} else if !strings.Contains(err.Error(), "rolled back") {
+			t.Errorf("Expected rollback error in %v mode, got: %v", mode, err.Error())
+		}
+		if table := account.table("testVar"); !reflect.DeepEqual(table, existing) {
+			t.Errorf("Rows not rolled back in %v mode. Got %v, expected: %v", mode, table, existing)
+		}
+	}
+}
+
+func TestUpdateTabularVar_Invalid(t *testing.T) {
+	createValidFakeCSV(t)
+	defer deleteFakeCSV(t)
+
+	account := newFakeTabularAccount()
+	account.addVariable("testVar", false, []string{"test", "columns"})
+	err := updateTabularVar(account, tabularInput{path: fakeCSVPath}, "testVar", "merge", "", false)
+	if err == nil {
+		t.Error("Expected an error for an invalid update mode")
+	}
+
+	account = newFakeTabularAccount()
+	account.addVariable("testVar", false, []string{"test"})
+	err = updateTabularVar(account, tabularInput{path: fakeCSVPath}, "testVar", tabularAppend, "", false)
+	if err == nil {
+		t.Error("Expected an error for mismatched columns")
+	}
+
+	account = newFakeTabularAccount()
+	account.addVariable("testVar", false, []string{"test", "columns"})
+	err = updateTabularVar(account, tabularInput{path: fakeCSVPath}, "testVar", tabularUpsert, "missing", false)
+	if err == nil {
+		t.Error("Expected an error for a missing key column")
+	}
+}
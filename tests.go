@@ -141,18 +141,23 @@ func validateSingleRFMLFile(filePath string) error {
 	}
 	defer f.Close()
 	rfmlReader := rainforest.NewRFMLReader(f)
-	_, err = rfmlReader.ReadAll()
+	pTest, err := rfmlReader.ReadAll()
 	if err != nil {
 		return fileParseError{filePath, err}
 	}
+	pTest.RFMLPath = filePath
+	if fileErrors := rainforest.ValidateEmbeddedFiles(pTest); len(fileErrors) > 0 {
+		return fileErrors
+	}
 	log.Printf("%v's syntax is valid", filePath)
 	return nil
 }
 
 var errValidation = errors.New("Validation failed")
 
-// validateRFMLFiles validates RFML file syntax, embedded rfml ids, checks for
-// circular dependiences and all other cool things in the specified directory
+// validateRFMLFiles validates RFML file syntax, embedded rfml ids, embedded
+// files, checks for circular dependiences and all other cool things in the
+// specified directory
 func validateRFMLFiles(parsedTests []*rainforest.RFTest, localOnly bool, api rfAPI) error {
 	// parse all of them files
 	var validationErrors []error
@@ -208,6 +213,13 @@ func validateRFMLFiles(parsedTests []*rainforest.RFTest, localOnly bool, api rfA
 		}
 	}
 
+	// check that embedded files exist and can be uploaded
+	for _, pTest := range parsedTests {
+		for _, fileError := range rainforest.ValidateEmbeddedFiles(pTest) {
+			validationErrors = append(validationErrors, fileError)
+		}
+	}
+
 	// validate circular dependiences probably using Tarjan's strongly connected components
 	stronglyConnected := goraph.Tarjan(dependencyGraph)
 	for _, circularTests := range stronglyConnected {
@@ -628,8 +640,9 @@ func uploadRFMLFiles(tests []*rainforest.RFTest, branchID int, localOnly bool, a
 	}
 	testIDCollection = rainforest.NewTestIDCollection(testIDs)
 
-	// And here we update all of the tests
-	testsToUpdate := make(chan *rainforest.RFTest, len(parsedTests))
+	// Embedded files are uploaded for all of the tests at once, so that identical
+	// files are only uploaded once
+	var testsWithFiles []*rainforest.RFTest
 	for _, testToUpdate := range parsedTests {
 		testID, err := testIDCollection.GetTestID(testToUpdate.RFMLID)
 		if err != nil {
@@ -639,12 +652,20 @@ func uploadRFMLFiles(tests []*rainforest.RFTest, branchID int, localOnly bool, a
 		}
 
 		if testToUpdate.HasUploadableFiles() {
-			err = api.ParseEmbeddedFiles(testToUpdate)
-			if err != nil {
-				return err
-			}
+			testsWithFiles = append(testsWithFiles, testToUpdate)
 		}
+	}
 
+	if len(testsWithFiles) > 0 {
+		err = api.ParseEmbeddedFiles(testsWithFiles...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// And here we update all of the tests
+	testsToUpdate := make(chan *rainforest.RFTest, len(parsedTests))
+	for _, testToUpdate := range parsedTests {
 		err = testToUpdate.PrepareToUploadFromRFML(*testIDCollection)
 		if err != nil {
 			return err
@@ -680,9 +701,10 @@ type rfAPI interface {
 	GetTest(int) (*rainforest.RFTest, error)
 	CreateTest(*rainforest.RFTest) error
 	UpdateTest(*rainforest.RFTest, int) error
-	ParseEmbeddedFiles(*rainforest.RFTest) error
+	ParseEmbeddedFiles(...*rainforest.RFTest) error
 	ClientToken() string
 	CreateTestWithAI(*rainforest.AITestRequest) (*rainforest.AITestResponse, error)
+	DownloadEmbeddedFiles(*rainforest.RFTest, string) error
 	branchAPI
 }
 
@@ -771,7 +793,11 @@ func downloadTests(c cliContext, client rfAPI) error {
 		case err = <-errorsChan:
 			return cli.NewExitError(err.Error(), 1)
 		case test := <-testChan:
-			if err := downloadTestAsRFML(test, *testIDCollection, absTestDirectory, c.Bool("flatten-steps")); err != nil {
+			var files embeddedFilesAPI
+			if c.Bool("with-files") {
+				files = client
+			}
+			if err := downloadTestAsRFML(test, *testIDCollection, absTestDirectory, c.Bool("flatten-steps"), files); err != nil {
 				return cli.NewExitError(err.Error(), 1)
 			}
 		}
@@ -795,13 +821,26 @@ func downloadRFTestWorker(testInfoChan chan RFTestInfo, errorsChan chan error, t
 	Helper Functions
 */
 
-// downloadTestAsRFML downloads a test, prepares it as RFML, and writes it to a file
-func downloadTestAsRFML(test *rainforest.RFTest, testIDCollection rainforest.TestIDCollection, absTestDirectory string, flattenSteps bool) error {
+// embeddedFilesAPI is part of the API used to download files embedded in tests
+type embeddedFilesAPI interface {
+	DownloadEmbeddedFiles(*rainforest.RFTest, string) error
+}
+
+// downloadTestAsRFML downloads a test, prepares it as RFML, and writes it to a file.
+// If files is not nil, the files embedded in the test are downloaded next to it.
+func downloadTestAsRFML(test *rainforest.RFTest, testIDCollection rainforest.TestIDCollection, absTestDirectory string, flattenSteps bool, files embeddedFilesAPI) error {
 	err := test.PrepareToWriteAsRFML(testIDCollection, flattenSteps)
 	if err != nil {
 		return err
 	}
 
+	if files != nil {
+		err = files.DownloadEmbeddedFiles(test, absTestDirectory)
+		if err != nil {
+			return err
+		}
+	}
+
 	paddedTestID := fmt.Sprintf("%010d", test.TestID)
 	sanitizedTitle := sanitizeTestTitle(test.Title)
 	fileName := fmt.Sprintf("%v_%v.rfml", paddedTestID, sanitizedTitle)
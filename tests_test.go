@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -238,6 +239,8 @@ type testRfAPI struct {
 	handleCreateTest   func(*rainforest.RFTest)
 	handleUpdateTest   func(*rainforest.RFTest, int)
 	handleCreateTestAI func(*rainforest.AITestRequest) (*rainforest.AITestResponse, error)
+	// handleDownloadEmbeddedFiles is called instead of downloading embedded files
+	handleDownloadEmbeddedFiles func(*rainforest.RFTest, string) error
 	testBranchAPI
 }
 
@@ -272,11 +275,18 @@ func (t *testRfAPI) UpdateTest(test *rainforest.RFTest, branchID int) error {
 	return nil
 }
 
-func (t *testRfAPI) ParseEmbeddedFiles(_ *rainforest.RFTest) error {
+func (t *testRfAPI) ParseEmbeddedFiles(_ ...*rainforest.RFTest) error {
 	// implement when needed
 	return errStub
 }
 
+func (t *testRfAPI) DownloadEmbeddedFiles(test *rainforest.RFTest, dir string) error {
+	if t.handleDownloadEmbeddedFiles != nil {
+		return t.handleDownloadEmbeddedFiles(test, dir)
+	}
+	return nil
+}
+
 func (t *testRfAPI) CreateTestWithAI(request *rainforest.AITestRequest) (*rainforest.AITestResponse, error) {
 	if t.handleCreateTestAI != nil {
 		return t.handleCreateTestAI(request)
@@ -943,6 +953,41 @@ func TestDownloadTests(t *testing.T) {
 	if !strings.Contains(rfmlText, "# state: disabled") {
 		t.Errorf("Expected RFML test state to read disabled. Output: %v", rfmlText)
 	}
+
+	// Embedded files are only downloaded with --with-files
+	var downloadDirs []string
+	testAPI.handleDownloadEmbeddedFiles = func(test *rainforest.RFTest, dir string) error {
+		downloadDirs = append(downloadDirs, dir)
+		test.Description = "files downloaded"
+		return nil
+	}
+
+	err = downloadTests(context, testAPI)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(downloadDirs) != 0 {
+		t.Errorf("Expected no embedded files to be downloaded, got %v", downloadDirs)
+	}
+
+	context.mappings["with-files"] = true
+	err = downloadTests(context, testAPI)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	absTestDirectory, _ := filepath.Abs(testDefaultSpecFolder)
+	if !reflect.DeepEqual(downloadDirs, []string{absTestDirectory}) {
+		t.Errorf("Expected embedded files to be downloaded to %v, got %v", absTestDirectory, downloadDirs)
+	}
+
+	contents, err = ioutil.ReadFile(expectedRFMLPath)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !strings.Contains(string(contents), "# files downloaded") {
+		t.Errorf("Expected RFML test to be written after downloading embedded files. Output: %v", string(contents))
+	}
 }
 
 func TestSanitizeTestTitle(t *testing.T) {
@@ -1016,6 +1061,51 @@ func TestValidateEmbedded(t *testing.T) {
 	}
 }
 
+func TestValidateEmbeddedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "data.csv"), []byte("a,b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	test := rainforest.RFTest{
+		RFMLID:   "files",
+		RFMLPath: filepath.Join(dir, "files.rfml"),
+		Steps: []interface{}{
+			rainforest.RFTestStep{
+				Action:   "Download {{ file.download(./data.csv) }}",
+				Response: "Did it download?",
+			},
+		},
+	}
+
+	err = validateRFMLFiles([]*rainforest.RFTest{&test}, true, new(testRfAPI))
+	if err != nil {
+		t.Error("Validation with existing files failed:", err)
+	}
+
+	test.Steps = append(test.Steps, rainforest.RFTestStep{
+		Action:   "Download {{ file.download(./missing.csv) }}",
+		Response: "Did it download?",
+	})
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stdout)
+
+	err = validateRFMLFiles([]*rainforest.RFTest{&test}, true, new(testRfAPI))
+	if err != errValidation {
+		t.Error("Expected validation to fail for missing embedded file, got:", err)
+	}
+	want := fmt.Sprintf("%v: step 2 - embedded file ./missing.csv: no such file exists", test.RFMLPath)
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Expected output to contain %q, got %q", want, out.String())
+	}
+}
+
 func TestReadRFMLFiles(t *testing.T) {
 	dir := setupTestRFMLDir()
 	defer os.RemoveAll(dir)
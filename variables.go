@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rainforestapp/rainforest-cli/rainforest"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultVariablesManifest is where the variables manifest is looked for by default
+const defaultVariablesManifest = "rainforest/variables.yml"
+
+// variablesManifest lists tabular variables which are managed from the repository
+type variablesManifest struct {
+	Variables []variableDefinition `yaml:"variables"`
+}
+
+// variableDefinition describes a single tabular variable in the manifest. Paths are
+// relative to the manifest.
+type variableDefinition struct {
+	Name        string `yaml:"name"`
+	File        string `yaml:"file"`
+	Format      string `yaml:"format"`
+	Mapping     string `yaml:"mapping"`
+	Key         string `yaml:"key"`
+	Description string `yaml:"description"`
+	SingleUse   bool   `yaml:"single_use"`
+}
+
+// loadVariablesManifest reads and checks the manifest at manifestPath
+func loadVariablesManifest(manifestPath string) (*variablesManifest, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest variablesManifest
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err = dec.Decode(&manifest); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%v: %v", manifestPath, err)
+	}
+
+	var problems []string
+	manifestDir := filepath.Dir(manifestPath)
+	names := make(map[string]bool)
+	for i := range manifest.Variables {
+		def := &manifest.Variables[i]
+		if def.Name == "" {
+			problems = append(problems, fmt.Sprintf("variable %v has no name", i+1))
+		} else if names[def.Name] {
+			problems = append(problems, fmt.Sprintf("variable %v is listed more than once", def.Name))
+		}
+		names[def.Name] = true
+
+		if def.File == "" {
+			problems = append(problems, fmt.Sprintf("variable %v has no file", def.Name))
+		} else if !filepath.IsAbs(def.File) {
+			def.File = filepath.Join(manifestDir, def.File)
+		}
+		if def.Mapping != "" && !filepath.IsAbs(def.Mapping) {
+			def.Mapping = filepath.Join(manifestDir, def.Mapping)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%v is invalid:\n%v", manifestPath, strings.Join(problems, "\n"))
+	}
+	return &manifest, nil
+}
+
+// Actions which bring a tabular variable in line with the manifest
+const (
+	variableCreate    = "create"
+	variableUpdate    = "update"
+	variableRecreate  = "recreate"
+	variableDelete    = "delete"
+	variableUnchanged = "unchanged"
+)
+
+// variableChange is a planned change of a single tabular variable
+type variableChange struct {
+	action     string
+	name       string
+	definition *variableDefinition
+	input      tabularInput
+	generator  *rainforest.Generator
+	details    string
+	// rowsChanged and descriptionChanged tell what an update changes
+	rowsChanged        bool
+	descriptionChanged bool
+}
+
+// planVariables compares tabular variables in the account with the manifest and returns
+// the changes needed to make them match. If prune is set, variables which aren't in the
+// manifest are deleted.
+func planVariables(api tabularVariablesAPI, manifest *variablesManifest, prune bool) ([]variableChange, error) {
+	generators, err := api.GetGenerators("generator_type=tabular")
+	if err != nil {
+		return nil, err
+	}
+	generatorsByName := make(map[string]*rainforest.Generator)
+	for i := range generators {
+		generatorsByName[generators[i].Name] = &generators[i]
+	}
+
+	var changes []variableChange
+	for i := range manifest.Variables {
+		def := &manifest.Variables[i]
+		change, err := planVariable(api, def, generatorsByName[def.Name])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", def.Name, err)
+		}
+		changes = append(changes, change)
+	}
+
+	if prune {
+		for _, gen := range generators {
+			if manifestVariable(manifest, gen.Name) == nil {
+				changes = append(changes, variableChange{
+					action:    variableDelete,
+					name:      gen.Name,
+					generator: generatorsByName[gen.Name],
+					details:   "not in the manifest",
+				})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// planVariable plans the change of a single tabular variable. generator is nil if the
+// variable doesn't exist yet.
+func planVariable(api tabularVariablesAPI, def *variableDefinition, generator *rainforest.Generator) (variableChange, error) {
+	change := variableChange{name: def.Name, definition: def, generator: generator}
+
+	input, err := newTabularInput(def.File, def.Format, def.Mapping)
+	if err != nil {
+		return change, err
+	}
+	if err = input.validate(); err != nil {
+		return change, err
+	}
+	change.input = input
+
+	source, err := input.open()
+	if err != nil {
+		return change, err
+	}
+	defer source.Close()
+
+	records, err := readAllTabular(source)
+	if err != nil {
+		return change, err
+	}
+	localColumns, localRows := parseColumnNames(records[0]), records[1:]
+
+	keyColumn := def.Key
+	if keyColumn == "" {
+		keyColumn = localColumns[0]
+	} else {
+		keyColumn = parseColumnNames([]string{keyColumn})[0]
+		if !containsString(localColumns, keyColumn) {
+			return change, fmt.Errorf("Key column %v not found in %v", keyColumn, def.File)
+		}
+	}
+
+	if generator == nil {
+		change.action = variableCreate
+		change.details = fmt.Sprintf("%v rows", len(localRows))
+		return change, nil
+	}
+	if generator.SingleUse != def.SingleUse {
+		change.action = variableRecreate
+		change.details = fmt.Sprintf("single use changes to %v", def.SingleUse)
+		return change, nil
+	}
+
+	remoteColumns, remoteRows, err := generatorTable(api, generator)
+	if err != nil {
+		return change, err
+	}
+
+	if !sameColumns(remoteColumns, localColumns) {
+		change.action = variableRecreate
+		change.details = "columns change"
+		return change, nil
+	}
+
+	diff, err := diffTabularRows(remoteColumns, remoteRows, localColumns, localRows, keyColumn)
+	if err != nil {
+		return change, err
+	}
+
+	var details []string
+	if !diff.empty() {
+		change.rowsChanged = true
+		details = append(details, fmt.Sprintf("%v added, %v removed, %v changed", len(diff.added), len(diff.removed), len(diff.changed)))
+	}
+	if def.Description != "" && def.Description != generator.Description {
+		change.descriptionChanged = true
+		details = append(details, "description changes")
+	}
+
+	if len(details) == 0 {
+		change.action = variableUnchanged
+		return change, nil
+	}
+	change.action = variableUpdate
+	change.details = strings.Join(details, ", ")
+	return change, nil
+}
+
+// sameColumns returns true if both variables have the same columns, in any order
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, col := range a {
+		if !containsString(b, col) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString returns true if the value is in the slice
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestVariable returns the definition of the named variable, or nil if the manifest
+// is nil or doesn't list it
+func manifestVariable(manifest *variablesManifest, name string) *variableDefinition {
+	if manifest == nil {
+		return nil
+	}
+	for i := range manifest.Variables {
+		if manifest.Variables[i].Name == name {
+			return &manifest.Variables[i]
+		}
+	}
+	return nil
+}
+
+// printVariablesPlan prints the planned changes along with a summary
+func printVariablesPlan(changes []variableChange) {
+	counts := make(map[string]int)
+	rows := [][]string{}
+	for _, change := range changes {
+		counts[change.action]++
+		if change.action != variableUnchanged {
+			rows = append(rows, []string{change.action, change.name, change.details})
+		}
+	}
+
+	if len(rows) > 0 {
+		printResourceTable([]string{"Action", "Variable", "Details"}, rows)
+	}
+	log.Printf("Plan: %v to create, %v to update, %v to recreate, %v to delete, %v unchanged.",
+		counts[variableCreate], counts[variableUpdate], counts[variableRecreate],
+		counts[variableDelete], counts[variableUnchanged])
+}
+
+// applyVariableChange makes the planned change. Updates keep the variable's ID, but
+// changes of single use or columns can only be done by recreating the variable.
+func applyVariableChange(api tabularVariablesAPI, change variableChange) error {
+	switch change.action {
+	case variableCreate:
+		_, err := createTabularVarFromFile(api, change.input, change.name, variableDescription(change), change.definition.SingleUse)
+		return err
+	case variableRecreate:
+		return replaceTabularVar(api, change.input, change.generator, change.name, variableDescription(change), change.definition.SingleUse)
+	case variableUpdate:
+		if change.rowsChanged {
+			err := updateTabularVar(api, change.input, change.name, tabularSync, change.definition.Key, change.definition.SingleUse)
+			if err != nil {
+				return err
+			}
+		}
+		if change.descriptionChanged {
+			return api.UpdateGeneratorDescription(change.generator.ID, change.definition.Description)
+		}
+		return nil
+	case variableDelete:
+		return api.DeleteGenerator(change.generator.ID)
+	}
+	return nil
+}
+
+// variableDescription returns the description for a created variable
+func variableDescription(change variableChange) string {
+	if change.definition.Description != "" {
+		return change.definition.Description
+	}
+	if change.generator != nil && change.generator.Description != "" {
+		return change.generator.Description
+	}
+	return "Uploaded via the CLI"
+}
+
+// variablesApply makes tabular variables in the account match the manifest, to be used
+// with variables apply cli command
+func variablesApply(c cliContext, api tabularVariablesAPI) error {
+	manifestPath := c.String("manifest")
+	if manifestPath == "" {
+		manifestPath = defaultVariablesManifest
+	}
+
+	manifest, err := loadVariablesManifest(manifestPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	changes, err := planVariables(api, manifest, c.Bool("prune"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	printVariablesPlan(changes)
+
+	if c.Bool("dry-run") {
+		log.Print("Dry run, no changes have been made.")
+		return nil
+	}
+
+	applied := 0
+	for _, change := range changes {
+		if change.action == variableUnchanged {
+			continue
+		}
+		log.Printf("Applying %v of tabular variable %v...", change.action, change.name)
+		if err = applyVariableChange(api, change); err != nil {
+			msg := fmt.Sprintf("Failed to %v tabular variable %v: %v", change.action, change.name, err)
+			if applied > 0 {
+				msg += fmt.Sprintf(". %v changes before it have been applied", applied)
+			}
+			return cli.NewExitError(msg, 1)
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		log.Print("Tabular variables are up to date.")
+	} else {
+		log.Printf("Applied %v changes.", applied)
+	}
+	return nil
+}
+
+// variablesStatus prints the remaining rows of single-use tabular variables, to be used
+// with variables status cli command. If min-rows is set, it fails when any of them has
+// fewer rows left.
+func variablesStatus(c cliContext, api tabularVariablesAPI) error {
+	generators, err := api.GetGenerators("generator_type=tabular")
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	minRows := c.Int("min-rows")
+	var low []string
+	rows := [][]string{}
+	for _, gen := range generators {
+		if !gen.SingleUse {
+			continue
+		}
+		status := "ok"
+		if gen.RowCount < minRows {
+			status = "low"
+			low = append(low, gen.Name)
+		}
+		if gen.RowCount == 0 {
+			status = "empty"
+		}
+		rows = append(rows, []string{strconv.Itoa(gen.ID), gen.Name, strconv.Itoa(gen.RowCount), status})
+	}
+
+	if len(rows) == 0 {
+		log.Print("There are no single-use tabular variables.")
+		return nil
+	}
+	printResourceTable([]string{"Variable ID", "Variable Name", "Remaining Rows", "Status"}, rows)
+
+	if len(low) > 0 {
+		return cli.NewExitError(fmt.Sprintf("Tabular variables with fewer than %v rows left: %v",
+			minRows, strings.Join(low, ", ")), 1)
+	}
+	return nil
+}
+
+// variableRowsRequirement is the minimum number of rows a tabular variable needs for a run
+type variableRowsRequirement struct {
+	name string
+	rows int
+}
+
+// parseVariableRowsRequirements parses NAME=N requirements
+func parseVariableRowsRequirements(specs []string) ([]variableRowsRequirement, error) {
+	var requirements []variableRowsRequirement
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid variable rows requirement %q, expected NAME=N", spec)
+		}
+		rows, err := strconv.Atoi(parts[1])
+		if err != nil || rows < 1 {
+			return nil, fmt.Errorf("Invalid number of rows in %q, expected a positive number", spec)
+		}
+		requirements = append(requirements, variableRowsRequirement{name: parts[0], rows: rows})
+	}
+	return requirements, nil
+}
+
+// checkVariableRows makes sure the tabular variables have enough rows left. If manifest
+// isn't nil, variables with too few rows are topped up with the rows from their file in
+// the manifest before checking again.
+func checkVariableRows(api tabularVariablesAPI, requirements []variableRowsRequirement, manifest *variablesManifest) error {
+	var problems []string
+	for _, req := range requirements {
+		gen, err := findTabularVar(api, req.name)
+		if err != nil {
+			return err
+		}
+		remaining := 0
+		if gen != nil {
+			remaining = gen.RowCount
+		}
+		if remaining >= req.rows {
+			continue
+		}
+
+		def := manifestVariable(manifest, req.name)
+		if def != nil {
+			log.Printf("Tabular variable %v has %v rows left, %v required. Topping up from %v...",
+				req.name, remaining, req.rows, def.File)
+			if remaining, err = topUpVariable(api, def); err != nil {
+				return fmt.Errorf("Failed to top up tabular variable %v: %w", req.name, err)
+			}
+			if remaining >= req.rows {
+				continue
+			}
+		}
+
+		if gen == nil && def == nil {
+			problems = append(problems, fmt.Sprintf("tabular variable %v doesn't exist", req.name))
+		} else {
+			problems = append(problems, fmt.Sprintf("tabular variable %v has %v rows left, %v required",
+				req.name, remaining, req.rows))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Not enough tabular variable rows to start the run:\n%v", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// topUpVariable adds the rows from the variable's file which it doesn't have anymore,
+// matched by the variable's key, and returns the number of rows it has afterwards
+func topUpVariable(api tabularVariablesAPI, def *variableDefinition) (int, error) {
+	input, err := newTabularInput(def.File, def.Format, def.Mapping)
+	if err != nil {
+		return 0, err
+	}
+	if err = updateTabularVar(api, input, def.Name, tabularUpsert, def.Key, def.SingleUse); err != nil {
+		return 0, err
+	}
+	gen, err := findTabularVar(api, def.Name)
+	if err != nil || gen == nil {
+		return 0, err
+	}
+	return gen.RowCount, nil
+}
+
+// preRunVariableRows checks the tabular variables required by the run have enough rows
+// left, to be ran before starting a new run
+func preRunVariableRows(c cliContext, api tabularVariablesAPI) error {
+	requirements, err := parseVariableRowsRequirements(c.StringSlice("require-variable-rows"))
+	if err != nil || len(requirements) == 0 {
+		return err
+	}
+
+	var manifest *variablesManifest
+	if c.Bool("top-up-variables") {
+		manifestPath := c.String("variables-manifest")
+		if manifestPath == "" {
+			manifestPath = defaultVariablesManifest
+		}
+		if manifest, err = loadVariablesManifest(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	return checkVariableRows(api, requirements, manifest)
+}
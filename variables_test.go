@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func writeVariablesManifest(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "variables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filePath := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadVariablesManifest(t *testing.T) {
+	dir := writeVariablesManifest(t, map[string]string{
+		"rainforest/variables.yml": `
+variables:
+  - name: users
+    file: data/users.csv
+    mapping: data/users.yml
+    description: Test users
+    single_use: true
+  - name: products
+    file: /abs/products.json
+`,
+		"rainforest/invalid.yml": `
+variables:
+  - name: users
+  - name: users
+    file: users.csv
+  - file: other.csv
+`,
+		"rainforest/typo.yml": `
+variables:
+  - name: users
+    path: users.csv
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	manifest, err := loadVariablesManifest(filepath.Join(dir, "rainforest/variables.yml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []variableDefinition{
+		{
+			Name:        "users",
+			File:        filepath.Join(dir, "rainforest/data/users.csv"),
+			Mapping:     filepath.Join(dir, "rainforest/data/users.yml"),
+			Description: "Test users",
+			SingleUse:   true,
+		},
+		{
+			Name: "products",
+			File: "/abs/products.json",
+		},
+	}
+	if !reflect.DeepEqual(manifest.Variables, expected) {
+		t.Errorf("Incorrect manifest. Got %+v, expected: %+v", manifest.Variables, expected)
+	}
+
+	_, err = loadVariablesManifest(filepath.Join(dir, "rainforest/invalid.yml"))
+	if err == nil {
+		t.Fatal("Expected an error for an invalid manifest")
+	}
+	for _, wantErr := range []string{"variable users has no file", "variable users is listed more than once", "variable 3 has no name"} {
+		if !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Expected error to contain %q, got %v", wantErr, err)
+		}
+	}
+
+	_, err = loadVariablesManifest(filepath.Join(dir, "rainforest/typo.yml"))
+	if err == nil {
+		t.Error("Expected an error for an unknown manifest field")
+	}
+}
+
+func TestVariablesApply(t *testing.T) {
+	dir := writeVariablesManifest(t, map[string]string{
+		"variables.yml": `
+variables:
+  - name: new_var
+    file: new.csv
+    description: Brand new
+  - name: changed_var
+    file: changed.csv
+  - name: same_var
+    file: same.csv
+  - name: single_use_var
+    file: same.csv
+    single_use: true
+  - name: columns_var
+    file: same.csv
+  - name: described_var
+    file: same.csv
+    description: Logins
+`,
+		"new.csv":     "login,password\nalice,1\n",
+		"changed.csv": "login,password\nalice,new\nbob,2\n",
+		"same.csv":    "login,password\nalice,1\n",
+	})
+	defer os.RemoveAll(dir)
+
+	account := newFakeTabularAccount()
+	account.addVariable("changed_var", false, []string{"login", "password"}, []string{"alice", "old"}, []string{"carol", "3"})
+	account.addVariable("same_var", false, []string{"login", "password"}, []string{"alice", "1"})
+	account.addVariable("single_use_var", false, []string{"login", "password"}, []string{"alice", "1"})
+	account.addVariable("columns_var", false, []string{"email"}, []string{"alice@example.com"})
+	account.addVariable("described_var", false, []string{"login", "password"}, []string{"alice", "1"})
+	account.addVariable("unlisted_var", false, []string{"login"}, []string{"alice"})
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	// Dry run only shows the plan
+	context := newFakeContext(map[string]interface{}{
+		"manifest": filepath.Join(dir, "variables.yml"),
+		"dry-run":  true,
+		"prune":    true,
+	}, cli.Args{})
+	if err := variablesApply(context, account); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(account.calls) != 0 {
+		t.Errorf("Dry run shouldn't make changes, made: %v", account.calls)
+	}
+	plan := tablesOut.(*bytes.Buffer).String()
+	for _, want := range []string{
+		"create", "new_var", "1 rows",
+		"update", "changed_var", "1 added, 1 removed, 1 changed",
+		"recreate", "single_use_var", "single use changes to true",
+		"columns_var", "columns change",
+		"described_var", "description changes",
+		"delete", "unlisted_var",
+	} {
+		if !strings.Contains(plan, want) {
+			t.Errorf("Expected plan to contain %q, got %v", want, plan)
+		}
+	}
+	if strings.Contains(plan, "same_var") {
+		t.Errorf("Unchanged variables shouldn't be listed in the plan, got %v", plan)
+	}
+	if want := "Plan: 1 to create, 2 to update, 2 to recreate, 1 to delete, 1 unchanged."; !strings.Contains(outBuffer.String(), want) {
+		t.Errorf("Expected output to contain %q, got %v", want, outBuffer.String())
+	}
+
+	// Without prune, unlisted variables are kept
+	context = newFakeContext(map[string]interface{}{
+		"manifest": filepath.Join(dir, "variables.yml"),
+	}, cli.Args{})
+	if err := variablesApply(context, account); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sort.Strings(account.calls)
+	expectedCalls := []string{
+		"create columns_var_uploading",
+		"create new_var",
+		"create single_use_var_uploading",
+		"delete columns_var",
+		"delete single_use_var",
+		"describe described_var",
+		"rename columns_var_uploading to columns_var",
+		"rename single_use_var_uploading to single_use_var",
+	}
+	if !reflect.DeepEqual(account.calls, expectedCalls) {
+		t.Errorf("Incorrect changes made. Got %v, expected: %v", account.calls, expectedCalls)
+	}
+
+	expectedTables := map[string][][]string{
+		"new_var":        {{"alice", "1"}},
+		"changed_var":    {{"alice", "new"}, {"bob", "2"}},
+		"same_var":       {{"alice", "1"}},
+		"single_use_var": {{"alice", "1"}},
+		"columns_var":    {{"alice", "1"}},
+		"described_var":  {{"alice", "1"}},
+		"unlisted_var":   {{"alice"}},
+	}
+	for name, expected := range expectedTables {
+		if table := account.table(name); !reflect.DeepEqual(table, expected) {
+			t.Errorf("Incorrect rows of %v. Got %v, expected: %v", name, table, expected)
+		}
+	}
+	for _, gen := range account.generators {
+		if gen.Name == "new_var" && gen.Description != "Brand new" {
+			t.Errorf("Incorrect description of new_var: %v", gen.Description)
+		}
+		if gen.Name == "described_var" && gen.Description != "Logins" {
+			t.Errorf("Incorrect description of described_var: %v", gen.Description)
+		}
+		if gen.Name == "single_use_var" && !gen.SingleUse {
+			t.Error("Expected single_use_var to be single use")
+		}
+	}
+
+	// Everything is up to date now
+	account.calls = nil
+	outBuffer.Reset()
+	if err := variablesApply(context, account); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(account.calls) != 0 {
+		t.Errorf("No changes expected, made: %v", account.calls)
+	}
+	if !strings.Contains(outBuffer.String(), "up to date") {
+		t.Errorf("Expected variables to be up to date, got %v", outBuffer.String())
+	}
+}
+
+func TestVariablesApply_InvalidKey(t *testing.T) {
+	dir := writeVariablesManifest(t, map[string]string{
+		"variables.yml": `
+variables:
+  - name: users
+    file: users.csv
+    key: logn
+`,
+		"users.csv": "login,password\nalice,1\n",
+	})
+	defer os.RemoveAll(dir)
+
+	account := newFakeTabularAccount()
+	account.addVariable("users", false, []string{"login", "password"}, []string{"alice", "old"})
+
+	context := newFakeContext(map[string]interface{}{
+		"manifest": filepath.Join(dir, "variables.yml"),
+	}, cli.Args{})
+	err := variablesApply(context, account)
+	if err == nil {
+		t.Fatal("Expected an error for a key column which isn't in the file")
+	}
+	if !strings.Contains(err.Error(), "Key column logn not found") {
+		t.Errorf("Unexpected error: %v", err.Error())
+	}
+	if len(account.calls) != 0 {
+		t.Errorf("No changes expected, made: %v", account.calls)
+	}
+}
+
+func TestVariablesStatus(t *testing.T) {
+	account := newFakeTabularAccount()
+	account.addVariable("coupons", true, []string{"code"}, []string{"A"}, []string{"B"}, []string{"C"})
+	account.addVariable("accounts", true, []string{"login"}, []string{"alice"})
+	account.addVariable("drained", true, []string{"login"})
+	account.addVariable("users", false, []string{"login"}, []string{"alice"})
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+	tablesOut = &bytes.Buffer{}
+	defer func() {
+		tablesOut = os.Stdout
+	}()
+
+	context := newFakeContext(map[string]interface{}{}, cli.Args{})
+	if err := variablesStatus(context, account); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	table := tablesOut.(*bytes.Buffer).String()
+	for _, want := range []string{"coupons", "3 | ok", "accounts", "drained", "empty"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("Expected status to contain %q, got %v", want, table)
+		}
+	}
+	if strings.Contains(table, "users") {
+		t.Errorf("Expected only single-use variables, got %v", table)
+	}
+
+	tablesOut = &bytes.Buffer{}
+	context = newFakeContext(map[string]interface{}{"min-rows": 2}, cli.Args{})
+	err := variablesStatus(context, account)
+	if err == nil {
+		t.Fatal("Expected an error for variables with too few rows")
+	}
+	if want := "fewer than 2 rows left: accounts, drained"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected error to contain %q, got %v", want, err)
+	}
+	table = tablesOut.(*bytes.Buffer).String()
+	if !regexp.MustCompile(`accounts\s*\|\s*1\s*\|\s*low`).MatchString(table) ||
+		!regexp.MustCompile(`drained\s*\|\s*0\s*\|\s*empty`).MatchString(table) {
+		t.Errorf("Expected low and empty variables in the status, got %v", table)
+	}
+}
+
+func TestParseVariableRowsRequirements(t *testing.T) {
+	requirements, err := parseVariableRowsRequirements([]string{"coupons=10", "users=1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []variableRowsRequirement{{name: "coupons", rows: 10}, {name: "users", rows: 1}}
+	if !reflect.DeepEqual(requirements, expected) {
+		t.Errorf("Incorrect requirements. Got %+v, expected: %+v", requirements, expected)
+	}
+
+	for _, spec := range []string{"coupons", "=10", "coupons=ten", "coupons=0"} {
+		if _, err = parseVariableRowsRequirements([]string{spec}); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestPreRunVariableRows(t *testing.T) {
+	dir := writeVariablesManifest(t, map[string]string{
+		"variables.yml": `
+variables:
+  - name: coupons
+    file: coupons.csv
+    single_use: true
+`,
+		"coupons.csv": "code\nC\nD\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var outBuffer bytes.Buffer
+	log.SetOutput(&outBuffer)
+	defer log.SetOutput(os.Stdout)
+
+	account := newFakeTabularAccount()
+	account.addVariable("coupons", true, []string{"code"}, []string{"A"})
+	account.addVariable("users", true, []string{"login"}, []string{"alice"}, []string{"bob"})
+
+	// Enough rows left
+	context := newFakeContext(map[string]interface{}{
+		"require-variable-rows": []string{"users=2"},
+	}, cli.Args{})
+	if err := preRunVariableRows(context, account); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Too few rows without topping up
+	context = newFakeContext(map[string]interface{}{
+		"require-variable-rows": []string{"users=3", "coupons=3", "missing=1"},
+	}, cli.Args{})
+	err := preRunVariableRows(context, account)
+	if err == nil {
+		t.Fatal("Expected an error for variables with too few rows")
+	}
+	for _, want := range []string{
+		"tabular variable users has 2 rows left, 3 required",
+		"tabular variable coupons has 1 rows left, 3 required",
+		"tabular variable missing doesn't exist",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+	if len(account.calls) != 0 {
+		t.Errorf("No changes expected, made: %v", account.calls)
+	}
+
+	// Topping up from the manifest
+	context = newFakeContext(map[string]interface{}{
+		"require-variable-rows": []string{"coupons=3"},
+		"top-up-variables":      true,
+		"variables-manifest":    filepath.Join(dir, "variables.yml"),
+	}, cli.Args{})
+	if err = preRunVariableRows(context, account); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := [][]string{{"A"}, {"C"}, {"D"}}
+	if table := account.table("coupons"); !reflect.DeepEqual(table, expected) {
+		t.Errorf("Incorrect rows after top up. Got %v, expected: %v", table, expected)
+	}
+
+	// Topping up isn't enough, rows which are left aren't added again
+	context = newFakeContext(map[string]interface{}{
+		"require-variable-rows": []string{"coupons=10"},
+		"top-up-variables":      true,
+		"variables-manifest":    filepath.Join(dir, "variables.yml"),
+	}, cli.Args{})
+	err = preRunVariableRows(context, account)
+	if err == nil || !strings.Contains(err.Error(), "coupons has 3 rows left, 10 required") {
+		t.Errorf("Expected an error after topping up, got %v", err)
+	}
+	if table := account.table("coupons"); !reflect.DeepEqual(table, expected) {
+		t.Errorf("Incorrect rows after repeated top up. Got %v, expected: %v", table, expected)
+	}
+}